@@ -41,6 +41,25 @@ type Node struct {
 	Exec        string
 }
 
+//QueueLimit은 queue의 최대 길이와 넘쳤을때의 처리 방법이다.
+type QueueLimit struct {
+	Max    int    //0이면 제한이 없다.
+	Policy string //reject, dropoldest, block. 없으면 reject
+}
+
+//ApiLimit은 api별 worker 수와 대기 queue 길이이다.
+type ApiLimit struct {
+	Concurrency int    //동시에 처리하는 최대 개수, 0이면 client pool을 같이 쓴다.
+	Queue       int    //Concurrency를 넘었을때 기다리는 최대 개수, 없으면 1024
+	Policy      string //Queue가 넘쳤을때 처리 방법, 없으면 reject
+}
+
+//WorkerConfig는 spn별 rand/topic request worker 설정이다.
+type WorkerConfig struct {
+	Pool int                 //worker 수, 0이면 request마다 goroutine을 띄운다.
+	Apis map[string]ApiLimit //별도의 worker로 처리할 api
+}
+
 type GateGroup struct {
 	Spn   string
 	Gates []Node
@@ -58,15 +77,73 @@ type globalConfig struct {
 	LogDCacheSize   int
 	LogDConsolePort int
 	DumpRecover     bool
+	MaxMessageSize  int      //chunk로 나눠 주고받는 메세지 body의 최대 크기(byte), 없으면 DefaultMaxMessageSize
+	Codecs          []string //link에서 사용할 codec 우선순위, 없으면 json. msgpack은 frame마다 변환하므로 CPU를 더 쓴다.
+	MinProtocol     int      //접속을 받는 최소 protocol version, 없으면 legacy version도 받는다.
 	Log             struct {
 		Path      string
 		Error     bool
 		Info      bool
 		Debug     bool
 		Packet    bool
+		Trace     bool
 		Immediate bool
 	}
 
+	//DeadLetter는 전달하지 못하고 버려진 메세지를 보관하는 설정이다.
+	DeadLetter struct {
+		Size  int    //메모리에 보관하는 최대 개수
+		Spill bool   //메모리에서 밀려난 메세지를 파일로 남긴다.
+		Path  string //spill 파일 경로, 없으면 log path를 사용
+	}
+
+	//UnsentQ는 연결이 끊어진 동안 보내지 못한 메세지를 보관하는 설정이다.
+	UnsentQ struct {
+		Durable   bool   //WAL 파일에 남겨 재시작 후에도 다시 보낸다.
+		Path      string //WAL 파일 경로, 없으면 log path를 사용
+		MaxCount  int    //보관하는 최대 개수, 메모리 queue에도 적용된다.
+		MaxBytes  int    //보관하는 최대 크기(byte), WAL에만 적용된다.
+		ExpireSec uint32 //보관 시간, 없으면 TxnTimeoutSec
+		Policy    string //MaxCount를 넘었을때 처리 방법, 없으면 dropoldest
+		SyncMs    int    //WAL을 fsync하는 간격, 0이면 DefaultWalSyncMs, 음수이면 메세지마다 한다.
+	}
+
+	//Queues는 client의 수신 queue 제한이다.
+	Queues struct {
+		Grid     QueueLimit //grid key별 request queue
+		Rand     QueueLimit //동시에 처리중인 rand/topic request, Workers.Pool이 있으면 worker 대기 queue(없으면 1024)
+		Dispatch QueueLimit //gate/router에서 받은 메세지 queue
+		Write    QueueLimit //connection별 write queue, reject이면 호출한 쪽이 unsentQ에 넣는다.
+	}
+
+	Workers map[string]WorkerConfig //spn별
+
+	//Breaker는 client의 spn/api별 circuit breaker 설정이다. MinRequests가 0이면 사용하지 않는다.
+	Breaker struct {
+		WindowSec   uint32  //실패율을 계산하는 구간, 없으면 BreakerWindowSec
+		MinRequests int     //구간내 이보다 적게 보냈으면 열지 않는다.
+		FailureRate float64 //이 비율 이상 실패하면 연다. 0보다 크고 1이하가 아니면 DefaultBreakerFailureRate
+		OpenSec     uint32  //열린 뒤 half-open으로 가기까지의 시간, 없으면 BreakerOpenSec
+	}
+
+	//Idempotency는 IdempotencyKey가 있는 request의 응답을 provider에서 보관하는 설정이다.
+	Idempotency struct {
+		WindowSec  uint32 //응답을 보관하는 시간, 없으면 IdempotencyWindowSec
+		MaxEntries int    //보관하는 최대 개수, 넘으면 중복 검사 없이 처리한다.
+	}
+
+	//Writer는 connection별 write goroutine이 frame을 모아 보내는 설정이다.
+	Writer struct {
+		FlushBytes   int //이만큼 모이면 바로 보낸다. 없으면 DefaultWriteFlushBytes
+		FlushDelayMs int //queue가 비었을때 더 모으려고 기다리는 시간, 0이면 바로 보낸다.
+	}
+
+	//Compression은 link에서 큰 body를 deflate로 압축하는 설정이다.
+	Compression struct {
+		Threshold int //이 크기(byte)보다 큰 body를 압축한다. 없으면 DefaultCompressThreshold, 음수이면 압축하지 않는다.
+		Level     int //deflate level(1~9), 없으면 기본값
+	}
+
 	Routers      []Node
 	SNodes       []SvcGateGroup
 	ENodes       []GateGroup
@@ -80,6 +80,7 @@ var ilog *log.Logger
 var dlog *log.Logger
 var dump *log.Logger
 var plog *log.Logger
+var tlog *log.Logger
 
 var logDConn *net.UDPConn
 
@@ -113,6 +114,7 @@ func initLog(path string) {
 	dlog = log.New(&logWriteCloser{path: path, prefix: "debug"}, "", log.LstdFlags|log.Lmicroseconds)
 	dump = log.New(&logWriteCloser{path: path, prefix: "dmp"}, "", log.Ldate|log.Ltime)
 	plog = log.New(&logWriteCloser{path: path, prefix: "packet"}, "", log.LstdFlags|log.Lmicroseconds)
+	tlog = log.New(&logWriteCloser{path: path, prefix: "trace"}, "", 0)
 
 	connectLogD()
 }
@@ -150,12 +152,34 @@ func PacketLog(a string, v ...interface{}) {
 	}
 }
 
+//IsPacketLogEnabled는 PacketLog가 어딘가에 기록되는지 확인한다. 로그 문자열을 만들기 전에 확인한다.
+func IsPacketLogEnabled() bool {
+	return Config.Global.Log.Packet || logDConn != nil
+}
+
+func IsTraceEnabled() bool {
+	return Config.Global.Log.Trace
+}
+
+//TraceLog는 span 한개를 한줄로 기록한다. (zipkin v2 json)
+func TraceLog(span []byte) {
+	if Config.Global.Log.Trace {
+		tlog.Output(2, string(span))
+	}
+}
+
 //Dump is log for all goroutine stack
+//InitApp 전에는 dump log가 없으므로 표준 log로 남긴다.
 func Dump(r interface{}) {
 	if r != nil {
 		buf := make([]byte, 1<<16)
 		stackSize := runtime.Stack(buf, true)
-		dump.Output(3, fmt.Sprintf("%v\r\n%s", r, buf[0:stackSize]))
+
+		l := dump
+		if l == nil {
+			l = log.Default()
+		}
+		l.Output(3, fmt.Sprintf("%v\r\n%s", r, buf[0:stackSize]))
 
 	}
 }
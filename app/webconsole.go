@@ -20,6 +20,21 @@ type Page struct {
 	Body  []byte
 }
 
+type consoleLink struct {
+	pattern string
+	title   string
+}
+
+var consoleLinks []consoleLink
+
+//HandleConsole은 web console에 페이지를 추가한다. title이 있으면 about 페이지에 링크가 걸린다.
+func HandleConsole(pattern string, title string, handler func(http.ResponseWriter, *http.Request)) {
+	http.HandleFunc(pattern, handler)
+	if len(title) > 0 {
+		consoleLinks = append(consoleLinks, consoleLink{pattern: pattern, title: title})
+	}
+}
+
 func aboutHandler(w http.ResponseWriter, r *http.Request) {
 
 	if node, _, ok := Config.Global.Find(App.Eid); ok {
@@ -42,6 +57,9 @@ func aboutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fmt.Fprintf(w, "<br/><br/><div><a href='/debug/pprof/'>profiling</a></div>")
+	for _, v := range consoleLinks {
+		fmt.Fprintf(w, "<div><a href='%s'>%s</a></div>", v.pattern, v.title)
+	}
 
 	if b, err := json.Marshal(Config); err == nil {
 		fmt.Fprintf(w, "<br/><br/><h1>config</h1><div>%s</div>", string(b))
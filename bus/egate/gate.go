@@ -53,7 +53,7 @@ func (srv *gate) LocalRequest(header *ReqHeader, mpck MsgPack) error {
 }
 
 func (srv *gate) RouteResponse(header *ResHeader, mpck MsgPack) error {
-	return srv.remoter.Send(mpck)
+	return srv.remoter.SendResponse(header, mpck)
 }
 
 func (srv *gate) LocalResponse(header *ResHeader, mpck MsgPack) error {
@@ -16,11 +16,12 @@ import (
 
 type router struct {
 	Server
+	topics *TopicRoutes
 }
 
 //NewServer
 func newRouter(eid string) *router {
-	srv := &router{}
+	srv := &router{topics: NewTopicRoutes()}
 	srv.Init(app.Config.MyNode.ListenAddr, srv, srv)
 
 	return srv
@@ -34,6 +35,10 @@ func (srv *router) RouteRequest(header *ReqHeader, mpck MsgPack) error {
 func (srv *router) LocalRequest(header *ReqHeader, mpck MsgPack) error {
 	// router는 direct로 던지지 않는다.
 
+	if len(header.Topic) > 0 {
+		return srv.publish(header, mpck)
+	}
+
 	if len(header.ToGateEid) > 0 {
 		return srv.SendDirect(header.ToGateEid, mpck)
 	}
@@ -45,6 +50,34 @@ func (srv *router) LocalRequest(header *ReqHeader, mpck MsgPack) error {
 	return IssueErrorf("can not send message, no route info")
 }
 
+//publish는 구독 provider마다 gate 하나를 골라 보낸다. gate는 TopicEids의 provider에게만 전달하므로
+//여러 gate에 붙은 provider도 한번만 받는다. 구독 provider를 알리지 않은 gate에는 그대로 보낸다.
+func (srv *router) publish(header *ReqHeader, mpck MsgPack) error {
+	routes := srv.topics.Route(header.Topic)
+	if len(routes) == 0 {
+		app.DebugLog("%s no subscriber for topic[%s]", header.TraceTag(), header.Topic)
+		return nil
+	}
+
+	for eid, provs := range routes {
+		out := mpck
+		if provs != nil {
+			h := *header
+			h.TopicEids = provs
+			out = NewMsgPack(MsgTypeRequest, nil, mpck.Body())
+			if err := out.ResetHeader(h); err != nil {
+				return err
+			}
+		}
+
+		if err := srv.SendDirect(eid, out); err != nil {
+			app.ErrorLog("%s publish topic[%s] to %s, %s", header.TraceTag(), header.Topic, eid, err.Error())
+		}
+	}
+
+	return nil
+}
+
 //router는 local이건 remote건 내부로 던진다.
 func (srv *router) RouteResponse(header *ResHeader, mpck MsgPack) error {
 	return srv.LocalResponse(header, mpck)
@@ -55,9 +88,15 @@ func (srv *router) LocalResponse(header *ResHeader, mpck MsgPack) error {
 	return srv.SendDirect(PeekFromEids(header.ToEids), mpck)
 }
 
+//Unsubscribe는 연결이 끊어진 gate의 구독을 지운다.
+func (srv *router) Unsubscribe(eid string) {
+	srv.topics.Unregister(eid)
+}
+
 func (srv *router) OnAccept(eid string, toplgy *Topology) error {
 	if _, spn, ok := app.Config.Global.Find(eid); ok {
 		if util.StrCmpI(spn, toplgy.Spn) {
+			srv.topics.Register(eid, toplgy.Topics, toplgy.Subscribers)
 			return nil
 		} else {
 			return IssueErrorf("[%s] is different from config", toplgy.Spn)
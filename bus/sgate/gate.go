@@ -10,6 +10,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 
 	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
@@ -21,12 +22,13 @@ type gate struct {
 	Server
 	gblock  *GridBlock
 	fedapi  *FederatedApi
+	topics  *TopicTable
 	remoter Proxy
 }
 
 //NewGate
 func newGate(eid string) *gate {
-	srv := &gate{gblock: NewGridBlock(), fedapi: NewFederatedApi()}
+	srv := &gate{gblock: NewGridBlock(), fedapi: NewFederatedApi(), topics: NewTopicTable()}
 	srv.Server.Init(app.Config.MyNode.ListenAddr, srv, srv)
 	srv.remoter = NewProxy(app.Config.Global.Routers, srv)
 
@@ -86,6 +88,9 @@ func (srv *gate) RouteRequest(header *ReqHeader, msg MsgPack) error {
 
 //Local Provider로 요청을 보낸다.
 func (srv *gate) LocalRequest(header *ReqHeader, msg MsgPack) error {
+	if len(header.Topic) > 0 {
+		return srv.publish(header, msg)
+	}
 
 	if len(header.Spn) > 0 {
 		if isLocal := util.StrCmpI(header.Spn, app.Config.Spn); !isLocal {
@@ -93,6 +98,10 @@ func (srv *gate) LocalRequest(header *ReqHeader, msg MsgPack) error {
 		}
 	}
 
+	if header.Fanout {
+		return srv.fanout(header, msg)
+	}
+
 	//key값으로 rebuild 하여.
 	ok, err := srv.adjustKey(header, msg.Body())
 	if err != nil {
@@ -112,14 +121,68 @@ func (srv *gate) LocalRequest(header *ReqHeader, msg MsgPack) error {
 	}
 }
 
+//fanout은 key 분산 없이 ToEid로 보내고, ToEid가 없으면 모든 provider에게 보낸다.
+func (srv *gate) fanout(header *ReqHeader, msg MsgPack) error {
+	if len(header.ToEid) > 0 {
+		return srv.SendDirect(header.ToEid, msg)
+	}
+
+	if svcgrp, ok := app.Config.Global.FindSvcGateGroup(app.Config.Spn); ok {
+		for _, prov := range svcgrp.Providers {
+			if err := srv.SendDirect(prov.Eid, msg); err != nil {
+				app.ErrorLog("%s broadcast to %s, %s", header.TraceTag(), prov.Eid, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+//publish는 router가 TopicEids로 고른 provider에게 보낸다. TopicEids가 없으면 구독하는 local provider 모두에게 보낸다.
+func (srv *gate) publish(header *ReqHeader, msg MsgPack) error {
+	eids := srv.topics.FindEids(header.Topic)
+	if len(header.TopicEids) > 0 {
+		eids = eids[:0]
+		for _, eid := range header.TopicEids {
+			if srv.topics.IsSubscribed(header.Topic, eid) {
+				eids = append(eids, eid)
+			}
+		}
+	}
+
+	for _, eid := range eids {
+		if err := srv.SendDirect(eid, msg); err != nil {
+			app.ErrorLog("%s publish topic[%s] to %s, %s", header.TraceTag(), header.Topic, eid, err.Error())
+		}
+	}
+
+	return nil
+}
+
 func (srv *gate) RouteResponse(header *ResHeader, msg MsgPack) error {
-	return srv.remoter.Send(msg)
+	return srv.remoter.SendResponse(header, msg)
 }
 
 func (srv *gate) LocalResponse(header *ResHeader, msg MsgPack) error {
 	return srv.SendDirect(PeekFromEids(header.ToEids), msg)
 }
 
+//Unsubscribe는 연결이 끊어진 provider의 구독을 지우고 router에 다시 알린다.
+func (srv *gate) Unsubscribe(eid string) {
+	before := srv.topics.Subscribers()
+	srv.topics.Unregister(eid)
+	srv.advertiseIfChanged(before)
+}
+
+//advertiseIfChanged는 topic이나 구독 provider가 바뀌었으면 router에 다시 알린다.
+//router는 provider마다 gate 하나를 고르므로 provider 구독이 바뀌어도 알려야 한다.
+func (srv *gate) advertiseIfChanged(before map[string][]string) {
+	subs := srv.topics.Subscribers()
+	if !reflect.DeepEqual(before, subs) {
+		srv.remoter.Advertise(Topology{Spn: app.Config.Spn, Topics: srv.topics.Topics(), Subscribers: subs})
+	}
+}
+
 func (srv *gate) OnAccept(eid string, toplgy *Topology) error {
 	if _, spn, ok := app.Config.Global.Find(eid); !ok {
 		return IssueErrorf("%s unknown server", eid)
@@ -127,6 +190,11 @@ func (srv *gate) OnAccept(eid string, toplgy *Topology) error {
 		return IssueErrorf("%s spn is different from server", toplgy.Spn)
 	}
 
+	//provider의 구독이 바뀌면 router에 gate의 topic과 구독 provider를 다시 알린다.
+	before := srv.topics.Subscribers()
+	srv.topics.Register(toplgy.Spn, eid, toplgy.Topics)
+	srv.advertiseIfChanged(before)
+
 	if len(toplgy.FederatedKey) == 0 { //아마도 random으로 붙는 녀석일 듯
 		return nil
 	}
@@ -61,7 +61,7 @@ func (srv *Gate) LocalRequest(header *n.ReqHeader, msg n.MsgPack) error {
 
 //Deliverer interface 구현. stub에서 호출된다.
 func (srv *Gate) RouteResponse(header *n.ResHeader, msg n.MsgPack) error {
-	return srv.remoter.Send(msg)
+	return srv.remoter.SendResponse(header, msg)
 }
 
 //Deliverer interface 구현. stub에서 호출된다.
@@ -246,9 +246,28 @@ func goAccept(srv *Gate, rwc net.Conn) {
 		return
 	}
 
+	//Version을 보내지 않는 client는 legacy version으로 json을 그대로 사용한다.
+	version, caps, nerr := n.NegotiateProtocol(&connMsg.Header)
+	if nerr != nil {
+		app.ErrorLog("Server Accept %s, %s", nerr.Error(), string(rawHeader))
+		acptMsg, _ := n.BuildMsgPack(
+			n.AccptHeader{ErrCode: nerr.Code(), ErrText: nerr.Error()},
+			n.AccptBody{})
+		if acptMsg != nil {
+			conn.Write(acptMsg.Bytes(), true)
+		}
+		conn.Close()
+		return
+	}
+
+	codec := ""
+	if n.HasCap(caps, n.CapCodec) {
+		codec = n.NegotiateCodec(connMsg.Header.Codecs)
+	}
+
 	eid := srv.getNewEid()
 	stb := srv.register(eid, conn)
-	acptMsg, _ := n.BuildMsgPack(n.AccptHeader{ErrCode: n.NErrorSucess}, n.AccptBody{})
+	acptMsg, _ := n.BuildMsgPack(n.AccptHeader{ErrCode: n.NErrorSucess}, n.AccptBody{Version: version, Caps: caps, Codec: codec})
 
 	if acptMsg != nil {
 		conn.Write(acptMsg.Bytes(), true)
@@ -256,6 +275,12 @@ func goAccept(srv *Gate, rwc net.Conn) {
 		app.ErrorLog("can not build")
 	}
 
+	if err := n.SetLinkProtocol(conn, version, caps, codec); err != nil {
+		app.ErrorLog("[%s] %s", eid, err.Error())
+		conn.Close()
+		return
+	}
+
 	app.DebugLog("connected from %s", eid)
 
 	stb.Go()
@@ -63,7 +63,7 @@ func NewStub(eid string, dlver n.Deliverer, onClose OnClose) GateStub {
 	stb := &stub{remoteEid: eid, dlver: dlver, appStatus: n.AppStatusRunning}
 
 	stb.unsentTick = time.NewTicker(time.Second * co.UnsentTimerSec)
-	stb.unsentQ = n.NewUnsentQ(nil, co.TxnTimeoutSec)
+	stb.unsentQ = n.NewUnsentQ(eid, nil, co.TxnTimeoutSec)
 	stb.inq = make(map[uint64]inContexts)
 	stb.outq = make(map[uint64]outContexts)
 	stb.lastTxnNo = 0
@@ -98,6 +98,46 @@ func (stb *stub) newTxnNo() uint64 {
 	return stb.lastTxnNo //이건  atomic으로 안써도 될 듯..
 }
 
+//findInTxn은 client가 보낸 txnNo로 tcgate가 다시 매긴 txnNo를 찾는다.
+func (stb *stub) findInTxn(orgTxn uint64) (uint64, bool) {
+	stb.lock.RLock()
+	defer stb.lock.RUnlock()
+
+	for txnNo, inc := range stb.inq {
+		if inc.orgTxn == orgTxn {
+			return txnNo, true
+		}
+	}
+
+	return 0, false
+}
+
+//takeInTxn은 tcgate가 매긴 txnNo의 inContexts를 찾는다. remove이면 찾은 것을 지운다.
+func (stb *stub) takeInTxn(txnNo uint64, remove bool) (inContexts, bool) {
+	stb.lock.Lock()
+	defer stb.lock.Unlock()
+
+	inc, ok := stb.inq[txnNo]
+	if ok && remove {
+		delete(stb.inq, txnNo)
+	}
+
+	return inc, ok
+}
+
+//takeOutTxn은 provider로 보낸 request의 outContexts를 찾아서 지운다.
+func (stb *stub) takeOutTxn(txnNo uint64) (outContexts, bool) {
+	stb.lock.Lock()
+	defer stb.lock.Unlock()
+
+	octx, ok := stb.outq[txnNo]
+	if ok {
+		delete(stb.outq, txnNo)
+	}
+
+	return octx, ok
+}
+
 func (stb stub) String() string {
 	return fmt.Sprintf("%s", stb.remoteEid)
 }
@@ -135,6 +175,9 @@ func (stb *stub) ResetConn(rw n.NetIO) {
 
 		stb.rw = rw
 		stb.unsentQ.Register(rw)
+		if u, ok := rw.(n.UnsentIO); ok {
+			u.AddUnsentEvent(stb.unsentQ.Add)
+		}
 		stb.lastUsed = time.Now()
 		stb.appStatus = n.AppStatusRunning
 
@@ -161,11 +204,13 @@ func (stb *stub) Send(mpck n.MsgPack) error {
 		}
 
 		txnNo := stb.newTxnNo()
+		stb.lock.Lock()
 		stb.outq[txnNo] = outContexts{
 			orgTxn:   h.TxnNo,
 			lastUsed: time.Now(),
 			fromEids: h.FromEids,
 		}
+		stb.lock.Unlock()
 
 		h.FromEids = []string{}
 		h.TxnNo = txnNo
@@ -188,7 +233,8 @@ func (stb *stub) Send(mpck n.MsgPack) error {
 		} else {
 			//h.ToEids = toEids
 			h.ToEids = []string{}
-			if inc, ok := stb.inq[h.TxnNo]; !ok {
+			//stream은 마지막 frame에서 지운다.
+			if inc, ok := stb.takeInTxn(h.TxnNo, h.Stream != n.StreamFrameMore); !ok {
 				return co.IssueErrorf("txn not found ", h.TxnNo)
 			} else {
 				// login session 처리를 한다.
@@ -200,9 +246,7 @@ func (stb *stub) Send(mpck n.MsgPack) error {
 				}
 				// login session end.
 
-				txnNo := h.TxnNo
 				h.TxnNo = inc.orgTxn
-				delete(stb.inq, txnNo)
 			}
 
 			if err := mpck.ResetHeader(*h); err != nil {
@@ -211,9 +255,11 @@ func (stb *stub) Send(mpck n.MsgPack) error {
 		}
 	}
 
-	b := mpck.Bytes()
-	if err := stb.rw.Write(b, true); err != nil {
-		stb.unsentQ.Add(b) //나중에 보내줄 것이므로... 여기서 retrun하지 말구 이후에도 계속 기다리자
+	if err := n.WriteMsgPack(stb.rw, mpck, true); err != nil {
+		if n.IsPermanentWriteError(err) {
+			return err
+		}
+		stb.unsentQ.Add(mpck.Bytes()) //나중에 보내줄 것이므로... 여기서 retrun하지 말구 이후에도 계속 기다리자
 	}
 
 	return nil
@@ -277,13 +323,21 @@ func goStubHandle(stb *stub) {
 				}
 
 				txnNo := stb.newTxnNo()
+				stb.lock.Lock()
 				stb.inq[txnNo] = inContexts{
 					orgTxn:   h.TxnNo,
 					lastUsed: time.Now(),
 					loginTxn: loginTxn,
 				}
+				stb.lock.Unlock()
 
 				h.TxnNo = txnNo
+				//client에서 시작된 request는 tcgate가 trace를 시작한다.
+				if len(h.TraceID) == 0 {
+					h.TraceID = n.NewTraceID()
+					h.SpanID = n.NewSpanID()
+				}
+
 				if len(h.FromSpn) == 0 {
 					h.FromSpn = app.Config.Spn
 				}
@@ -307,7 +361,9 @@ func goStubHandle(stb *stub) {
 					}
 
 					if err != nil {
-						app.ErrorLog("Request remote %s", err.Error())
+						app.ErrorLog("%s Request remote %s", h.TraceTag(), err.Error())
+						n.AddDeadLetter(err.Error(), stb.remoteEid, mpck, n.Redeliver(stb.dlver))
+						n.ReplyNotFound(stb.dlver, true, h, err)
 					}
 				}
 			}
@@ -318,13 +374,12 @@ func goStubHandle(stb *stub) {
 				app.ErrorLog("Request parse error!, %v, %s", err, string(header))
 			} else {
 
-				if octx, ok := stb.outq[h.TxnNo]; !ok {
-					app.ErrorLog("Not found origin txnNo", h.TxnNo)
+				if octx, ok := stb.takeOutTxn(h.TxnNo); !ok {
+					app.ErrorLog("Not found origin txnNo %d, trace[%s]", h.TxnNo, h.TraceID)
+					n.AddDeadLetter(fmt.Sprintf("txn[%d] not found", h.TxnNo), stb.remoteEid, n.NewMsgPack(n.MsgTypeResponse, header, body), nil)
 				} else {
-					txnNo := h.TxnNo
 					h.TxnNo = octx.orgTxn
 					h.ToEids = octx.fromEids
-					delete(stb.outq, txnNo)
 
 					mpck := n.NewMsgPack(n.MsgTypeResponse, header, body)
 
@@ -332,17 +387,38 @@ func goStubHandle(stb *stub) {
 						app.ErrorLog("Request parse rebuild error %s", err.Error())
 					} else {
 						if len(h.ToEids) == 1 && stb.dlver.(n.ServiceDeliverer).IsLocal(h.ToEids[0]) {
-							if err := stb.dlver.LocalResponse(h, mpck); err != nil {
-								app.ErrorLog("%v", err)
-							}
+							err = stb.dlver.LocalResponse(h, mpck)
 						} else {
-							if err := stb.dlver.RouteResponse(h, mpck); err != nil {
-								app.ErrorLog("%v", err)
-							}
+							err = stb.dlver.RouteResponse(h, mpck)
+						}
+
+						if err != nil {
+							app.ErrorLog("%v", err)
+							n.AddDeadLetter(err.Error(), stb.remoteEid, mpck, n.Redeliver(stb.dlver))
 						}
 					}
 				}
 			}
+
+		case n.MsgTypeCancel:
+			h := n.ParseCancelHeader(header)
+			if h == nil {
+				app.ErrorLog("Cancel parse error!, %s", string(header))
+			} else if txnNo, ok := stb.findInTxn(h.TxnNo); !ok {
+				app.DebugLog("cancel txnNo %d not in progress", h.TxnNo)
+			} else {
+				//client의 txnNo를 tcgate가 보낸 request의 txnNo로 바꾼다.
+				h.TxnNo = txnNo
+				h.FromEids = n.PushToEids(stb.remoteEid, h.FromEids)
+				mpck := n.NewMsgPack(n.MsgTypeCancel, header, body)
+
+				if err := mpck.ResetHeader(*h); err != nil {
+					app.ErrorLog("Cancel parse rebuild error %s", err.Error())
+				} else if err := n.DeliverCancel(h, mpck); err != nil {
+					app.ErrorLog("trace[%s] cancel %s", h.TraceID, err.Error())
+				}
+			}
+
 		default:
 			app.ErrorLog("can not deal with message type[%c]", msgType)
 		}
@@ -21,6 +21,10 @@ const (
 	GridTxnRelaxedCount        = 2
 	GridContextCleanTimeoutSec = 300
 	GridCtxSize                = 64
+	IdempotencyWindowSec       = 300
+	BreakerWindowSec           = 10
+	BreakerOpenSec             = 5
+	StreamBufferSize           = 256
 	Iso8601Format              = "2006-01-02T15:04:05.000+09:00"
 )
 
@@ -0,0 +1,283 @@
+/********************************************************************************
+* breaker.go
+* client에서 spn/api별로 실패율을 보고 circuit을 열어, 죽은 서비스로의
+* request가 timeout까지 쌓이지 않고 NErrorCircuitOpen으로 바로 실패하도록 한다.
+* 열린 circuit은 OpenSec 뒤에 한개의 request만 흘려보내 보고(half-open),
+* 성공하면 닫고 실패하면 다시 연다.
+* SetRetryPolicy로 등록한 api는 jitter가 들어간 backoff로 다시 시도한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+//RetryPolicy는 실패한 request를 다시 보내는 정책이다.
+//다시 보내는 request는 같은 IdempotencyKey를 가지므로 provider에서 한번만 처리된다.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 2, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+const DefaultBreakerFailureRate = 0.5
+
+type breaker struct {
+	key         string
+	lock        *sync.Mutex
+	state       int
+	windowStart time.Time
+	total       int
+	fails       int
+	openUntil   time.Time
+}
+
+type resilience struct {
+	breakers *sync.Map //spn/api -> *breaker
+	retries  *sync.Map //spn/api -> RetryPolicy
+}
+
+func newResilience() *resilience {
+	return &resilience{breakers: new(sync.Map), retries: new(sync.Map)}
+}
+
+func resilienceKey(spn string, api string) string {
+	return spn + "/" + api
+}
+
+func (r *resilience) breaker(spn string, api string) *breaker {
+	key := resilienceKey(spn, api)
+	if v, ok := r.breakers.Load(key); ok {
+		return v.(*breaker)
+	}
+
+	v, _ := r.breakers.LoadOrStore(key, &breaker{key: key, lock: new(sync.Mutex), windowStart: time.Now()})
+	return v.(*breaker)
+}
+
+//isBreakerFailure는 circuit 판단에 쓰는 실패인지 확인한다. 업무 에러는 세지 않는다.
+func isBreakerFailure(code int) bool {
+	switch code {
+	case NErrorTimeout, NErrorNotFound, NErrorServerBusy, NErrorAppStopping:
+		return true
+	}
+
+	return false
+}
+
+//breakerConfig는 설정에서 빠졌거나 잘못된 값을 기본값으로 채운다.
+//WindowSec이 0이면 매번 구간이 새로 시작되고, FailureRate가 0이면 성공만으로도 열리기 때문이다.
+func breakerConfig() (windowSec uint32, minRequests int, failureRate float64, openSec uint32) {
+	cfg := app.Config.Global.Breaker
+
+	windowSec, minRequests, failureRate, openSec = cfg.WindowSec, cfg.MinRequests, cfg.FailureRate, cfg.OpenSec
+	if windowSec == 0 {
+		windowSec = BreakerWindowSec
+	}
+
+	if failureRate <= 0 || failureRate > 1 {
+		failureRate = DefaultBreakerFailureRate
+	}
+
+	if openSec == 0 {
+		openSec = BreakerOpenSec
+	}
+
+	return
+}
+
+//Allow는 request를 보내도 되는지 확인한다. half-open 상태에서는 한개만 허용하고 probe로 돌려준다.
+//probe의 결과만 half-open 상태를 바꿀 수 있다.
+func (b *breaker) Allow(now time.Time) (ok bool, probe bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.openUntil) {
+			return false, false
+		}
+		b.state = breakerHalfOpen
+		return true, true
+
+	case breakerHalfOpen:
+		return false, false
+	}
+
+	return true, false
+}
+
+//Record는 request의 결과를 남긴다. circuit이 열린 뒤에 돌아온 결과는 열리기 전에 보낸 것이므로 세지 않는다.
+func (b *breaker) Record(now time.Time, failed bool, probe bool) {
+	windowSec, minRequests, failureRate, openSec := breakerConfig()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerHalfOpen:
+		if !probe {
+			return
+		}
+
+		if failed {
+			b.open(now, openSec)
+		} else {
+			b.state = breakerClosed
+			b.windowStart, b.total, b.fails = now, 0, 0
+		}
+		return
+
+	case breakerOpen:
+		return
+	}
+
+	if uint32(now.Sub(b.windowStart).Seconds()) >= windowSec {
+		b.windowStart, b.total, b.fails = now, 0, 0
+	}
+
+	b.total++
+	if failed {
+		b.fails++
+	}
+
+	if b.total >= minRequests && float64(b.fails)/float64(b.total) >= failureRate {
+		b.open(now, openSec)
+	}
+}
+
+//Skip은 결과를 알 수 없는 request(cancel등)를 세지 않는다.
+//probe였으면 다음 request가 다시 probe가 되도록 half-open을 푼다.
+func (b *breaker) Skip(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *breaker) open(now time.Time, openSec uint32) {
+	b.state = breakerOpen
+	b.openUntil = now.Add(time.Duration(openSec) * time.Second)
+	b.windowStart, b.total, b.fails = now, 0, 0
+	app.ErrorLog("%s circuit open until %s", b.key, b.openUntil.Format(time.RFC3339))
+}
+
+//SetRetryPolicy는 spn의 api가 실패했을때 다시 시도하도록 한다.
+func (cli *client) SetRetryPolicy(spn string, api string, policy RetryPolicy) {
+	cli.rsl.retries.Store(resilienceKey(spn, api), policy)
+}
+
+//sendReqResilient는 circuit을 확인하고 retry policy에 따라 sendReq를 다시 시도한다.
+//특정 eid로 보내는 request는 한 대상의 실패이므로 circuit을 적용하지 않는다.
+func (cli *client) sendReqResilient(ctx context.Context, header ReqHeader, body interface{}) (*ResponseMsg, error) {
+	if key, ok := IdempotencyKeyFromContext(ctx); ok {
+		header.IdempotencyKey = key
+	}
+
+	if len(header.ToEid) > 0 {
+		return cli.sendReq(ctx, header, body)
+	}
+
+	var policy RetryPolicy
+	if v, ok := cli.rsl.retries.Load(resilienceKey(header.Spn, header.Api)); ok {
+		policy = v.(RetryPolicy)
+	}
+
+	//다시 보낸 request가 중복 처리되지 않도록 key를 붙인다.
+	if policy.MaxRetries > 0 && len(header.IdempotencyKey) == 0 {
+		header.IdempotencyKey = GenerateGuid().String()
+	}
+
+	var b *breaker
+	if app.Config.Global.Breaker.MinRequests > 0 {
+		b = cli.rsl.breaker(header.Spn, header.Api)
+	}
+
+	for i := 0; ; i++ {
+		var probe bool
+		if b != nil {
+			var ok bool
+			if ok, probe = b.Allow(time.Now()); !ok {
+				neterr := CoRaiseNError(NErrorCircuitOpen, 1, fmt.Sprintf("%s.%s circuit open", header.Spn, header.Api))
+				res := &ResponseMsg{}
+				res.Header.SetError(neterr)
+				return res, neterr
+			}
+		}
+
+		res, err := cli.sendReq(ctx, header, body)
+
+		code := NErrorSucess
+		known := true //cancel되었거나 NError가 아닌 에러는 대상의 상태를 알려주지 않는다.
+		if nerr, ok := err.(NError); ok {
+			code = nerr.Code()
+			known = code != NErrorCanceled
+		} else if err != nil {
+			known = false
+		} else if res != nil {
+			code = res.Header.ErrCode
+		}
+
+		if err != nil && ctx.Err() != nil {
+			known = false
+		}
+
+		failed := isBreakerFailure(code)
+		if b != nil {
+			if known {
+				b.Record(time.Now(), failed, probe)
+			} else {
+				b.Skip(probe)
+			}
+		}
+
+		if !failed || i >= policy.MaxRetries || ctx.Err() != nil {
+			return res, err
+		}
+
+		select {
+		case <-time.After(retryDelay(policy, i)):
+		case <-ctx.Done():
+			return res, err
+		}
+	}
+}
+
+//retryDelay는 BaseDelay * 2^i 를 MaxDelay로 자르고, 그 절반에서 전체 사이의 jitter를 준다.
+func retryDelay(policy RetryPolicy, i int) time.Duration {
+	d := policy.BaseDelay << uint(i)
+	if policy.MaxDelay > 0 && (d > policy.MaxDelay || d <= 0) {
+		d = policy.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
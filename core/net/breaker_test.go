@@ -0,0 +1,260 @@
+package net
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	const (
+		allow  = "allow"
+		ok     = "ok"
+		failed = "failed"
+		late   = "late"   //circuit이 열리기 전에 보낸 request의 성공
+		cancel = "cancel" //probe가 cancel되었다.
+	)
+
+	type step struct {
+		at    time.Duration //시작 시간으로부터
+		op    string
+		allow bool //op가 allow일때 기대값
+		state int  //step 뒤의 상태
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed under min requests",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, allow, true, breakerClosed},
+			},
+		},
+		{
+			name: "opens at failure rate",
+			steps: []step{
+				{0, ok, false, breakerClosed},
+				{0, ok, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{time.Second, allow, false, breakerOpen},
+			},
+		},
+		{
+			name: "below failure rate stays closed",
+			steps: []step{
+				{0, ok, false, breakerClosed},
+				{0, ok, false, breakerClosed},
+				{0, ok, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, allow, true, breakerClosed},
+			},
+		},
+		{
+			name: "window resets counts",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{11 * time.Second, failed, false, breakerClosed},
+				{11 * time.Second, allow, true, breakerClosed},
+			},
+		},
+		{
+			name: "half-open lets one request through",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, allow, false, breakerHalfOpen},
+			},
+		},
+		{
+			name: "half-open success closes",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, ok, false, breakerClosed},
+				{5 * time.Second, allow, true, breakerClosed},
+			},
+		},
+		{
+			name: "half-open failure reopens",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, failed, false, breakerOpen},
+				{9 * time.Second, allow, false, breakerOpen},
+				{10 * time.Second, allow, true, breakerHalfOpen},
+			},
+		},
+		{
+			name: "late success does not close half-open",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{time.Second, late, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, late, false, breakerHalfOpen},
+				{5 * time.Second, failed, false, breakerOpen},
+			},
+		},
+		{
+			name: "canceled probe lets next request probe",
+			steps: []step{
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerClosed},
+				{0, failed, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, cancel, false, breakerOpen},
+				{5 * time.Second, allow, true, breakerHalfOpen},
+				{5 * time.Second, ok, false, breakerClosed},
+			},
+		},
+	}
+
+	saved := app.Config.Global.Breaker
+	defer func() { app.Config.Global.Breaker = saved }()
+
+	app.Config.Global.Breaker.WindowSec = 10
+	app.Config.Global.Breaker.MinRequests = 4
+	app.Config.Global.Breaker.FailureRate = 0.5
+	app.Config.Global.Breaker.OpenSec = 5
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			b := &breaker{key: "spn/api", lock: new(sync.Mutex), windowStart: start}
+
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				switch s.op {
+				case allow:
+					if got, _ := b.Allow(now); got != s.allow {
+						t.Fatalf("step %d Allow = %v, want %v", i, got, s.allow)
+					}
+				case late:
+					b.Record(now, false, false)
+				case cancel:
+					b.Skip(true)
+				default:
+					b.Record(now, s.op == failed, true)
+				}
+
+				if b.state != s.state {
+					t.Fatalf("step %d state = %d, want %d", i, b.state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{NErrorSucess, false},
+		{NErrorTimeout, true},
+		{NErrorNotFound, true},
+		{NErrorServerBusy, true},
+		{NErrorAppStopping, true},
+		{NErrorCircuitOpen, false},
+		{NErrorNotImplemented, false},
+	}
+
+	for _, tt := range tests {
+		if got := isBreakerFailure(tt.code); got != tt.want {
+			t.Errorf("isBreakerFailure(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		i      int
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"first", DefaultRetryPolicy, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles", DefaultRetryPolicy, 2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", DefaultRetryPolicy, 5, 500 * time.Millisecond, time.Second},
+		{"overflow capped", DefaultRetryPolicy, 70, 500 * time.Millisecond, time.Second},
+		{"no delay", RetryPolicy{MaxRetries: 1}, 3, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for n := 0; n < 100; n++ {
+				if d := retryDelay(tt.policy, tt.i); d < tt.min || d > tt.max {
+					t.Fatalf("retryDelay = %v, want %v-%v", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+//WindowSec, FailureRate, OpenSec이 빠지면 기본값을 쓴다.
+func TestBreakerConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		windowSec   uint32
+		failureRate float64
+		openSec     uint32
+		wantWindow  uint32
+		wantRate    float64
+		wantOpen    uint32
+	}{
+		{name: "configured", windowSec: 20, failureRate: 0.3, openSec: 7, wantWindow: 20, wantRate: 0.3, wantOpen: 7},
+		{name: "missing", wantWindow: BreakerWindowSec, wantRate: DefaultBreakerFailureRate, wantOpen: BreakerOpenSec},
+		{name: "rate over 1", windowSec: 20, failureRate: 2, openSec: 7, wantWindow: 20, wantRate: DefaultBreakerFailureRate, wantOpen: 7},
+	}
+
+	saved := app.Config.Global.Breaker
+	defer func() { app.Config.Global.Breaker = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Global.Breaker.WindowSec = tt.windowSec
+			app.Config.Global.Breaker.MinRequests = 2
+			app.Config.Global.Breaker.FailureRate = tt.failureRate
+			app.Config.Global.Breaker.OpenSec = tt.openSec
+
+			windowSec, _, failureRate, openSec := breakerConfig()
+			if windowSec != tt.wantWindow || failureRate != tt.wantRate || openSec != tt.wantOpen {
+				t.Fatalf("config %d %v %d, want %d %v %d", windowSec, failureRate, openSec, tt.wantWindow, tt.wantRate, tt.wantOpen)
+			}
+
+			start := time.Now()
+			b := &breaker{key: "spn/api", lock: new(sync.Mutex), windowStart: start}
+			for i := 0; i < 4; i++ {
+				b.Record(start, false, false)
+			}
+
+			if b.state != breakerClosed || b.total != 4 {
+				t.Fatalf("state %d total %d after successes", b.state, b.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+/********************************************************************************
+* cancel.go
+* caller가 timeout이나 ctx cancel로 포기한 request를 provider에게 알린다.
+* gate와 router는 stub이나 router 연결로 보낸 request의 경로를 TxnNo, FromEids로 기억해두고
+* cancel 메세지를 같은 경로로만 보낸다. 경로를 모르는 노드는 request가 지나가지 않았거나
+* 이미 응답한 것이므로 버린다. caller가 모든 gate로 보낸 cancel은 request가 지나간 gate만 전달한다.
+* provider는 아직 처리하지 않은 request를 버리고, 처리중인 handler의
+* req.Context()를 Done으로 만든다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+//cancelTarget은 request를 보낸 곳이다. stub이거나 proxy가 고른 router 연결이다.
+type cancelTarget interface {
+	Send(mpck MsgPack) error
+	String() string
+}
+
+type cancelRoute struct {
+	targets []cancelTarget
+	stamp   time.Time
+}
+
+type cancelRouteTable struct {
+	lock   *sync.Mutex
+	routes map[string]*cancelRoute
+}
+
+var cancelRoutes *cancelRouteTable
+var cancelRoutesOnce sync.Once
+
+func getCancelRoutes() *cancelRouteTable {
+	cancelRoutesOnce.Do(func() {
+		cancelRoutes = &cancelRouteTable{lock: new(sync.Mutex), routes: make(map[string]*cancelRoute)}
+		go goCancelRouteClean(cancelRoutes)
+	})
+
+	return cancelRoutes
+}
+
+//cancelRouteKey는 노드에서 request를 구분하는 key이다.
+//같은 노드에 도착한 request와 cancel은 같은 FromEids를 가진다.
+func cancelRouteKey(fromEids []string, txnNo uint64) string {
+	return fmt.Sprintf("%s#%d", strings.Join(fromEids, ","), txnNo)
+}
+
+//recordCancelRoute는 request를 target으로 보냈음을 기억한다. fanout이면 여러 target이 된다.
+func recordCancelRoute(fromEids []string, txnNo uint64, target cancelTarget) {
+	t := getCancelRoutes()
+	key := cancelRouteKey(fromEids, txnNo)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if r, ok := t.routes[key]; ok {
+		r.targets = append(r.targets, target)
+		return
+	}
+
+	t.routes[key] = &cancelRoute{targets: []cancelTarget{target}, stamp: time.Now()}
+}
+
+//forgetCancelRoute는 response가 지나가면 기억한 경로를 지운다.
+//response의 ToEids는 이 노드에서 보낸 request의 FromEids와 같다.
+func forgetCancelRoute(toEids []string, txnNo uint64) {
+	if txnNo == 0 {
+		return
+	}
+
+	t := getCancelRoutes()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.routes, cancelRouteKey(toEids, txnNo))
+}
+
+func goCancelRouteClean(t *cancelRouteTable) {
+	defer app.DumpRecover()
+
+	ticker := time.NewTicker(time.Second * UnsentTimerSec)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		t.lock.Lock()
+		for k, r := range t.routes {
+			if uint32(now.Sub(r.stamp).Seconds()) > TxnTimeoutSec {
+				delete(t.routes, k)
+			}
+		}
+		t.lock.Unlock()
+	}
+}
+
+//DeliverCancel은 cancel 메세지를 request가 지나간 stub이나 router 연결로 보낸다.
+func DeliverCancel(h *CancelHeader, mpck MsgPack) error {
+	t := getCancelRoutes()
+	key := cancelRouteKey(h.FromEids, h.TxnNo)
+
+	t.lock.Lock()
+	r, ok := t.routes[key]
+	delete(t.routes, key)
+	t.lock.Unlock()
+
+	if ok {
+		for _, target := range r.targets {
+			if err := target.Send(mpck); err != nil {
+				app.ErrorLog("trace[%s] cancel to %s, %s", h.TraceID, target.String(), err.Error())
+			}
+		}
+		return nil
+	}
+
+	//이미 응답했거나 이 노드를 지나지 않은 request이다.
+	app.DebugLog("trace[%s] cancel route not found txnNo[%d] %v", h.TraceID, h.TxnNo, h.FromEids)
+	return nil
+}
+
+//sendCancel은 caller가 포기한 request를 provider에게 알린다.
+//request가 어느 gate로 갔는지 모르므로 연결된 gate 모두에게 보낸다.
+func (cli *client) sendCancel(header ReqHeader, reason string) {
+	out, err := BuildMsgPack(CancelHeader{TxnNo: header.TxnNo, Reason: reason, TraceID: header.TraceID}, nil)
+	if err != nil {
+		app.ErrorLog("%s cancel build error %s", header.TraceTag(), err.Error())
+		return
+	}
+
+	cli.muxio.Broadcast(out.Bytes())
+}
+
+func (cli *client) OnCancel(header []byte, body []byte) error {
+	h := ParseCancelHeader(header)
+	if h == nil {
+		return IssueErrorf("Cancel parse error!, %s", string(header))
+	}
+
+	cli.reqQ.Cancel(h)
+	return nil
+}
+
+//isCanceled는 caller가 cancel 메세지로 포기한 request인지 확인한다.
+//handler가 끝나서 context를 정리한 것은 cancel이 아니므로 그 뒤에도 응답할 수 있다.
+func (msg *RequestMsg) isCanceled() bool {
+	return atomic.LoadInt32(&msg.canceled) == 1
+}
+
+//baseContext는 cancel 메세지를 받거나 header의 deadline이 지나면 Done이 되는 context이다.
+func (msg *RequestMsg) baseContext() context.Context {
+	if msg.ctx == nil {
+		msg.ctx, msg.cancel = msg.Header.newContext()
+	}
+
+	return msg.ctx
+}
+
+//newContext는 header의 deadline을 가진 context를 만든다. deadline이 없으면 cancel만 할 수 있다.
+func (header ReqHeader) newContext() (context.Context, context.CancelFunc) {
+	if header.Deadline > 0 {
+		return context.WithDeadline(context.Background(), time.Unix(0, header.Deadline))
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+//track은 cancel 메세지를 받을 수 있도록 처리중인 request로 등록한다.
+func (q *reqQ) track(msg *RequestMsg) {
+	if msg.Header.TxnNo == 0 {
+		return
+	}
+
+	msg.ctx, msg.cancel = msg.Header.newContext()
+
+	q.cancelLock.Lock()
+	defer q.cancelLock.Unlock()
+
+	q.inflight[cancelRouteKey(msg.Header.FromEids, msg.Header.TxnNo)] = msg
+}
+
+//untrack은 응답했거나 handler가 끝난 request를 지우고 context를 정리한다. 이후 req.Context()는 Done이 된다.
+//caller의 cancel과는 다르므로 handler가 끝난 뒤에도 응답할 수 있다.
+func (q *reqQ) untrack(msg *RequestMsg) {
+	if msg.cancel == nil {
+		return
+	}
+	defer msg.cancel()
+
+	key := cancelRouteKey(msg.Header.FromEids, msg.Header.TxnNo)
+
+	q.cancelLock.Lock()
+	defer q.cancelLock.Unlock()
+
+	if v, ok := q.inflight[key]; ok && v == msg {
+		delete(q.inflight, key)
+	}
+}
+
+//Cancel은 caller가 포기한 request의 context를 cancel한다.
+//같은 IdempotencyKey로 다시 보낸 request가 결과를 기다리고 있으면 cancel하지 않는다.
+func (q *reqQ) Cancel(h *CancelHeader) {
+	key := cancelRouteKey(h.FromEids, h.TxnNo)
+
+	q.cancelLock.Lock()
+	msg, ok := q.inflight[key]
+	if ok {
+		delete(q.inflight, key)
+	}
+	q.cancelLock.Unlock()
+
+	if !ok {
+		app.DebugLog("trace[%s] cancel txnNo[%d] not in progress", h.TraceID, h.TxnNo)
+		return
+	}
+
+	if q.idem.HasWaiters(msg) {
+		app.DebugLog("%s cancel ignored, retried request is waiting api[%s]", msg.Header.TraceTag(), msg.Header.Api)
+		return
+	}
+
+	app.DebugLog("%s canceled api[%s] key[%s] %s", msg.Header.TraceTag(), msg.Header.Api, msg.Header.Key, h.Reason)
+	atomic.StoreInt32(&msg.canceled, 1)
+	msg.cancel()
+}
+
+//dropCanceled는 cancel된 request를 응답없이 버린다. 버렸으면 true를 돌려준다.
+func (q *reqQ) dropCanceled(msg *RequestMsg) bool {
+	if !msg.isCanceled() {
+		return false
+	}
+
+	app.DebugLog("%s canceled request dropped api[%s] key[%s]", msg.Header.TraceTag(), msg.Header.Api, msg.Header.Key)
+	q.idem.Complete(msg, NErrorCanceled, "canceled", nil)
+	q.untrack(msg)
+	return true
+}
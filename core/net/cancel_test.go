@@ -0,0 +1,229 @@
+package net
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCancelTarget struct {
+	name string
+	sent int
+}
+
+func (c *testCancelTarget) Send(mpck MsgPack) error {
+	c.sent++
+	return nil
+}
+
+func (c *testCancelTarget) String() string {
+	return c.name
+}
+
+func TestCancelRouteKeys(t *testing.T) {
+	type record struct {
+		fromEids []string
+		txnNo    uint64
+		target   int
+	}
+
+	tests := []struct {
+		name    string
+		records []record
+		forget  []string //response의 ToEids, nil이면 지우지 않는다.
+		cancels int      //같은 cancel을 보내는 횟수
+		from    []string
+		txnNo   uint64
+		sent    []int //target별 받은 cancel 수
+	}{
+		{
+			name:    "recorded route",
+			records: []record{{[]string{"c"}, 1, 0}},
+			cancels: 1, from: []string{"c"}, txnNo: 1,
+			sent: []int{1, 0},
+		},
+		{
+			name:    "fanout to every target",
+			records: []record{{[]string{"c"}, 1, 0}, {[]string{"c"}, 1, 1}},
+			cancels: 1, from: []string{"c"}, txnNo: 1,
+			sent: []int{1, 1},
+		},
+		{
+			name:    "other txnNo",
+			records: []record{{[]string{"c"}, 1, 0}},
+			cancels: 1, from: []string{"c"}, txnNo: 2,
+			sent: []int{0, 0},
+		},
+		{
+			name:    "same txnNo from another caller",
+			records: []record{{[]string{"c1"}, 1, 0}, {[]string{"c2"}, 1, 1}},
+			cancels: 1, from: []string{"c2"}, txnNo: 1,
+			sent: []int{0, 1},
+		},
+		{
+			name:    "hop eids are part of the key",
+			records: []record{{[]string{"c"}, 1, 0}, {[]string{"c", "g1"}, 1, 1}},
+			cancels: 1, from: []string{"c", "g1"}, txnNo: 1,
+			sent: []int{0, 1},
+		},
+		{
+			name:    "forgotten by response",
+			records: []record{{[]string{"c", "g1"}, 1, 0}},
+			forget:  []string{"c", "g1"},
+			cancels: 1, from: []string{"c", "g1"}, txnNo: 1,
+			sent: []int{0, 0},
+		},
+		{
+			name:    "delivered once",
+			records: []record{{[]string{"c"}, 1, 0}},
+			cancels: 2, from: []string{"c"}, txnNo: 1,
+			sent: []int{1, 0},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//경로 table은 하나이므로 case마다 다른 txnNo를 쓴다.
+			base := uint64(i+1) * 1000
+			targets := []*testCancelTarget{{name: "t0"}, {name: "t1"}}
+
+			for _, r := range tt.records {
+				recordCancelRoute(r.fromEids, base+r.txnNo, targets[r.target])
+			}
+
+			if tt.forget != nil {
+				forgetCancelRoute(tt.forget, base+tt.txnNo)
+			}
+
+			for n := 0; n < tt.cancels; n++ {
+				h := &CancelHeader{FromEids: tt.from, TxnNo: base + tt.txnNo}
+				mpck, err := BuildMsgPack(*h, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := DeliverCancel(h, mpck); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for j, target := range targets {
+				if target.sent != tt.sent[j] {
+					t.Errorf("%s sent %d, want %d", target.name, target.sent, tt.sent[j])
+				}
+			}
+		})
+	}
+}
+
+//proxy로 router에 보낸 request의 cancel은 request를 보낸 router 연결로만 간다.
+func TestProxyRecordsCancelRoute(t *testing.T) {
+	const routers = 3
+
+	muxio, rws := newTestMuxIO(routers)
+	prx := &proxy{muxio: muxio, lock: new(sync.RWMutex)}
+
+	for txnNo := uint64(50001); txnNo <= 50020; txnNo++ {
+		before := make([]int, routers)
+		for i, rw := range rws {
+			before[i] = len(rw.msgTypes(t))
+		}
+
+		req, err := BuildMsgPack(ReqHeader{Api: "A", TxnNo: txnNo, FromEids: []string{"c"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := prx.Send(req); err != nil {
+			t.Fatal(err)
+		}
+
+		h := &CancelHeader{FromEids: []string{"c"}, TxnNo: txnNo}
+		cancel, err := BuildMsgPack(*h, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := DeliverCancel(h, cancel); err != nil {
+			t.Fatal(err)
+		}
+
+		used := 0
+		for i, rw := range rws {
+			got := rw.msgTypes(t)[before[i]:]
+			if len(got) == 0 {
+				continue
+			}
+
+			used++
+			if len(got) != 2 || got[0] != MsgTypeRequest || got[1] != MsgTypeCancel {
+				t.Fatalf("txn %d router %d got %q, want request then cancel", txnNo, i, got)
+			}
+		}
+
+		if used != 1 {
+			t.Fatalf("txn %d sent to %d routers, want 1", txnNo, used)
+		}
+	}
+}
+
+//handler가 끝난 뒤에도 저장해둔 request로 응답할 수 있다. caller가 cancel한 request의 응답만 버린다.
+func TestReplyAfterHandlerReturn(t *testing.T) {
+	tests := []struct {
+		name     string
+		cancel   bool //handler가 처리하는 중에 caller가 cancel한다.
+		withErr  bool
+		wantSent int
+	}{
+		{name: "reply after return", wantSent: 1},
+		{name: "error reply after return", withErr: true, wantSent: 1},
+		{name: "canceled by caller", cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, sentQ := newTestMuxClient()
+
+			reqC := make(chan *RequestMsg, 1)
+			release := make(chan struct{})
+			cli.RegisterRandHandler("Later", func(cli Client, req *RequestMsg) {
+				reqC <- req
+				<-release
+			})
+
+			h := ReqHeader{Api: "Later", TxnNo: 1, FromEids: []string{"c"}}
+			mpck, err := BuildMsgPack(h, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cli.reqQ.Dispatch(mpck.Header(), mpck.Body()); err != nil {
+				t.Fatal(err)
+			}
+
+			req := <-reqC
+			if tt.cancel {
+				cli.reqQ.Cancel(&CancelHeader{FromEids: h.FromEids, TxnNo: h.TxnNo})
+			}
+			close(release)
+
+			//handler가 끝나면 context를 정리한다.
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+				t.Fatal("context is not released after handler return")
+			}
+
+			//연결된 io가 없으므로 보낸 응답은 error와 함께 sentQ에 쌓인다.
+			if tt.withErr {
+				cli.SendResWithError(req, CoRaiseNError(NErrorInternal, 1, "later"), nil)
+			} else {
+				cli.SendRes(req, nil)
+			}
+
+			if sentQ.Len() != tt.wantSent {
+				t.Fatalf("sent %d, want %d", sentQ.Len(), tt.wantSent)
+			}
+		})
+	}
+}
@@ -8,7 +8,11 @@
 package net
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"sync/atomic"
+	"time"
 
 	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
@@ -20,6 +24,7 @@ type client struct {
 	lastTxnNo uint64
 	reqQ      *reqQ
 	resQ      *resQ
+	rsl       *resilience
 
 	//gateSpn   string
 	toplgy Topology
@@ -29,7 +34,8 @@ func NewClient(eid string) Client {
 	cli := &client{}
 	cli.reqQ = newReqQ(cli)
 	cli.resQ = newResQ(cli, TxnTimeoutSec)
-	cli.muxio = newMultiplexerIO(eid, app.Config.MyGateGroup.Gates, &cli.toplgy, cli)
+	cli.rsl = newResilience()
+	cli.muxio = newMultiplexerIO(eid, app.Config.MyGateGroup.Gates, func() Topology { return cli.toplgy }, cli)
 
 	go goRoundTripTimeout(cli.resQ)
 	return cli
@@ -47,6 +53,32 @@ func (cli *client) RegisterRandHandler(api string, handler func(cli Client, msg
 	cli.reqQ.RegisterRandHandler(api, handler)
 }
 
+func (cli *client) RegisterGridHandlerR(api string, handler func(cli Client, msg *RequestMsg, gridData interface{}) (interface{}, interface{}, NError)) {
+	cli.reqQ.RegisterGridHandlerR(api, handler)
+}
+
+func (cli *client) RegisterRandHandlerR(api string, handler func(cli Client, msg *RequestMsg) (interface{}, NError)) {
+	cli.reqQ.RegisterRandHandlerR(api, handler)
+}
+
+func (cli *client) setGridConstructor(t reflect.Type, ctor func(key string) interface{}) {
+	cli.reqQ.gridCtors[t] = ctor
+}
+
+func (cli *client) newGridData(t reflect.Type, key string) interface{} {
+	ctor, ok := cli.reqQ.gridCtors[t]
+	if !ok {
+		return nil
+	}
+
+	return ctor(key)
+}
+
+//Use는 모든 handler 호출을 감싸는 interceptor를 추가한다. Dial하기 전에 등록해야 한다.
+func (cli *client) Use(ic Interceptor) {
+	cli.reqQ.Use(ic)
+}
+
 func (cli client) ListGridApis() []string {
 	return cli.reqQ.ListGridApis()
 }
@@ -55,7 +87,31 @@ func (cli client) ListRandApis() []string {
 	return cli.reqQ.ListRandApis()
 }
 
+func (cli client) ListTopics() []string {
+	return cli.reqQ.ListTopics()
+}
+
+//Subscribe는 topic에 publish된 메세지를 받을 handler를 등록한다. Dial하기 전에 등록해야 한다.
+func (cli *client) Subscribe(topic string, handler func(cli Client, msg *RequestMsg)) {
+	cli.reqQ.Subscribe(topic, handler)
+}
+
+//Dial시 Subscribe한 topic들은 topology에 포함되어 gate에 전달된다.
 func (cli *client) Dial(toplgy Topology) error {
+	for _, topic := range cli.ListTopics() {
+		found := false
+		for _, v := range toplgy.Topics {
+			if v == topic {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			toplgy.Topics = append(toplgy.Topics, topic)
+		}
+	}
+
 	cli.toplgy = toplgy
 	go goDispatch(cli.muxio)
 
@@ -64,7 +120,36 @@ func (cli *client) Dial(toplgy Topology) error {
 	return nil
 }
 
+//SendReq는 새 trace를 시작한다. handler안에서 보내는 하위 request의 trace를 이으려면
+//cli.SendReqCtx(req.Context(), ...)를 사용한다.
 func (cli *client) SendReq(spn string, api string, body interface{}) (res *ResponseMsg, err error) {
+	return cli.SendReqCtx(context.Background(), spn, api, body)
+}
+
+func (cli *client) SendReqCtx(ctx context.Context, spn string, api string, body interface{}) (res *ResponseMsg, err error) {
+	return cli.sendReqResilient(ctx, ReqHeader{Spn: spn, Api: api}, body)
+}
+
+func (cli *client) SendReqDirect(spn string, gateEid string, eid string, api string, body interface{}) (res *ResponseMsg, err error) {
+	return cli.SendReqDirectCtx(context.Background(), spn, gateEid, eid, api, body)
+}
+
+func (cli *client) SendReqDirectCtx(ctx context.Context, spn string, gateEid string, eid string, api string, body interface{}) (res *ResponseMsg, err error) {
+	return cli.sendReqResilient(ctx, ReqHeader{Spn: spn, ToGateEid: gateEid, ToEid: eid, Api: api}, body)
+}
+
+func (cli *client) LoopbackReq(api string, body interface{}) (res *ResponseMsg, err error) {
+	return cli.LoopbackReqCtx(context.Background(), api, body)
+}
+
+func (cli *client) LoopbackReqCtx(ctx context.Context, api string, body interface{}) (res *ResponseMsg, err error) {
+	//header := ReqHeader{Spn: cli.gateSpn, ToEid: app.App.Eid, Api: api, TxnNo: txnNo}
+	return cli.sendReq(ctx, ReqHeader{ToEid: app.App.Eid, Api: api}, body)
+}
+
+//sendReq는 request를 보내고, response가 오거나 ctx가 끝날때까지 기다린다.
+//ctx가 먼저 끝나면 resQ에서 round trip을 지우고 NErrorTimeout/NErrorCanceled를 돌려준다.
+func (cli *client) sendReq(ctx context.Context, header ReqHeader, body interface{}) (res *ResponseMsg, err error) {
 	if app.IsStopping() {
 		neterr := CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
 		var res ResponseMsg
@@ -72,90 +157,108 @@ func (cli *client) SendReq(spn string, api string, body interface{}) (res *Respo
 		return &res, neterr
 	}
 
+	if ctx.Err() != nil {
+		neterr := ctxNError(ctx)
+		var res ResponseMsg
+		res.Header.SetError(neterr)
+		return &res, neterr
+	}
+
 	txnNo := cli.newTxnNo()
+	header.TxnNo = txnNo
+	header.newChildSpan(ctx)
+
+	if dl, ok := ctx.Deadline(); ok {
+		header.SetDeadline(dl)
+	} else {
+		header.SetDeadline(time.Now().Add(time.Second * TxnTimeoutSec))
+	}
 
-	header := ReqHeader{Spn: spn, Api: api, TxnNo: txnNo}
 	out, neterr := BuildMsgPack(header, body)
 	if neterr != nil {
 		return nil, neterr
 	}
 
+	start := time.Now()
 	req := &RequestMsg{Header: header, Body: out.Body()}
-	resC := make(chan *ResponseMsg)
+	//resQ가 block되지 않도록 buffer를 하나 둔다.
+	resC := make(chan *ResponseMsg, 1)
 	cli.resQ.Push(txnNo, req, resC)
 
-	cli.muxio.Write(out.Bytes(), true)
+	cli.muxio.WriteMsgPack(out, true)
 
-	res = <-resC
+	select {
+	case res = <-resC:
+		recordSpan(SpanKindClient, header, start, res.Header.ErrCode)
+		return res, nil
 
-	return res, nil
-}
+	case <-ctx.Done():
+		if rt := cli.resQ.Cancel(txnNo); rt == nil {
+			//이미 response가 도착한 상태이다.
+			return <-resC, nil
+		}
 
-func (cli *client) SendReqDirect(spn string, gateEid string, eid string, api string, body interface{}) (res *ResponseMsg, err error) {
-	if app.IsStopping() {
-		neterr := CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
-		var res ResponseMsg
+		neterr := ctxNError(ctx)
+		cli.sendCancel(header, neterr.Error())
+		res = &ResponseMsg{Header: ResHeader{TxnNo: txnNo}}
 		res.Header.SetError(neterr)
-		return &res, neterr
+		recordSpan(SpanKindClient, header, start, neterr.Code())
+		return res, neterr
 	}
+}
 
-	txnNo := cli.newTxnNo()
-
-	header := ReqHeader{Spn: spn, ToGateEid: gateEid, ToEid: eid, Api: api, TxnNo: txnNo}
-	out, neterr := BuildMsgPack(header, body)
-	if neterr != nil {
-		return nil, neterr
+func ctxNError(ctx context.Context) NError {
+	if ctx.Err() == context.DeadlineExceeded {
+		return CoRaiseNError(NErrorTimeout, 3, "deadline exceeded")
 	}
 
-	req := &RequestMsg{Header: header, Body: out.Body()}
-	resC := make(chan *ResponseMsg)
-	cli.resQ.Push(txnNo, req, resC)
-	cli.muxio.Write(out.Bytes(), true)
-
-	res = <-resC
-	return res, nil
+	return CoRaiseNError(NErrorCanceled, 3, "canceled")
 }
 
-func (cli *client) LoopbackReq(api string, body interface{}) (res *ResponseMsg, err error) {
+func (cli *client) SendNoti(spn string, api string, body interface{}) (err error) {
 	if app.IsStopping() {
-		neterr := CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
-		var res ResponseMsg
-		res.Header.SetError(neterr)
-		return &res, neterr
+		return CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
 	}
 
-	txnNo := cli.newTxnNo()
-
-	//header := ReqHeader{Spn: cli.gateSpn, ToEid: app.App.Eid, Api: api, TxnNo: txnNo}
-	header := ReqHeader{ToEid: app.App.Eid, Api: api, TxnNo: txnNo}
+	header := ReqHeader{Spn: spn, Api: api}
 	out, neterr := BuildMsgPack(header, body)
 	if neterr != nil {
-		return nil, neterr
+		return neterr
 	}
 
-	req := &RequestMsg{Header: header, Body: out.Body()}
-	resC := make(chan *ResponseMsg)
-	cli.resQ.Push(txnNo, req, resC)
+	return cli.muxio.WriteMsgPack(out, true)
+}
 
-	cli.muxio.Write(out.Bytes(), true)
+//Broadcast는 spn의 모든 provider에게 noti를 보낸다. sgate에서 provider 수만큼 복제된다.
+func (cli *client) Broadcast(spn string, api string, body interface{}) (err error) {
+	if app.IsStopping() {
+		return CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
+	}
 
-	res = <-resC
+	header := ReqHeader{Spn: spn, Api: api, Fanout: true}
+	out, neterr := BuildMsgPack(header, body)
+	if neterr != nil {
+		return neterr
+	}
 
-	return res, nil
+	return cli.muxio.WriteMsgPack(out, true)
 }
 
-func (cli *client) SendNoti(spn string, api string, body interface{}) (err error) {
+//Publish는 topic을 구독하는 모든 provider에게 메세지를 보낸다. 응답은 없다.
+func (cli *client) Publish(topic string, body interface{}) (err error) {
 	if app.IsStopping() {
 		return CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
 	}
 
-	header := ReqHeader{Spn: spn, Api: api}
+	//router가 구독하는 gate 모두에게 보내므로, 여러 gate를 거쳐 온 같은 메세지는 IdempotencyKey로 한번만 처리한다.
+	header := ReqHeader{Topic: topic, Api: topic, IdempotencyKey: NewSpanID()}
+	header.newChildSpan(context.Background())
 	out, neterr := BuildMsgPack(header, body)
 	if neterr != nil {
 		return neterr
 	}
 
-	return cli.muxio.Write(out.Bytes(), true)
+	return cli.muxio.WriteMsgPack(out, true)
 }
 
 func (cli *client) SendNotiDirect(spn string, gateEid string, eid string, api string, body interface{}) (err error) {
@@ -169,7 +272,7 @@ func (cli *client) SendNotiDirect(spn string, gateEid string, eid string, api st
 		return neterr
 	}
 
-	return cli.muxio.Write(out.Bytes(), true)
+	return cli.muxio.WriteMsgPack(out, true)
 }
 
 func (cli *client) LoopbackNoti(api string, body interface{}) (err error) {
@@ -183,11 +286,19 @@ func (cli *client) LoopbackNoti(api string, body interface{}) (err error) {
 		return neterr
 	}
 
-	return cli.muxio.Write(out.Bytes(), true)
+	return cli.muxio.WriteMsgPack(out, true)
 }
 
 func (cli *client) SendRes(req *RequestMsg, body interface{}) (err error) {
-	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo, ErrCode: NErrorSucess}
+	if err := checkDoubleReply(req); err != nil {
+		return err
+	}
+
+	if cli.reqQ.dropCanceled(req) { //caller가 이미 포기했다.
+		return nil
+	}
+
+	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo, ErrCode: NErrorSucess, TraceID: req.Header.TraceID}
 	out, e := BuildMsgPack(header, body)
 
 	if e != nil {
@@ -199,11 +310,22 @@ func (cli *client) SendRes(req *RequestMsg, body interface{}) (err error) {
 		}
 	}
 
-	return cli.muxio.Write(out.Bytes(), true)
+	req.setReplyCode(header.ErrCode)
+	cli.reqQ.idem.Complete(req, header.ErrCode, header.ErrText, out.Body())
+	cli.reqQ.untrack(req)
+	return cli.writeRes(req, out)
 }
 
 func (cli *client) SendResWithError(req *RequestMsg, nerr NError, body interface{}) (err error) {
-	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo}
+	if err := checkDoubleReply(req); err != nil {
+		return err
+	}
+
+	if cli.reqQ.dropCanceled(req) {
+		return nil
+	}
+
+	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo, TraceID: req.Header.TraceID}
 	header.SetError(nerr)
 
 	out, e := BuildMsgPack(header, body)
@@ -217,7 +339,22 @@ func (cli *client) SendResWithError(req *RequestMsg, nerr NError, body interface
 		}
 	}
 
-	return cli.muxio.Write(out.Bytes(), true)
+	req.setReplyCode(header.ErrCode)
+	cli.reqQ.idem.Complete(req, header.ErrCode, header.ErrText, out.Body())
+	cli.reqQ.untrack(req)
+	return cli.writeRes(req, out)
+}
+
+//checkDoubleReply는 같은 request에 두번 응답하는 handler의 버그를 stack과 함께 남긴다.
+func checkDoubleReply(req *RequestMsg) error {
+	if req.markReplied() {
+		return nil
+	}
+
+	app.Dump(fmt.Sprintf("%s double reply api[%s] key[%s] txnNo[%d]",
+		req.Header.TraceTag(), req.Header.Api, req.Header.Key, req.Header.TxnNo))
+	app.ErrorLog("%s double reply api[%s] key[%s] txnNo[%d]", req.Header.TraceTag(), req.Header.Api, req.Header.Key, req.Header.TxnNo)
+	return IssueErrorf("double reply api[%s] txnNo[%d]", req.Header.Api, req.Header.TxnNo)
 }
 
 func (cli *client) newTxnNo() uint64 {
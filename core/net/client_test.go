@@ -0,0 +1,134 @@
+package net
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//SendReqCtx는 ctx가 끝나면 response를 기다리지 않고 NErrorCanceled/NErrorTimeout을 돌려주고 cancel을 보낸다.
+func TestSendReqCtx(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		respond bool   //provider가 바로 응답한다.
+		code    int    //돌려받은 에러 코드
+		sent    []byte //보낸 frame의 type
+	}{
+		{
+			name: "canceled before send",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			code: NErrorCanceled,
+		},
+		{
+			name: "deadline before send",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			},
+			code: NErrorTimeout,
+		},
+		{
+			name: "canceled while waiting",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			code: NErrorCanceled,
+			sent: []byte{MsgTypeRequest, MsgTypeCancel},
+		},
+		{
+			name: "deadline while waiting",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			code: NErrorTimeout,
+			sent: []byte{MsgTypeRequest, MsgTypeCancel},
+		},
+		{
+			name: "response before deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			respond: true,
+			code:    NErrorSucess,
+			sent:    []byte{MsgTypeRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxio, rws := newTestMuxIO(1)
+			cli := newTestClient()
+			cli.muxio = muxio
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			if tt.respond {
+				go func() {
+					mpck, err := ParseMsgPack(firstFrame(rws[0]))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+
+					res, _ := BuildMsgPack(ResHeader{TxnNo: ParseReqHeader(mpck.Header()).TxnNo}, nil)
+					cli.resQ.Dispatch(res.Header(), res.Body())
+				}()
+			}
+
+			res, err := cli.SendReqCtx(ctx, "spn", "A", nil)
+
+			code := NErrorSucess
+			if nerr, ok := err.(NError); ok {
+				code = nerr.Code()
+			}
+			if code != tt.code || res == nil || res.Header.ErrCode != tt.code {
+				t.Fatalf("err %v res %+v, want code %d", err, res, tt.code)
+			}
+
+			if sent := rws[0].msgTypes(t); !reflect.DeepEqual(sent, tt.sent) {
+				t.Fatalf("sent %v, want %v", sent, tt.sent)
+			}
+
+			if n := cli.resQ.NumProcess(); n != 0 {
+				t.Fatalf("%d round trips left", n)
+			}
+
+			if len(tt.sent) == 0 {
+				return
+			}
+
+			//ctx의 deadline이 request header에 실린다.
+			mpck, err := ParseMsgPack(firstFrame(rws[0]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := ParseReqHeader(mpck.Header())
+			if dl, ok := ctx.Deadline(); ok && header.Deadline != dl.UnixNano() {
+				t.Fatalf("header deadline %d, want %d", header.Deadline, dl.UnixNano())
+			}
+		})
+	}
+}
+
+//firstFrame은 처음 보낸 frame이 올때까지 기다린다.
+func firstFrame(rw *testNetIO) []byte {
+	for {
+		rw.lock.Lock()
+		if len(rw.frames) > 0 {
+			b := rw.frames[0]
+			rw.lock.Unlock()
+			return b
+		}
+		rw.lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,215 @@
+/********************************************************************************
+* codec.go
+* 연결(link)마다 header와 body를 부호화하는 codec.
+* 프로세스 안에서는 언제나 JSON을 쓰고, conn의 Write/Read에서 codec으로 바꾼다.
+* codec은 ConnectMsg의 Codecs와 AcceptMsg의 Codec으로 접속할때 정한다.
+* Codecs를 보내지 않는 tcgate client는 JSON을 그대로 쓴다.
+* 압축(compress.go)은 codec으로 바꾼 다음에 한다.
+*
+* msgpack은 bytes를 줄이지만 CPU를 더 쓴다. 보낼때 JSON을 interface{}로 풀어 msgpack으로,
+* 받을때 다시 JSON으로 바꾸므로 frame마다 JSON 한번씩을 더 parse, marshal 한다.
+* gate, router는 ResetHeader로 header를 JSON으로 다시 만들므로 hop마다 이 비용이 든다.
+* 그래서 기본 설정은 json이고, msgpack은 대역폭이 CPU보다 비싼 link에서만 Codecs에 넣는다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const (
+	CodecJSON    = "json"
+	CodecMsgPack = "msgpack"
+)
+
+//Codec은 JSON으로 된 header, body를 link에서 쓰는 형식으로 바꾼다.
+type Codec interface {
+	Name() string
+	Marshal(js []byte) ([]byte, error)
+	Unmarshal(b []byte) ([]byte, error)
+}
+
+//CodecIO는 codec을 바꿀 수 있는 NetIO이다.
+type CodecIO interface {
+	SetCodec(codec Codec)
+}
+
+var codecs = new(sync.Map)
+
+func init() {
+	RegisterCodec(msgPackCodec{})
+}
+
+//RegisterCodec은 codec을 등록한다. 같은 이름이면 교체된다.
+func RegisterCodec(codec Codec) {
+	codecs.Store(strings.ToLower(codec.Name()), codec)
+}
+
+//FindCodec은 이름으로 codec을 찾는다. json은 변환이 없으므로 nil을 돌려준다.
+func FindCodec(name string) (Codec, bool) {
+	name = strings.ToLower(name)
+	if len(name) == 0 || name == CodecJSON {
+		return nil, true
+	}
+
+	if v, ok := codecs.Load(name); ok {
+		return v.(Codec), true
+	}
+
+	return nil, false
+}
+
+//linkCodecs는 접속할때 상대에게 제안하는 codec 목록이다.
+func linkCodecs() []string {
+	if app.Config == nil {
+		return nil
+	}
+
+	var names []string
+	for _, name := range app.Config.Global.Codecs {
+		if _, ok := FindCodec(name); ok {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+
+	return names
+}
+
+//NegotiateCodec은 상대가 제안한 순서대로 자신도 사용하는 codec을 고른다.
+//맞는 것이 없으면 json이다.
+func NegotiateCodec(offered []string) string {
+	mine := linkCodecs()
+
+	for _, name := range offered {
+		name = strings.ToLower(name)
+		for _, m := range mine {
+			if name == m {
+				return name
+			}
+		}
+	}
+
+	return CodecJSON
+}
+
+//SetLinkCodec은 정해진 codec을 rw에 적용한다.
+func SetLinkCodec(rw NetIO, name string) error {
+	codec, ok := FindCodec(name)
+	if !ok {
+		return IssueErrorf("unknown codec %s", name)
+	}
+
+	if cio, ok := rw.(CodecIO); ok {
+		cio.SetCodec(codec)
+	} else if codec != nil {
+		return IssueErrorf("%s can not be used on this link", name)
+	}
+
+	return nil
+}
+
+//isCodecMsgType은 codec으로 바꾸는 메세지인지 확인한다. 접속과 ping은 언제나 JSON이다.
+func isCodecMsgType(msgType byte) bool {
+	return msgType == MsgTypeRequest || msgType == MsgTypeResponse || msgType == MsgTypeCancel
+}
+
+//needEncode는 codec이나 압축으로 바꿔야 하는 메세지인지 확인한다.
+func needEncode(codec Codec, compressAbove int, msgType byte, bodyLen int) bool {
+	return isCodecMsgType(msgType) && (codec != nil || (compressAbove > 0 && bodyLen > compressAbove))
+}
+
+//encodeFrames는 Bytes()로 만들어진 buffer를 codec으로 바꾸고, body가 compressAbove보다 크면 압축해서
+//다시 frame을 만든다. compressAbove가 0이면 압축하지 않는다.
+//unsentQ에서 다시 보내는 것처럼 buffer만 있을때 쓴다. MsgPack이 있으면 encodeMsgPack을 쓴다.
+func encodeFrames(codec Codec, compressAbove int, b []byte) ([]byte, error) {
+	if codec == nil && (compressAbove <= 0 || len(b) <= compressAbove) {
+		return b, nil
+	}
+
+	mpck, err := ParseMsgPack(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if !needEncode(codec, compressAbove, mpck.MsgType(), len(mpck.Body())) {
+		return b, nil
+	}
+
+	f, err := encodeMsgPack(codec, compressAbove, mpck.MsgType(), mpck.Header(), mpck.Body())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, buffersLen(f.bufs))
+	for _, v := range f.bufs {
+		out = append(out, v...)
+	}
+	f.release()
+
+	return out, nil
+}
+
+//encodeMsgPack은 header, body를 codec으로 바꾸고 압축해서 frame을 만든다. body를 이어붙이지 않는다.
+//새로 만드는 frame head와 압축한 body는 frameBuffers에서 얻으므로 보낸 뒤 release해야 한다.
+func encodeMsgPack(codec Codec, compressAbove int, msgType byte, header []byte, body []byte) (writeFrames, error) {
+	var f writeFrames
+	var err error
+
+	if codec != nil {
+		if header, err = codec.Marshal(header); err != nil {
+			return f, err
+		}
+
+		if body, err = codec.Marshal(body); err != nil {
+			return f, err
+		}
+	}
+
+	if compressAbove > 0 && len(body) > compressAbove && msgType != MsgTypeCancel {
+		//압축해도 작아지지 않으면 그대로 보낸다.
+		if z, err := compressBody(getFrameBuffer(), body); err != nil {
+			app.ErrorLog("compress error %s", err.Error())
+		} else if len(z) < len(body) {
+			body, f.pooled[1] = z, z
+			msgType |= MsgFlagCompressed
+		} else {
+			putFrameBuffer(z)
+		}
+	}
+
+	//chunk로 나눠야 하는 body는 build로 만든다.
+	if len(body) > ChunkBodyLength {
+		out := &msgPack{msgType: msgType, header: header, body: body}
+		if err := out.build(); err != nil {
+			f.release()
+			return writeFrames{}, err
+		}
+
+		f.bufs = out.frames
+		return f, nil
+	}
+
+	head := appendFrameHead(getFrameBuffer(), msgType, header, len(body))
+	f.pooled[0] = head
+	if len(head)+len(body) > MaxBufferLength {
+		f.release()
+		return writeFrames{}, CoRaiseNError(NErrorTooLargeSize, 1)
+	}
+
+	if len(body) > 0 {
+		f.bufs = net.Buffers{head, body}
+	} else {
+		f.bufs = net.Buffers{head}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,114 @@
+/********************************************************************************
+* compress.go
+* link에서 큰 body를 deflate로 압축한다.
+* 압축한 frame은 type byte에 MsgFlagCompressed를 더해서 보내고, conn.Read가 풀어서 돌려준다.
+* 상대가 ConnectMsg나 AcceptMsg에 Compress를 보냈을때만 압축해서 보낸다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//CompressIO는 압축을 켜고 끌 수 있는 NetIO이다.
+type CompressIO interface {
+	SetCompress(threshold int)
+}
+
+var flateWriters sync.Pool
+var flateReaders sync.Pool
+
+//compressThreshold는 압축하는 body의 최소 크기이다. 0이면 압축하지 않는다.
+func compressThreshold() int {
+	if app.Config == nil || app.Config.Global.Compression.Threshold == 0 {
+		return DefaultCompressThreshold
+	}
+
+	if app.Config.Global.Compression.Threshold < 0 {
+		return 0
+	}
+
+	return app.Config.Global.Compression.Threshold
+}
+
+func compressLevel() int {
+	if app.Config != nil && app.Config.Global.Compression.Level != 0 {
+		return app.Config.Global.Compression.Level
+	}
+
+	return flate.DefaultCompression
+}
+
+//SetLinkCompress는 상대가 압축된 body를 받을 수 있으면 rw의 압축을 켠다.
+func SetLinkCompress(rw NetIO, peerCompress bool) {
+	cio, ok := rw.(CompressIO)
+	if !ok {
+		return
+	}
+
+	if peerCompress {
+		cio.SetCompress(compressThreshold())
+	} else {
+		cio.SetCompress(0)
+	}
+}
+
+//compressBody는 압축한 body를 dst 뒤에 붙인다. pool에서 얻은 buffer를 dst로 주면 할당하지 않는다.
+func compressBody(dst []byte, body []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	buf.Grow(len(body) / 2)
+
+	w, ok := flateWriters.Get().(*flate.Writer)
+	if ok {
+		w.Reset(buf)
+	} else {
+		var err error
+		if w, err = flate.NewWriter(buf, compressLevel()); err != nil {
+			return nil, err
+		}
+	}
+	defer flateWriters.Put(w)
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+//decompressBody는 압축을 푼다. 풀린 크기가 maxMessageSize를 넘으면 에러이다.
+func decompressBody(body []byte) ([]byte, error) {
+	r, ok := flateReaders.Get().(io.ReadCloser)
+	if ok {
+		r.(flate.Resetter).Reset(bytes.NewReader(body), nil)
+	} else {
+		r = flate.NewReader(bytes.NewReader(body))
+	}
+	defer flateReaders.Put(r)
+
+	max := maxMessageSize()
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > max {
+		return nil, CoRaiseNError(NErrorTooLargeSize, 1, "decompressed body is too large")
+	}
+
+	return b, nil
+}
@@ -0,0 +1,180 @@
+package net
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/Azraid/pasque/app"
+)
+
+func randomBody(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestDecompressSizeLimit(t *testing.T) {
+	const max = 64 * 1024
+
+	tests := []struct {
+		name   string
+		body   []byte
+		tooBig bool
+	}{
+		{name: "small", body: testBody(100)},
+		{name: "at limit", body: testBody(max)},
+		{name: "one byte over", body: testBody(max + 1), tooBig: true},
+		{name: "compression bomb", body: make([]byte, 100*max), tooBig: true},
+		{name: "random at limit", body: randomBody(max)},
+	}
+
+	saved := app.Config.Global.MaxMessageSize
+	defer func() { app.Config.Global.MaxMessageSize = saved }()
+	app.Config.Global.MaxMessageSize = max
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, err := compressBody(nil, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := decompressBody(z)
+			if tt.tooBig {
+				nerr, ok := err.(NError)
+				if !ok || nerr.Code() != NErrorTooLargeSize {
+					t.Fatalf("err %v, want NErrorTooLargeSize", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, tt.body) {
+				t.Fatalf("decompressed %d bytes, want %d", len(b), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestDecompressCorrupted(t *testing.T) {
+	z, err := compressBody(nil, testBody(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		z    []byte
+	}{
+		{name: "truncated", z: z[:len(z)/2]},
+		{name: "garbage", z: []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decompressBody(tt.z); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestCompressThreshold(t *testing.T) {
+	tests := []struct {
+		threshold int
+		want      int
+	}{
+		{threshold: 0, want: DefaultCompressThreshold},
+		{threshold: -1, want: 0},
+		{threshold: 100, want: 100},
+	}
+
+	saved := app.Config.Global.Compression
+	defer func() { app.Config.Global.Compression = saved }()
+
+	for _, tt := range tests {
+		app.Config.Global.Compression.Threshold = tt.threshold
+		if got := compressThreshold(); got != tt.want {
+			t.Errorf("threshold %d got %d, want %d", tt.threshold, got, tt.want)
+		}
+	}
+}
+
+//threshold를 넘고 압축해서 작아지는 request, response body만 압축한다.
+func TestCompressFrames(t *testing.T) {
+	const threshold = 1000
+
+	tests := []struct {
+		name       string
+		msgType    byte
+		body       []byte
+		threshold  int
+		compressed bool
+	}{
+		{name: "below threshold", msgType: MsgTypeRequest, body: testBody(threshold), threshold: threshold},
+		{name: "above threshold", msgType: MsgTypeRequest, body: testBody(threshold + 1), threshold: threshold, compressed: true},
+		{name: "response", msgType: MsgTypeResponse, body: testBody(10 * threshold), threshold: threshold, compressed: true},
+		{name: "incompressible", msgType: MsgTypeResponse, body: randomBody(10 * threshold), threshold: threshold},
+		{name: "cancel", msgType: MsgTypeCancel, body: testBody(10 * threshold), threshold: threshold},
+		{name: "compression off", msgType: MsgTypeRequest, body: testBody(10 * threshold)},
+		{name: "chunked body", msgType: MsgTypeRequest, body: testBody(3 * ChunkBodyLength), threshold: threshold, compressed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewMsgPack(tt.msgType, []byte(`{}`), tt.body)
+			b, err := encodeFrames(nil, tt.threshold, src.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if compressed := b[1]&MsgFlagCompressed != 0; compressed != tt.compressed {
+				t.Fatalf("compressed %v, want %v", compressed, tt.compressed)
+			}
+
+			//연결로 보내면 받는 쪽은 풀어서 돌려준다.
+			ca, cb := newTestConnPair(t)
+			ca.SetCompress(tt.threshold)
+
+			if err := WriteMsgPack(ca, src, false); err != nil {
+				t.Fatal(err)
+			}
+
+			f := readTimeout(t, cb)
+			if f.err != nil {
+				t.Fatal(f.err)
+			}
+
+			if f.msgType != tt.msgType || !bytes.Equal(f.body, tt.body) {
+				t.Fatalf("read %c %d bytes, want %c %d bytes", f.msgType, len(f.body), tt.msgType, len(tt.body))
+			}
+		})
+	}
+}
+
+//풀린 크기가 받는 쪽의 최대 크기를 넘으면 읽지 않는다.
+func TestCompressReceiveLimit(t *testing.T) {
+	saved := app.Config.Global.MaxMessageSize
+	defer func() { app.Config.Global.MaxMessageSize = saved }()
+
+	app.Config.Global.MaxMessageSize = 0
+	ca, cb := newTestConnPair(t)
+	ca.SetCompress(100)
+
+	//압축하면 한 frame에 들어가지만 풀면 최대 크기를 넘는다.
+	if err := WriteMsgPack(ca, NewMsgPack(MsgTypeRequest, []byte(`{}`), make([]byte, ChunkBodyLength)), false); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Config.Global.MaxMessageSize = ChunkBodyLength - 1
+
+	f := readTimeout(t, cb)
+	nerr, ok := f.err.(NError)
+	if !ok || nerr.Code() != NErrorTooLargeSize {
+		t.Fatalf("err %v, want NErrorTooLargeSize", f.err)
+	}
+}
@@ -8,9 +8,10 @@
 package net
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
 	"net"
-	"strconv"
 	"sync"
 	"sync/atomic"
 
@@ -28,12 +29,22 @@ const (
 // Client와 서버의 역할에 따른 BM이 복잡하므로 역할을 상위로 위임한다.
 type conn struct {
 	//	eid    string
-	rwc     net.Conn
-	status  int32
-	lock    *sync.RWMutex
-	onClose func()
+	rwc       net.Conn
+	status    int32
+	lock      *sync.RWMutex
+	onClose   func()
+	onUnsent  func(b []byte) //writer가 보내지 못한 메세지를 소유자의 unsentQ에 넣는다.
+	chunks    []byte         //받고 있는 chunk body, Read goroutine에서만 사용한다.
+	chunkDrop bool           //최대 크기를 넘은 메세지의 남은 chunk를 버리는 중이다.
+	codec     Codec          //접속할때 정한 codec, nil이면 JSON 그대로 쓴다.
+	compress  int            //이 크기보다 큰 body를 압축해서 보낸다. 0이면 압축하지 않는다.
+	noChunk   bool           //상대가 chunk frame을 받지 못한다.
+	w         *connWriter
 }
 
+//drainBuffers는 잘못된 frame을 읽어서 버릴때 쓰는 buffer이다.
+var drainBuffers = sync.Pool{New: func() interface{} { return make([]byte, MaxBufferLength) }}
+
 func NewNetIO() NetIO {
 	return &conn{
 		//	eid:    "unknown",
@@ -45,31 +56,108 @@ func (c *conn) Register(rwc net.Conn) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if c.w != nil {
+		c.w.stop()
+	}
+
 	c.rwc = rwc
-	atomic.StoreInt32(&c.status, ConnStatusConnected)
+	c.w = newConnWriter(c, rwc, c.unsent)
+	c.codec, c.compress, c.noChunk = nil, 0, false //codec, 압축, protocol은 접속할때마다 다시 정한다.
+	atomic.StoreInt32(&c.status, ConnStatusHandshaking)
+}
+
+//SetConnected는 handshake를 마친 연결로 다른 메세지를 보낼 수 있게 한다.
+func (c *conn) SetConnected() {
+	atomic.CompareAndSwapInt32(&c.status, ConnStatusHandshaking, ConnStatusConnected)
 }
 
 func (c *conn) AddCloseEvent(onClose func()) {
 	c.onClose = onClose
 }
 
+func (c *conn) AddUnsentEvent(onUnsent func(b []byte)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.onUnsent = onUnsent
+}
+
+//unsent는 writer가 보내지 못한 메세지를 onUnsent로 넘긴다. 접속, ping 메세지는 다시 보내지 않으므로 버린다.
+//codec, 압축 전 frame을 넘기므로 pool buffer는 넘기지 않는다.
+func (c *conn) unsent(f writeFrames) {
+	bufs := f.bufs
+	if f.orig != nil {
+		bufs = f.orig
+	}
+
+	b := joinBuffers(bufs, buffersLen(bufs))
+	f.release()
+
+	c.lock.RLock()
+	onUnsent := c.onUnsent
+	c.lock.RUnlock()
+
+	mpck, err := ParseMsgPack(b)
+	if err != nil || !isCodecMsgType(mpck.MsgType()) {
+		return
+	}
+
+	if onUnsent == nil {
+		app.ErrorLog("unsent message dropped, %d bytes", len(b))
+		return
+	}
+
+	onUnsent(b)
+}
+
 func (c *conn) Close() {
 	go func() {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
-		if atomic.SwapInt32(&c.status, ConnStatusDisconnected) == ConnStatusConnected {
+		if atomic.SwapInt32(&c.status, ConnStatusDisconnected) != ConnStatusDisconnected {
 			if c.onClose != nil {
 				c.onClose()
 			}
 		}
 
-		if c.rwc != nil {
+		//writer가 남은 frame을 보낸 뒤 rwc를 닫는다.
+		if c.w != nil {
+			c.w.stop()
+		} else if c.rwc != nil {
 			c.rwc.Close()
 		}
 	}()
 }
 
+func (c *conn) SetCodec(codec Codec) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.codec = codec
+}
+
+func (c *conn) SetCompress(threshold int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.compress = threshold
+}
+
+func (c *conn) SetProtocol(version int, caps []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.noChunk = version < ProtocolVersion || !HasCap(caps, CapChunk)
+}
+
+func (c *conn) getCodec() Codec {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.codec
+}
+
 func (c *conn) IsConnected() bool {
 	if atomic.LoadInt32(&c.status) == ConnStatusConnected {
 		return true
@@ -78,45 +166,248 @@ func (c *conn) IsConnected() bool {
 }
 
 func (c *conn) Write(b []byte, isLogging bool) error {
-	if atomic.LoadInt32(&c.status) != ConnStatusConnected {
-		return errors.New("connection closed")
+	return c.WriteBuffers(net.Buffers{b}, isLogging)
+}
+
+//WriteBuffers는 frame 조각을 이어붙이지 않고 writer의 queue에 넣는다. writer가 모아서 한번에(writev) 보낸다.
+//codec이나 압축을 해야 하면 이어붙여서 바꾼 뒤 넣는다. bufs와 그 안의 slice는 보낸 뒤에도 바꾸면 안된다.
+func (c *conn) WriteBuffers(bufs net.Buffers, isLogging bool) error {
+	return c.writeBuffers(bufs, isLogging, nil)
+}
+
+//WriteAck는 Write와 같지만 writer가 b를 보낸 뒤나 보내지 못했을때 onDone을 부른다.
+//보내지 못한 b는 unsentQ로 넘기지 않으므로, 다시 보내는 unsentQ가 제자리에 둔다.
+func (c *conn) WriteAck(b []byte, isLogging bool, onDone func(err error)) error {
+	return c.writeBuffers(net.Buffers{b}, isLogging, onDone)
+}
+
+func (c *conn) writeBuffers(bufs net.Buffers, isLogging bool, onDone func(err error)) error {
+	if err := c.writable(bufs); err != nil {
+		return err
 	}
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	n, err := c.rwc.Write(b)
 
-	if err != nil {
-		c.Close()
+	logText := packetLogText(bufs, isLogging)
+
+	if codec, compress := c.encoding(); codec != nil || (compress > 0 && buffersLen(bufs) > compress) {
+		out, err := encodeFrames(codec, compress, joinBuffers(bufs, buffersLen(bufs)))
+		if err != nil {
+			return err
+		}
+		return c.push(writeFrames{bufs: net.Buffers{out}, orig: bufs, onDone: onDone}, logText)
+	}
+
+	return c.push(writeFrames{bufs: bufs, onDone: onDone}, logText)
+}
+
+//WriteMsgPack은 codec이나 압축을 해야 해도 frame을 이어붙이지 않고 header, body에서 바로 바꿔 넣는다.
+//바꾸지 않는 body는 복사하지 않는다. 새로 만든 buffer는 writer가 보낸 뒤 pool로 돌려준다.
+func (c *conn) WriteMsgPack(mpck MsgPack, isLogging bool) error {
+	bufs := mpck.Buffers()
+	if err := buildError(mpck); err != nil {
+		return err
+	}
+
+	if err := c.writable(bufs); err != nil {
 		return err
 	}
 
-	if isLogging {
-		app.PacketLog("->%s\r\n", string(b[1:]))
+	logText := packetLogText(bufs, isLogging)
+
+	f := writeFrames{bufs: bufs}
+	if codec, compress := c.encoding(); needEncode(codec, compress, mpck.MsgType(), len(mpck.Body())) {
+		var err error
+		if f, err = encodeMsgPack(codec, compress, mpck.MsgType(), mpck.Header(), mpck.Body()); err != nil {
+			return err
+		}
+		f.orig = bufs
+	}
+
+	return c.push(f, logText)
+}
+
+//writable은 지금 bufs를 보낼 수 있는지 확인한다. handshake 중에는 Connect, Accept만 보낸다.
+func (c *conn) writable(bufs net.Buffers) error {
+	switch atomic.LoadInt32(&c.status) {
+	case ConnStatusConnected:
+	case ConnStatusHandshaking:
+		if !isHandshakeFrame(bufs) {
+			return errors.New("connection handshaking")
+		}
+	default:
+		return errors.New("connection closed")
+	}
+
+	return nil
+}
+
+func packetLogText(bufs net.Buffers, isLogging bool) string {
+	if isLogging && app.IsPacketLogEnabled() {
+		if b := joinBuffers(bufs, buffersLen(bufs)); len(b) > 0 {
+			return string(b[1:])
+		}
+	}
+
+	return ""
+}
+
+func (c *conn) encoding() (Codec, int) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.codec, c.compress
+}
+
+//push는 f를 writer의 queue에 넣는다. 같은 goroutine에서 쓴 frame의 순서는 queue에서도 유지된다.
+func (c *conn) push(f writeFrames, logText string) error {
+	c.lock.RLock()
+	w, noChunk := c.w, c.noChunk
+	c.lock.RUnlock()
+
+	if w == nil {
+		f.release()
+		return errors.New("connection closed")
+	}
+
+	//chunk는 언제나 앞에 오므로 첫 frame만 보면 된다.
+	if noChunk && len(f.bufs) > 0 && len(f.bufs[0]) > 1 && f.bufs[0][1] == MsgTypeChunk {
+		f.release()
+		return CoRaiseNError(NErrorTooLargeSize, 1, "peer can not receive chunked message")
 	}
 
-	if n != len(b) {
-		return errors.New("could not be sent all")
+	//block policy이면 queue에 자리가 날때까지 기다리므로 lock 밖에서 넣는다.
+	if err := w.push(f); err != nil {
+		f.release()
+		return err
+	}
+
+	if len(logText) > 0 {
+		app.PacketLog("->%s\r\n", logText)
 	}
 
 	return nil
 }
 
+func isHandshakeFrame(bufs net.Buffers) bool {
+	if len(bufs) == 0 || len(bufs[0]) < 2 {
+		return false
+	}
+
+	return bufs[0][1] == MsgTypeConnect || bufs[0][1] == MsgTypeAccept
+}
+
+func buffersLen(bufs net.Buffers) int {
+	size := 0
+	for _, b := range bufs {
+		size += len(b)
+	}
+
+	return size
+}
+
+//joinBuffers는 조각이 하나이면 복사하지 않는다.
+func joinBuffers(bufs net.Buffers, size int) []byte {
+	if len(bufs) == 1 {
+		return bufs[0]
+	}
+
+	b := make([]byte, 0, size)
+	for _, v := range bufs {
+		b = append(b, v...)
+	}
+
+	return b
+}
+
+//Read는 frame 하나를 읽는다. chunk frame은 마지막 frame까지 읽어 body를 합친다.
 func (c *conn) Read() (byte, []byte, []byte, error) {
-	msgType, header, body, err := c.readFrom()
-	if err != nil {
-		// 읽어서 없애버린다.
-		if c.IsConnected() {
-			data := make([]byte, MaxBufferLength)
-			c.rwc.Read(data)
+	for {
+		msgType, header, body, err := c.readFrom()
+		if err != nil {
+			c.chunks, c.chunkDrop = nil, false
+
+			// 읽어서 없애버린다.
+			if atomic.LoadInt32(&c.status) != ConnStatusDisconnected {
+				data := drainBuffers.Get().([]byte)
+				c.rwc.Read(data)
+				drainBuffers.Put(data)
+			}
+
+			return msgType, header, body, err
 		}
+
+		if msgType == MsgTypeChunk {
+			c.addChunk(header, body)
+			continue
+		}
+
+		if c.chunkDrop {
+			c.chunks, c.chunkDrop = nil, false
+			app.ErrorLog("too large message dropped, %s", string(header))
+			return 0, nil, nil, errors.New("too large message dropped")
+		}
+
+		if len(c.chunks) > 0 {
+			body = append(c.chunks, body...)
+			c.chunks = nil
+		}
+
+		if msgType&MsgFlagCompressed != 0 {
+			msgType &^= MsgFlagCompressed
+			if body, err = decompressBody(body); err != nil {
+				app.ErrorLog("decompress error %s, %s", err.Error(), string(header))
+				return 0, nil, nil, err
+			}
+		}
+
+		if codec := c.getCodec(); codec != nil && isCodecMsgType(msgType) {
+			return decodeFrame(codec, msgType, header, body)
+		}
+
+		return msgType, header, body, nil
+	}
+}
+
+//decodeFrame은 codec으로 받은 header와 body를 JSON으로 되돌린다.
+//frame은 모두 읽었으므로 실패해도 버퍼를 비우지 않는다.
+func decodeFrame(codec Codec, msgType byte, header []byte, body []byte) (byte, []byte, []byte, error) {
+	h, err := codec.Unmarshal(header)
+	if err != nil {
+		app.ErrorLog("%s decode header error %s", codec.Name(), err.Error())
+		return 0, nil, nil, err
+	}
+
+	b, err := codec.Unmarshal(body)
+	if err != nil {
+		app.ErrorLog("%s decode body error %s", codec.Name(), err.Error())
+		return 0, nil, nil, err
+	}
+
+	return msgType, h, b, nil
+}
+
+//addChunk는 chunk body를 모은다. 최대 크기를 넘으면 마지막 frame까지 버린다.
+func (c *conn) addChunk(header []byte, body []byte) {
+	if c.chunkDrop {
+		return
+	}
+
+	var ch ChunkHeader
+	if err := json.Unmarshal(header, &ch); err != nil || ch.Total > maxMessageSize() || len(c.chunks)+len(body) > maxMessageSize() {
+		c.chunks, c.chunkDrop = nil, true
+		return
+	}
+
+	if c.chunks == nil {
+		c.chunks = make([]byte, 0, ch.Total)
 	}
 
-	return msgType, header, body, err
+	c.chunks = append(c.chunks, body...)
 }
 
 //Read 함수는 읽기 가능한 상황에서만 계속 읽는다.
+//header와 body는 길이만큼만 할당해서 바로 읽으므로 frame마다 MaxBufferLength를 할당하지 않는다.
 func (c *conn) readFrom() (msgType byte, header []byte, body []byte, err error) {
-	data := make([]byte, MaxBufferLength)
+	var data [frameBodyLenLen]byte
 
 InitRead:
 	for {
@@ -125,6 +416,11 @@ InitRead:
 			return msgType, nil, nil, err
 		}
 
+		//압축 flag는 request, response에만 붙는다.
+		if t := data[0] &^ MsgFlagCompressed; t != data[0] && (t == MsgTypeRequest || t == MsgTypeResponse) {
+			break InitRead
+		}
+
 		switch data[0] {
 		case '/':
 			continue InitRead
@@ -138,6 +434,10 @@ InitRead:
 			break InitRead
 		case MsgTypeResponse:
 			break InitRead
+		case MsgTypeCancel:
+			break InitRead
+		case MsgTypeChunk:
+			break InitRead
 
 		default:
 			app.PacketLog("<-%c", data[0])
@@ -148,57 +448,64 @@ InitRead:
 	msgType = data[0]
 
 	//--Header---------------------------------------------------------------
-	// [len]{} 형태의 데이타(header, body)를 파싱한다. 이는 sdata로 담는다.
-	modeHeader := true
-	var n int
-	offset := 1
-	lenlen := 5
+	hlen, err := c.readLength(data[:frameHeadLen-2])
+	if err != nil {
+		return msgType, nil, nil, err
+	}
 
-	for {
-		sdata := data[offset : offset+lenlen]
-		l := 0
-
-		for i := 0; i < lenlen; {
-			if n, err = c.rwc.Read(sdata); err != nil {
-				c.Close()
-				app.PacketLog("<-%s\r\n", string(data[:offset]))
-				return msgType, nil, nil, err
-			}
-			i += n
-			offset += n
-		}
+	if frameHeadLen+hlen > MaxBufferLength {
+		return msgType, nil, nil, errors.New("read packet exception - too large")
+	}
 
-		if l, err = strconv.Atoi(string(sdata)); err != nil {
-			app.PacketLog("<-%s\r\n", string(data[:offset]))
-			return msgType, nil, nil, err
-		}
+	header = make([]byte, hlen)
+	if _, err = io.ReadFull(c.rwc, header); err != nil {
+		c.Close()
+		return msgType, nil, nil, err
+	}
 
-		if l <= 0 {
-			app.DebugLog("read packet length is zero")
-		}
+	if msgType == MsgTypePing {
+		return msgType, header, nil, nil
+	}
 
-		sdata = data[offset : offset+l]
-		for i := 0; i < l; {
-			if n, err = c.rwc.Read(sdata); err != nil {
-				c.Close()
-				app.PacketLog("<-%s\r\n", string(data[:offset]))
-				return msgType, nil, nil, err
-			}
-			i += n
-			offset += n
-		}
+	//--Body-----------------------------------------------------------------
+	blen, err := c.readLength(data[:frameBodyLenLen])
+	if err != nil {
+		return msgType, nil, nil, err
+	}
 
-		if !modeHeader {
-			app.PacketLog("<-%s\r\n", string(data[:offset]))
-			return msgType, header, sdata, nil
-		}
+	if frameHeadLen+hlen+frameBodyLenLen+blen > MaxBufferLength {
+		return msgType, nil, nil, errors.New("read packet exception - too large")
+	}
 
-		if msgType == MsgTypePing {
-			return msgType, sdata[:l], nil, nil
-		}
+	body = make([]byte, blen)
+	if _, err = io.ReadFull(c.rwc, body); err != nil {
+		c.Close()
+		return msgType, nil, nil, err
+	}
 
-		header = sdata
-		modeHeader = false
-		lenlen = 10
+	if app.IsPacketLogEnabled() {
+		app.PacketLog("<-%c%05d%s%010d%s\r\n", msgType, hlen, string(header), blen, string(body))
 	}
+
+	return msgType, header, body, nil
+}
+
+//readLength는 0으로 채워진 10진수 길이를 읽는다.
+func (c *conn) readLength(b []byte) (int, error) {
+	if _, err := io.ReadFull(c.rwc, b); err != nil {
+		c.Close()
+		return 0, err
+	}
+
+	l, ok := parseDecimal(b)
+	if !ok {
+		app.PacketLog("<-%s\r\n", string(b))
+		return 0, errors.New("read packet exception - invalid length")
+	}
+
+	if l == 0 {
+		app.DebugLog("read packet length is zero")
+	}
+
+	return l, nil
 }
@@ -0,0 +1,276 @@
+package net
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//newTestConnPair는 net.Pipe로 이어진 두 conn을 만든다. handshake는 마친 것으로 한다.
+func newTestConnPair(t testing.TB) (*conn, *conn) {
+	ca, cb := newTestHandshakePair(t)
+	ca.SetConnected()
+	cb.SetConnected()
+
+	return ca, cb
+}
+
+//newTestHandshakePair는 Register만 하고 handshake를 마치지 않은 두 conn을 만든다.
+func newTestHandshakePair(t testing.TB) (*conn, *conn) {
+	a, b := net.Pipe()
+
+	ca, cb := NewNetIO().(*conn), NewNetIO().(*conn)
+	ca.Register(a)
+	cb.Register(b)
+
+	t.Cleanup(func() {
+		ca.Close()
+		cb.Close()
+	})
+
+	return ca, cb
+}
+
+type readFrame struct {
+	msgType byte
+	header  []byte
+	body    []byte
+	err     error
+}
+
+//readTimeout은 c에서 frame 하나를 읽는다. 1초 안에 읽지 못하면 실패한다.
+func readTimeout(t *testing.T, c *conn) readFrame {
+	resC := make(chan readFrame, 1)
+	go func() {
+		var f readFrame
+		f.msgType, f.header, f.body, f.err = c.Read()
+		resC <- f
+	}()
+
+	select {
+	case f := <-resC:
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("read timeout")
+		return readFrame{}
+	}
+}
+
+func testBody(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte('a' + i%26)
+	}
+
+	return b
+}
+
+//countChunks는 buffer 조각 중 chunk frame head의 수를 센다.
+func countChunks(bufs net.Buffers) int {
+	n := 0
+	for _, b := range bufs {
+		if len(b) > 1 && b[0] == '/' && b[1] == MsgTypeChunk {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestChunkSplitReassemble(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		maxSize int //MaxMessageSize, 0이면 기본값
+		chunks  int
+		tooBig  bool
+	}{
+		{name: "empty", size: 0, chunks: 0},
+		{name: "small", size: 100, chunks: 0},
+		{name: "exactly one frame", size: ChunkBodyLength, chunks: 0},
+		{name: "one byte over", size: ChunkBodyLength + 1, chunks: 1},
+		{name: "several chunks", size: 3*ChunkBodyLength + 7, chunks: 3},
+		{name: "exact multiple", size: 4 * ChunkBodyLength, chunks: 3},
+		{name: "at max size", size: 2 * ChunkBodyLength, maxSize: 2 * ChunkBodyLength, chunks: 1},
+		{name: "over max size", size: 2*ChunkBodyLength + 1, maxSize: 2 * ChunkBodyLength, tooBig: true},
+	}
+
+	saved := app.Config.Global.MaxMessageSize
+	defer func() { app.Config.Global.MaxMessageSize = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Global.MaxMessageSize = tt.maxSize
+
+			body := testBody(tt.size)
+			mpck := NewMsgPack(MsgTypeResponse, []byte(`{"TxnNo":1}`), body)
+			bufs := mpck.Buffers()
+
+			if tt.tooBig {
+				if bufs != nil {
+					t.Fatalf("built %d buffers, want too large error", len(bufs))
+				}
+				return
+			}
+
+			if n := countChunks(bufs); n != tt.chunks {
+				t.Fatalf("chunks %d, want %d", n, tt.chunks)
+			}
+
+			//buffer로 되돌리기
+			parsed, err := ParseMsgPack(mpck.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if parsed.MsgType() != MsgTypeResponse || !bytes.Equal(parsed.Body(), body) {
+				t.Fatalf("parsed type %c body %d bytes, want %d", parsed.MsgType(), len(parsed.Body()), len(body))
+			}
+
+			//연결로 보내고 받기
+			ca, cb := newTestConnPair(t)
+			if err := WriteMsgPack(ca, mpck, false); err != nil {
+				t.Fatal(err)
+			}
+
+			f := readTimeout(t, cb)
+			if f.err != nil {
+				t.Fatal(f.err)
+			}
+
+			if f.msgType != MsgTypeResponse || string(f.header) != `{"TxnNo":1}` || !bytes.Equal(f.body, body) {
+				t.Fatalf("read type %c header %s body %d bytes, want %d", f.msgType, f.header, len(f.body), len(body))
+			}
+		})
+	}
+}
+
+//받는 쪽의 최대 크기를 넘는 chunk 메세지는 버리고 다음 메세지는 읽는다.
+func TestChunkReceiveLimit(t *testing.T) {
+	saved := app.Config.Global.MaxMessageSize
+	defer func() { app.Config.Global.MaxMessageSize = saved }()
+
+	tests := []struct {
+		name    string
+		size    int
+		recvMax int
+		dropped bool
+	}{
+		{name: "within limit", size: 2*ChunkBodyLength + 1, recvMax: 3 * ChunkBodyLength},
+		{name: "over limit", size: 3*ChunkBodyLength + 1, recvMax: 2 * ChunkBodyLength, dropped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Global.MaxMessageSize = 0
+
+			big := NewMsgPack(MsgTypeRequest, []byte(`{"Api":"Big"}`), testBody(tt.size))
+			next := NewMsgPack(MsgTypeRequest, []byte(`{"Api":"Next"}`), []byte(`{}`))
+			if big.Buffers() == nil || next.Buffers() == nil {
+				t.Fatal("build error")
+			}
+
+			ca, cb := newTestConnPair(t)
+			app.Config.Global.MaxMessageSize = tt.recvMax
+
+			for _, mpck := range []MsgPack{big, next} {
+				if err := WriteMsgPack(ca, mpck, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f := readTimeout(t, cb)
+			if dropped := f.err != nil; dropped != tt.dropped {
+				t.Fatalf("dropped %v, want %v, err %v", dropped, tt.dropped, f.err)
+			}
+
+			if !tt.dropped && len(f.body) != tt.size {
+				t.Fatalf("body %d bytes, want %d", len(f.body), tt.size)
+			}
+
+			f = readTimeout(t, cb)
+			if f.err != nil || string(f.header) != `{"Api":"Next"}` {
+				t.Fatalf("next read %s, err %v", f.header, f.err)
+			}
+		})
+	}
+}
+
+//chunk를 받지 못하는 peer에는 큰 메세지를 보내지 않는다.
+func TestChunkPeerWithoutCap(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		caps    []string
+		size    int
+		tooBig  bool
+	}{
+		{name: "chunk cap", version: ProtocolVersion, caps: []string{CapChunk}, size: 2 * ChunkBodyLength},
+		{name: "no chunk cap small", version: ProtocolVersion, size: ChunkBodyLength},
+		{name: "no chunk cap large", version: ProtocolVersion, size: ChunkBodyLength + 1, tooBig: true},
+		{name: "legacy peer", version: ProtocolLegacyVersion, caps: []string{CapChunk}, size: ChunkBodyLength + 1, tooBig: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, _ := newTestConnPair(t)
+			ca.SetProtocol(tt.version, tt.caps)
+
+			err := WriteMsgPack(ca, NewMsgPack(MsgTypeRequest, []byte(`{}`), testBody(tt.size)), false)
+			if tooBig := err != nil; tooBig != tt.tooBig {
+				t.Fatalf("err %v, want too large %v", err, tt.tooBig)
+			}
+
+			if nerr, ok := err.(NError); err != nil && (!ok || nerr.Code() != NErrorTooLargeSize) {
+				t.Fatalf("err %v, want NErrorTooLargeSize", err)
+			}
+		})
+	}
+}
+
+//다시 보내도 실패하는 메세지는 unsentQ에 넣지 않고 에러를 돌려준다.
+func TestPermanentWriteNotQueued(t *testing.T) {
+	saved := app.Config.Global.MaxMessageSize
+	defer func() { app.Config.Global.MaxMessageSize = saved }()
+	app.Config.Global.MaxMessageSize = 2 * ChunkBodyLength
+
+	tests := []struct {
+		name      string
+		size      int
+		stub      bool
+		permanent bool
+	}{
+		{name: "stub too large", size: 2*ChunkBodyLength + 1, stub: true, permanent: true},
+		{name: "stub disconnected", size: 10, stub: true},
+		{name: "mux too large", size: 2*ChunkBodyLength + 1, permanent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &testUnsentQ{}
+			mpck := NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), testBody(tt.size))
+
+			var err error
+			if tt.stub {
+				stb := &stub{rw: NewNetIO(), unsentQ: q, appStatus: AppStatusRunning, lock: new(sync.RWMutex)}
+				err = stb.Send(mpck)
+			} else {
+				muxio, _ := newTestMuxIO(1)
+				muxio.unsentQ = q
+				err = muxio.WriteMsgPack(mpck, false)
+			}
+
+			if permanent := IsPermanentWriteError(err); permanent != tt.permanent {
+				t.Fatalf("err %v, want permanent %v", err, tt.permanent)
+			}
+
+			if queued := q.Len() > 0; queued == tt.permanent {
+				t.Fatalf("queued %d, want queued %v", q.Len(), !tt.permanent)
+			}
+		})
+	}
+}
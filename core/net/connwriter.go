@@ -0,0 +1,380 @@
+/********************************************************************************
+* connwriter.go
+* connection마다 write goroutine을 두고 보낼 frame을 queue에 모아 한번에(writev) 보낸다.
+* conn.Write는 codec, 압축을 적용한 frame을 queue에 넣고 바로 돌아온다.
+* writer는 queue가 비거나 FlushBytes만큼 모이면 보낸다. FlushDelayMs가 있으면 그만큼 더 모은다.
+* queue가 가득 차면 Queues.Write의 policy에 따라 에러를 돌려주거나(호출한 쪽이 unsentQ에 넣는다)
+* 자리가 날때까지 기다린다. 보내다가 실패하면 connection을 닫고, 보내던 batch와 queue에 남은 frame을
+* 메세지 하나씩 conn의 unsent callback으로 넘긴다. conn은 AddUnsentEvent로 받은 소유자의 unsentQ에 넣는다.
+* unsentQ가 WriteAck로 다시 보낸 frame은 unsent로 넘기지 않고 onDone으로 결과만 알려준다.
+* 일부를 보낸 메세지도 다시 보내므로 받는 쪽은 같은 메세지를 두번 받을 수 있다.
+* writer가 끝난 뒤의 push는 error를 돌려주므로 queue에 넣은 frame은 언제나 writer가 보내거나 넘긴다.
+* conn이 codec, 압축으로 새로 만든 frame buffer는 frameBuffers pool에서 얻고, 보낸 뒤 writer가 돌려준다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const (
+	DefaultWriteQueueSize  = 4096      //connection별 write queue 길이
+	DefaultWriteFlushBytes = 64 * 1024 //이만큼 모이면 더 기다리지 않고 보낸다.
+
+	closeFlushTimeout = time.Second //close할때 남은 frame을 보내는 시간
+
+	frameBufferSize = 4 * 1024 //frameBuffers에서 새로 만드는 buffer 크기
+)
+
+//frameBuffers는 conn이 codec, 압축으로 만드는 frame head와 body buffer이다.
+var frameBuffers = sync.Pool{New: func() interface{} { return make([]byte, 0, frameBufferSize) }}
+
+func getFrameBuffer() []byte {
+	return frameBuffers.Get().([]byte)[:0]
+}
+
+//putFrameBuffer는 b를 pool로 돌려준다. 너무 커진 buffer는 돌려주지 않는다.
+func putFrameBuffer(b []byte) {
+	if b != nil && cap(b) <= MaxBufferLength {
+		frameBuffers.Put(b[:0])
+	}
+}
+
+//writeFrames는 queue에 넣는 frame 조각이다. pooled는 보낸 뒤 frameBuffers로 돌려줄 buffer이다.
+type writeFrames struct {
+	bufs   net.Buffers
+	orig   net.Buffers     //codec, 압축 전 frame. 보내지 못하면 unsentQ에 이것을 넣는다.
+	onDone func(err error) //nil이 아니면 보낸 뒤나 보내지 못했을때 unsent 대신 부른다.
+	pooled [2][]byte
+}
+
+//UnsentIO는 보내지 못한 메세지를 소유자의 unsentQ로 넘기는 NetIO이다.
+type UnsentIO interface {
+	AddUnsentEvent(onUnsent func(b []byte))
+}
+
+//AckWriter는 writer가 frame을 실제로 보낸 뒤에 결과를 알려주는 NetWriter이다. unsentQ가 다시 보낼때 쓴다.
+//onDone은 writer goroutine에서 불리며, error를 받은 frame은 unsent로 넘기지 않는다.
+//WriteAck가 error를 돌려주면 onDone은 불리지 않는다.
+type AckWriter interface {
+	WriteAck(b []byte, isLogging bool, onDone func(err error)) error
+}
+
+func (f *writeFrames) release() {
+	for i, b := range f.pooled {
+		putFrameBuffer(b)
+		f.pooled[i] = nil
+	}
+}
+
+type connWriter struct {
+	c          *conn
+	rwc        net.Conn
+	frames     chan writeFrames
+	quit       chan struct{}
+	lock       *sync.Mutex
+	space      *sync.Cond //block policy의 push를 queue에 자리가 나거나 writer가 끝나면 깨운다.
+	stopped    bool
+	policy     string
+	flushBytes int
+	flushDelay time.Duration
+	unsent     func(f writeFrames) //보내지 못한 메세지를 넘긴다.
+	drained    bool                //writer가 끝났다. 이후의 push는 error를 돌려준다.
+}
+
+//connWriters는 queue depth를 보여주기 위해 살아있는 writer를 모아둔다.
+var connWriters = new(sync.Map)
+var connWritersOnce sync.Once
+
+func newConnWriter(c *conn, rwc net.Conn, unsent func(f writeFrames)) *connWriter {
+	w := &connWriter{
+		c:          c,
+		rwc:        rwc,
+		unsent:     unsent,
+		quit:       make(chan struct{}),
+		lock:       new(sync.Mutex),
+		policy:     OverloadReject,
+		flushBytes: DefaultWriteFlushBytes,
+	}
+	w.space = sync.NewCond(w.lock)
+
+	size := DefaultWriteQueueSize
+	if app.Config != nil {
+		limit := app.Config.Global.Queues.Write
+		if limit.Max > 0 {
+			size = limit.Max
+		}
+
+		//dropoldest는 stream frame 순서를 깨므로 reject로 다룬다.
+		if overloadPolicy(limit.Policy, OverloadReject) == OverloadBlock {
+			w.policy = OverloadBlock
+		}
+
+		cfg := app.Config.Global.Writer
+		if cfg.FlushBytes > 0 {
+			w.flushBytes = cfg.FlushBytes
+		}
+		w.flushDelay = time.Duration(cfg.FlushDelayMs) * time.Millisecond
+	}
+	w.frames = make(chan writeFrames, size)
+
+	connWritersOnce.Do(func() {
+		RegisterQueueDepth("write", app.QueueLimit{Max: size, Policy: w.policy}, maxWriteQueueDepth)
+	})
+	connWriters.Store(w, struct{}{})
+
+	go goConnWrite(w)
+	return w
+}
+
+//maxWriteQueueDepth는 가장 많이 쌓인 connection의 write queue 길이이다.
+func maxWriteQueueDepth() int {
+	max := 0
+	connWriters.Range(func(k, v interface{}) bool {
+		if l := len(k.(*connWriter).frames); l > max {
+			max = l
+		}
+		return true
+	})
+
+	return max
+}
+
+//push는 frame을 queue에 넣는다. 넣지 못하면 호출한 쪽이 f를 release한다.
+//writer가 멈췄거나 끝났으면 넣지 않으므로, 호출한 쪽이 unsentQ에 넣는다.
+func (w *connWriter) push(f writeFrames) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for {
+		if w.stopped || w.drained {
+			return errors.New("connection closed")
+		}
+
+		select {
+		case w.frames <- f:
+			return nil
+		default:
+		}
+
+		if w.policy != OverloadBlock {
+			return CoRaiseNError(NErrorServerBusy, 1, "write queue full")
+		}
+
+		w.space.Wait()
+	}
+}
+
+//wake는 block policy에서 자리가 나기를 기다리는 push를 깨운다.
+func (w *connWriter) wake() {
+	if w.policy == OverloadBlock {
+		w.lock.Lock()
+		w.space.Broadcast()
+		w.lock.Unlock()
+	}
+}
+
+//drain은 writer가 끝났음을 표시하고 queue에 남은 frame을 꺼낸다. 이후의 push는 error를 돌려준다.
+func (w *connWriter) drain() []writeFrames {
+	var left []writeFrames
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.drained = true
+	for len(w.frames) > 0 {
+		left = append(left, <-w.frames)
+	}
+	w.space.Broadcast()
+
+	return left
+}
+
+//fail은 보내지 못한 batch와 queue에 남은 frame을 순서대로 넘긴다.
+//unsent는 conn과 unsentQ의 lock을 잡으므로 w.lock 밖에서 부른다.
+func (w *connWriter) fail(batch *writeBatch, err error) {
+	left := w.drain()
+
+	for _, f := range batch.items {
+		w.failed(f, err)
+	}
+	batch.clear()
+
+	for _, f := range left {
+		w.failed(f, err)
+	}
+}
+
+//failed는 WriteAck로 넣은 frame이면 onDone으로 알리고, 아니면 unsent로 넘긴다.
+func (w *connWriter) failed(f writeFrames, err error) {
+	if f.onDone == nil {
+		w.unsent(f)
+		return
+	}
+
+	f.release()
+	f.onDone(err)
+}
+
+//stop은 writer를 멈춘다. writer는 남은 frame을 closeFlushTimeout 동안 보내고 rwc를 닫는다.
+func (w *connWriter) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.stopped {
+		return
+	}
+
+	w.stopped = true
+	close(w.quit)
+	w.space.Broadcast()
+	w.rwc.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+}
+
+func (w *connWriter) flush(batch net.Buffers) error {
+	w.lock.Lock()
+	if !w.stopped {
+		w.rwc.SetWriteDeadline(time.Now().Add(time.Second * WriteTimeoutSec))
+	}
+	w.lock.Unlock()
+
+	size := buffersLen(batch)
+	n, err := batch.WriteTo(w.rwc)
+	if err != nil {
+		return err
+	}
+
+	if n != int64(size) {
+		return errors.New("could not be sent all")
+	}
+
+	return nil
+}
+
+//writeBatch는 한번에 보낼 frame이다. items는 보낸 뒤 pool buffer를 돌려주거나 보내지 못했을때 unsent로 넘긴다.
+type writeBatch struct {
+	bufs  net.Buffers
+	items []writeFrames
+}
+
+func (b *writeBatch) add(f writeFrames) {
+	b.bufs = append(b.bufs, f.bufs...)
+	b.items = append(b.items, f)
+}
+
+//reset은 보낸 frame의 onDone을 부르고 pool buffer를 돌려준 뒤 batch를 비운다.
+func (b *writeBatch) reset() {
+	for i := range b.items {
+		b.items[i].release()
+		if b.items[i].onDone != nil {
+			b.items[i].onDone(nil)
+		}
+	}
+	b.clear()
+}
+
+//clear는 batch를 비운다. slice는 다시 쓴다.
+func (b *writeBatch) clear() {
+	for i := range b.bufs {
+		b.bufs[i] = nil
+	}
+
+	for i := range b.items {
+		b.items[i] = writeFrames{}
+	}
+
+	b.bufs, b.items = b.bufs[:0], b.items[:0]
+}
+
+//collect는 queue에 쌓인 frame을 flushBytes까지 모은다. queue가 비면 flushDelay만큼 더 기다린다.
+func (w *connWriter) collect(batch *writeBatch) {
+	size := buffersLen(batch.bufs)
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for size < w.flushBytes {
+		select {
+		case f := <-w.frames:
+			batch.add(f)
+			size += buffersLen(f.bufs)
+			continue
+		default:
+		}
+
+		if w.flushDelay <= 0 {
+			break
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(w.flushDelay)
+		}
+
+		select {
+		case f := <-w.frames:
+			batch.add(f)
+			size += buffersLen(f.bufs)
+		case <-timer.C:
+			return
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+func goConnWrite(w *connWriter) {
+	defer app.DumpRecover()
+	defer connWriters.Delete(w)
+	defer w.rwc.Close()
+
+	var batch writeBatch
+
+	for {
+		select {
+		case f := <-w.frames:
+			batch.add(f)
+			w.collect(&batch)
+			w.wake()
+			if err := w.flush(batch.bufs); err != nil {
+				app.ErrorLog("write error %s, %d messages to unsentQ", err.Error(), len(batch.items)+len(w.frames))
+				w.c.Close()
+				w.fail(&batch, err)
+				return
+			}
+			batch.reset()
+
+		case <-w.quit:
+			//close 전에 넣은 frame을 보낸다. accept 거절 메세지 같은 것이다.
+			for len(w.frames) > 0 {
+				batch.add(<-w.frames)
+			}
+
+			if len(batch.bufs) > 0 {
+				if err := w.flush(batch.bufs); err != nil {
+					app.DebugLog("write error on close %s", err.Error())
+					w.fail(&batch, err)
+					return
+				}
+			}
+			batch.reset()
+			for _, f := range w.drain() {
+				w.failed(f, errors.New("connection closed"))
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+//newTestWriter는 goroutine 없이 collect, push만 확인할 writer를 만든다.
+func newTestWriter(size int, flushBytes int, flushDelay time.Duration) *connWriter {
+	w := &connWriter{
+		frames:     make(chan writeFrames, size),
+		quit:       make(chan struct{}),
+		lock:       new(sync.Mutex),
+		policy:     OverloadReject,
+		flushBytes: flushBytes,
+		flushDelay: flushDelay,
+	}
+	w.space = sync.NewCond(w.lock)
+	return w
+}
+
+func testWriteFrames(size int) writeFrames {
+	return writeFrames{bufs: net.Buffers{testBody(size)}}
+}
+
+//collect는 flushBytes까지 모으고, queue가 비면 flushDelay만큼 더 기다린다.
+func TestConnWriterCollect(t *testing.T) {
+	tests := []struct {
+		name       string
+		queued     []int //collect 전에 queue에 넣은 frame 크기
+		late       int   //collect 중에 넣는 frame 크기, 0이면 넣지 않는다.
+		flushBytes int
+		flushDelay time.Duration
+		want       int //batch의 frame 수, 처음 frame을 포함한다.
+	}{
+		{name: "collect queued", queued: []int{10, 10, 10}, flushBytes: 1000, want: 4},
+		{name: "stop at flushBytes", queued: []int{100, 100, 100}, flushBytes: 150, want: 2},
+		{name: "empty queue no delay", flushBytes: 1000, want: 1},
+		{name: "delay expires", flushBytes: 1000, flushDelay: 10 * time.Millisecond, want: 1},
+		{name: "delay waits late frame", late: 10, flushBytes: 1000, flushDelay: 200 * time.Millisecond, want: 2},
+		{name: "late frame fills flushBytes", late: 1000, flushBytes: 1000, flushDelay: time.Minute, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWriter(16, tt.flushBytes, tt.flushDelay)
+			for _, size := range tt.queued {
+				w.frames <- testWriteFrames(size)
+			}
+
+			if tt.late > 0 {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					w.frames <- testWriteFrames(tt.late)
+				}()
+			}
+
+			var batch writeBatch
+			batch.add(testWriteFrames(100))
+			w.collect(&batch)
+
+			if len(batch.items) != tt.want || len(batch.bufs) != tt.want {
+				t.Fatalf("items %d bufs %d, want %d", len(batch.items), len(batch.bufs), tt.want)
+			}
+
+			if left := len(tt.queued) + 1 - tt.want; tt.late == 0 && len(w.frames) != left {
+				t.Fatalf("queue %d, want %d", len(w.frames), left)
+			}
+		})
+	}
+}
+
+//writer가 멈췄거나 끝난 뒤의 push는 error를 돌려주고, 호출한 쪽이 unsentQ에 넣는다.
+func TestConnWriterPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		policy  string
+		pushes  int
+		stopped bool
+		drained bool
+		free    bool //block policy에서 writer가 나중에 frame 하나를 꺼낸다.
+		end     bool //block policy에서 writer가 나중에 끝난다.
+		busy    bool //마지막 push가 queue full로 실패한다.
+		closed  bool //push가 connection closed로 실패한다.
+	}{
+		{name: "queued", size: 2, pushes: 2},
+		{name: "queue full", size: 1, pushes: 2, busy: true},
+		{name: "stopped", size: 2, pushes: 1, stopped: true, closed: true},
+		{name: "after writer ended", size: 2, pushes: 1, drained: true, closed: true},
+		{name: "block until space", size: 1, policy: OverloadBlock, pushes: 2, free: true},
+		{name: "block until writer ends", size: 1, policy: OverloadBlock, pushes: 2, end: true, closed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWriter(tt.size, DefaultWriteFlushBytes, 0)
+			if len(tt.policy) > 0 {
+				w.policy = tt.policy
+			}
+			w.stopped, w.drained = tt.stopped, tt.drained
+
+			if tt.free || tt.end {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					if tt.free {
+						<-w.frames
+						w.wake()
+					} else {
+						w.drain()
+					}
+				}()
+			}
+
+			var err error
+			for i := 0; i < tt.pushes; i++ {
+				if err = w.push(testWriteFrames(10)); err != nil {
+					break
+				}
+			}
+
+			if tt.busy {
+				if nerr, ok := err.(NError); !ok || nerr.Code() != NErrorServerBusy {
+					t.Fatalf("err %v, want NErrorServerBusy", err)
+				}
+			} else if closed := err != nil; closed != tt.closed {
+				t.Fatalf("err %v, want closed %v", err, tt.closed)
+			}
+		})
+	}
+}
+
+//failConn은 첫 Write를 release까지 붙잡아 두었다가 실패한다. 그 사이 넣은 frame은 queue에 남는다.
+type failConn struct {
+	net.Conn
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *failConn) Write(b []byte) (int, error) {
+	c.once.Do(func() { close(c.entered) })
+	<-c.release
+	return 0, errors.New("broken pipe")
+}
+
+//보내다가 실패하면 보내던 batch와 queue에 남은 메세지를 codec 전 frame으로 순서대로 unsentQ에 넣는다.
+func TestConnWriterFailToUnsent(t *testing.T) {
+	tests := []struct {
+		name     string
+		codec    Codec
+		compress int
+		mpcks    []MsgPack
+		ack      bool     //unsentQ가 다시 보내듯 WriteAck로 보낸다.
+		want     []string //unsentQ에 들어간 메세지의 body
+	}{
+		{
+			name:  "json",
+			mpcks: []MsgPack{NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":1}`)), NewMsgPack(MsgTypeResponse, []byte(`{}`), []byte(`{"N":2}`)), NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":3}`))},
+			want:  []string{`{"N":1}`, `{"N":2}`, `{"N":3}`},
+		},
+		{
+			name:     "msgpack compress",
+			codec:    msgPackCodec{},
+			compress: 1,
+			mpcks:    []MsgPack{NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":1}`)), NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":2,"S":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}`))},
+			want:     []string{`{"N":1}`, `{"N":2,"S":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}`},
+		},
+		{
+			name:  "ping dropped",
+			mpcks: []MsgPack{NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":1}`)), BuildPingMsgPack("c"), NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":2}`))},
+			want:  []string{`{"N":1}`, `{"N":2}`},
+		},
+		{
+			name:  "chunked",
+			mpcks: []MsgPack{NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), testBody(2*ChunkBodyLength+10)), NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":2}`))},
+			want:  []string{string(testBody(2*ChunkBodyLength + 10)), `{"N":2}`},
+		},
+		{
+			name:  "resent by unsentQ",
+			mpcks: []MsgPack{NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":1}`)), NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{"N":2}`))},
+			ack:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer b.Close()
+			fc := &failConn{Conn: a, entered: make(chan struct{}), release: make(chan struct{})}
+
+			q := &testUnsentQ{}
+			c := NewNetIO().(*conn)
+			c.Register(fc)
+			c.AddUnsentEvent(q.Add)
+			c.SetCodec(tt.codec)
+			c.SetCompress(tt.compress)
+			c.SetConnected()
+
+			doneC := make(chan error, len(tt.mpcks))
+			onDone := func(err error) { doneC <- err }
+
+			//첫 메세지를 보내는 동안 나머지는 queue에 쌓인다.
+			for i, mpck := range tt.mpcks {
+				var err error
+				if tt.ack {
+					err = c.WriteAck(mpck.Bytes(), false, onDone)
+				} else {
+					err = WriteMsgPack(c, mpck, false)
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if i == 0 {
+					select {
+					case <-fc.entered:
+					case <-time.After(time.Second):
+						t.Fatal("write timeout")
+					}
+				}
+			}
+			close(fc.release)
+
+			//WriteAck로 보낸 메세지는 unsentQ에 넣지 않고 onDone으로 실패를 알린다.
+			if tt.ack {
+				for range tt.mpcks {
+					select {
+					case err := <-doneC:
+						if err == nil {
+							t.Fatal("onDone without error")
+						}
+					case <-time.After(time.Second):
+						t.Fatal("onDone timeout")
+					}
+				}
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for q.Len() < len(tt.want) || c.IsConnected() {
+				if time.Now().After(deadline) {
+					t.Fatalf("unsent %d connected %v after write error", q.Len(), c.IsConnected())
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			mpcks := q.msgPacks(t)
+			if len(mpcks) != len(tt.want) {
+				t.Fatalf("unsent %d, want %d", len(mpcks), len(tt.want))
+			}
+
+			for i, mpck := range mpcks {
+				if !bytes.Equal(mpck.Body(), []byte(tt.want[i])) {
+					t.Fatalf("unsent %d body %.40s, want %.40s", i, mpck.Body(), tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+/********************************************************************************
+* deadletter.go
+* 전달하지 못하고 버려지는 메세지를 이유, eid, 시각과 함께 보관한다.
+* 메모리에는 Config.Global.DeadLetter.Size 만큼만 두고,
+* Spill이 켜져 있으면 밀려나는 메세지를 파일로 남긴다.
+* web console의 /deadletter 에서 조회하고 다시 보낼 수 있다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const defaultDeadLetterSize = 1000
+
+type DeadLetter struct {
+	No      uint64
+	Stamp   time.Time
+	Reason  string
+	FromEid string
+	MsgType string
+	Header  string
+	Body    string
+
+	msg      MsgPack
+	reinject func(MsgPack) error
+}
+
+type deadLetterQ struct {
+	lock   *sync.Mutex
+	l      *list.List
+	size   int
+	lastNo uint64
+	spill  *os.File
+}
+
+var deadLetters *deadLetterQ
+var deadLettersOnce sync.Once
+
+func init() {
+	app.HandleConsole("/deadletter", "dead letters", deadLetterHandler)
+	app.HandleConsole("/deadletter/reinject", "", deadLetterReinjectHandler)
+}
+
+func getDeadLetterQ() *deadLetterQ {
+	deadLettersOnce.Do(func() {
+		q := &deadLetterQ{lock: new(sync.Mutex), l: list.New(), size: defaultDeadLetterSize}
+
+		if app.Config != nil {
+			cfg := app.Config.Global.DeadLetter
+			if cfg.Size > 0 {
+				q.size = cfg.Size
+			}
+
+			if cfg.Spill {
+				path := cfg.Path
+				if len(path) == 0 {
+					path = app.App.LogPath
+				}
+
+				fn := fmt.Sprintf("%s/deadletter_%s.log", path, app.App.Eid)
+				if f, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+					q.spill = f
+				} else {
+					app.ErrorLog("dead letter spill file open error %s", err.Error())
+				}
+			}
+		}
+
+		deadLetters = q
+	})
+
+	return deadLetters
+}
+
+//AddDeadLetter는 버려지는 메세지를 기록한다.
+//reinject가 nil이면 console에서 다시 보낼 수 없다.
+func AddDeadLetter(reason string, fromEid string, mpck MsgPack, reinject func(MsgPack) error) {
+	getDeadLetterQ().Add(reason, fromEid, mpck, reinject)
+}
+
+//Add는 lock 안에서 목록만 바꾸고, log와 spill 파일 쓰기는 lock 밖에서 한다.
+//버리는 곳마다 부르므로 파일 I/O를 기다리며 서로 막히지 않게 한다.
+func (q *deadLetterQ) Add(reason string, fromEid string, mpck MsgPack, reinject func(MsgPack) error) {
+	if mpck == nil {
+		return
+	}
+
+	dl := &DeadLetter{
+		Stamp:    time.Now(),
+		Reason:   reason,
+		FromEid:  fromEid,
+		MsgType:  string(mpck.MsgType()),
+		Header:   string(mpck.Header()),
+		Body:     string(mpck.Body()),
+		msg:      mpck,
+		reinject: reinject,
+	}
+
+	var spilled []*DeadLetter
+
+	q.lock.Lock()
+	q.lastNo++
+	dl.No = q.lastNo
+	q.l.PushBack(dl)
+	for q.l.Len() > q.size {
+		spilled = append(spilled, q.l.Remove(q.l.Front()).(*DeadLetter))
+	}
+	q.lock.Unlock()
+
+	app.ErrorLog("dead letter[%d] %s from %s, %s", dl.No, reason, fromEid, dl.Header)
+
+	for _, v := range spilled {
+		q.spillOut(v)
+	}
+}
+
+//AddDeadLetterBytes는 unsentQ처럼 buffer로만 가지고 있는 메세지를 기록한다.
+func AddDeadLetterBytes(reason string, fromEid string, b []byte, reinject func(MsgPack) error) {
+	mpck, err := ParseMsgPack(b)
+	if err != nil {
+		app.ErrorLog("dead letter %s from %s, %s", reason, fromEid, err.Error())
+		return
+	}
+
+	AddDeadLetter(reason, fromEid, mpck, reinject)
+}
+
+//Redeliver는 dlver를 통해 메세지를 처음 받은 것처럼 다시 전달하는 reinject 함수를 만든다.
+func Redeliver(dlver Deliverer) func(MsgPack) error {
+	return func(mpck MsgPack) error {
+		local := func(eid string) bool {
+			if sd, ok := dlver.(ServiceDeliverer); ok && len(eid) > 0 {
+				return sd.IsLocal(eid)
+			}
+			return false
+		}
+
+		switch mpck.MsgType() {
+		case MsgTypeRequest:
+			h := ParseReqHeader(mpck.Header())
+			if h == nil {
+				return IssueErrorf("parsing error %s", string(mpck.Header()))
+			}
+
+			if local(h.ToEid) || h.Spn == app.Config.Spn {
+				return dlver.LocalRequest(h, mpck)
+			}
+			return dlver.RouteRequest(h, mpck)
+
+		case MsgTypeResponse:
+			h := ParseResHeader(mpck.Header())
+			if h == nil {
+				return IssueErrorf("parsing error %s", string(mpck.Header()))
+			}
+
+			if local(PeekFromEids(h.ToEids)) {
+				return dlver.LocalResponse(h, mpck)
+			}
+			return dlver.RouteResponse(h, mpck)
+		}
+
+		return IssueErrorf("can not redeliver message type[%c]", mpck.MsgType())
+	}
+}
+
+func (q *deadLetterQ) spillOut(dl *DeadLetter) {
+	if q.spill == nil {
+		return
+	}
+
+	if b, err := json.Marshal(dl); err == nil {
+		q.spill.Write(append(b, '\n'))
+	}
+}
+
+//List는 보관중인 dead letter를 오래된 순서로 돌려준다.
+func (q *deadLetterQ) List() []DeadLetter {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	dls := make([]DeadLetter, 0, q.l.Len())
+	for e := q.l.Front(); e != nil; e = e.Next() {
+		dls = append(dls, *e.Value.(*DeadLetter))
+	}
+
+	return dls
+}
+
+//Reinject는 no번 dead letter를 다시 보내고 목록에서 지운다.
+//다시 실패하면 새 dead letter로 기록된다.
+func (q *deadLetterQ) Reinject(no uint64) error {
+	q.lock.Lock()
+	var dl *DeadLetter
+	for e := q.l.Front(); e != nil; e = e.Next() {
+		if e.Value.(*DeadLetter).No == no {
+			dl = e.Value.(*DeadLetter)
+			if dl.reinject != nil {
+				q.l.Remove(e)
+			}
+			break
+		}
+	}
+	q.lock.Unlock()
+
+	if dl == nil {
+		return IssueErrorf("dead letter[%d] not found", no)
+	}
+
+	if dl.reinject == nil {
+		return IssueErrorf("dead letter[%d] can not be reinjected", no)
+	}
+
+	if err := dl.reinject(dl.msg); err != nil {
+		q.Add("reinject: "+err.Error(), dl.FromEid, dl.msg, dl.reinject)
+		return err
+	}
+
+	return nil
+}
+
+func deadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<h1>dead letters : %s</h1>", app.App.Eid)
+	fmt.Fprintf(w, "<table border='1'><tr><th>No</th><th>Stamp</th><th>Reason</th><th>FromEid</th><th>Type</th><th>Header</th><th>Body</th><th></th></tr>")
+
+	for _, dl := range getDeadLetterQ().List() {
+		fmt.Fprintf(w, "<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td>",
+			dl.No, dl.Stamp.Format(time.RFC3339), html.EscapeString(dl.Reason), html.EscapeString(dl.FromEid),
+			dl.MsgType, html.EscapeString(dl.Header), html.EscapeString(dl.Body))
+
+		//다시 보내는 것은 상태를 바꾸므로 link가 아닌 POST form으로 한다.
+		if dl.reinject != nil {
+			fmt.Fprintf(w, "<td><form method='post' action='/deadletter/reinject'><input type='hidden' name='no' value='%d'><input type='submit' value='reinject'></form></td></tr>", dl.No)
+		} else {
+			fmt.Fprintf(w, "<td></td></tr>")
+		}
+	}
+
+	fmt.Fprintf(w, "</table>")
+}
+
+//deadLetterReinjectHandler는 POST만 받는다. prefetch나 crawler의 GET으로 다시 보내지 않는다.
+func deadLetterReinjectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	no, err := strconv.ParseUint(r.PostFormValue("no"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid no", http.StatusBadRequest)
+		return
+	}
+
+	if err := getDeadLetterQ().Reinject(no); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/deadletter", http.StatusSeeOther)
+}
@@ -0,0 +1,198 @@
+package net
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestDeadLetterQ(t *testing.T, size int, spill bool) (*deadLetterQ, string) {
+	q := &deadLetterQ{lock: new(sync.Mutex), l: list.New(), size: size}
+	if !spill {
+		return q, ""
+	}
+
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fn := filepath.Join(dir, "deadletter.log")
+	if q.spill, err = os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.spill.Close() })
+
+	return q, fn
+}
+
+func listNos(q *deadLetterQ) []uint64 {
+	var nos []uint64
+	for _, dl := range q.List() {
+		nos = append(nos, dl.No)
+	}
+	return nos
+}
+
+//메모리에는 size만큼만 두고, 밀려난 dead letter는 spill 파일에 남긴다.
+func TestDeadLetterBound(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		adds    int
+		spill   bool
+		kept    []uint64
+		spilled []uint64
+	}{
+		{name: "under size", size: 3, adds: 2, spill: true, kept: []uint64{1, 2}},
+		{name: "oldest spilled", size: 2, adds: 4, spill: true, kept: []uint64{3, 4}, spilled: []uint64{1, 2}},
+		{name: "dropped without spill", size: 2, adds: 3, kept: []uint64{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fn := newTestDeadLetterQ(t, tt.size, tt.spill)
+
+			for i := 0; i < tt.adds; i++ {
+				q.Add("test", "e1", NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{}`)), nil)
+			}
+
+			if nos := listNos(q); !reflect.DeepEqual(nos, tt.kept) {
+				t.Fatalf("kept %v, want %v", nos, tt.kept)
+			}
+
+			if !tt.spill {
+				return
+			}
+
+			f, err := os.Open(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var spilled []uint64
+			for s := bufio.NewScanner(f); s.Scan(); {
+				var dl DeadLetter
+				if err := json.Unmarshal(s.Bytes(), &dl); err != nil {
+					t.Fatal(err)
+				}
+				if dl.Reason != "test" || dl.Header != `{"Api":"A"}` {
+					t.Fatalf("spilled %+v", dl)
+				}
+				spilled = append(spilled, dl.No)
+			}
+
+			if !reflect.DeepEqual(spilled, tt.spilled) {
+				t.Fatalf("spilled %v, want %v", spilled, tt.spilled)
+			}
+		})
+	}
+}
+
+func TestDeadLetterReinject(t *testing.T) {
+	tests := []struct {
+		name     string
+		reinject func(MsgPack) error
+		no       uint64
+		wantErr  bool
+		kept     []uint64
+	}{
+		{name: "reinjected", reinject: func(MsgPack) error { return nil }, no: 1},
+		{name: "failed again", reinject: func(MsgPack) error { return errors.New("down") }, no: 1, wantErr: true, kept: []uint64{2}},
+		{name: "no reinject", no: 1, wantErr: true, kept: []uint64{1}},
+		{name: "not found", reinject: func(MsgPack) error { return nil }, no: 9, wantErr: true, kept: []uint64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newTestDeadLetterQ(t, 10, false)
+
+			var sent []MsgPack
+			reinject := tt.reinject
+			if reinject != nil {
+				reinject = func(mpck MsgPack) error {
+					sent = append(sent, mpck)
+					return tt.reinject(mpck)
+				}
+			}
+
+			mpck := NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{}`))
+			q.Add("test", "e1", mpck, reinject)
+
+			err := q.Reinject(tt.no)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err %v, want error %v", err, tt.wantErr)
+			}
+
+			if nos := listNos(q); !reflect.DeepEqual(nos, tt.kept) {
+				t.Fatalf("kept %v, want %v", nos, tt.kept)
+			}
+
+			if tt.reinject != nil && tt.no == 1 && (len(sent) != 1 || sent[0] != mpck) {
+				t.Fatalf("reinjected %d messages", len(sent))
+			}
+		})
+	}
+}
+
+//reinject는 POST로만 한다.
+func TestDeadLetterReinjectHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		no         string //비어있으면 추가한 dead letter의 No
+		status     int
+		reinjected bool
+	}{
+		{name: "get rejected", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "post", method: http.MethodPost, status: http.StatusSeeOther, reinjected: true},
+		{name: "invalid no", method: http.MethodPost, no: "x", status: http.StatusBadRequest},
+		{name: "unknown no", method: http.MethodPost, no: "0", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reinjected bool
+			AddDeadLetter("test", "e1", NewMsgPack(MsgTypeRequest, []byte(`{"Api":"A"}`), []byte(`{}`)), func(MsgPack) error {
+				reinjected = true
+				return nil
+			})
+
+			dls := getDeadLetterQ().List()
+			no := tt.no
+			if len(no) == 0 {
+				no = strconv.FormatUint(dls[len(dls)-1].No, 10)
+			}
+
+			form := url.Values{"no": {no}}.Encode()
+			var r *http.Request
+			if tt.method == http.MethodPost {
+				r = httptest.NewRequest(tt.method, "/deadletter/reinject", strings.NewReader(form))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/deadletter/reinject?"+form, nil)
+			}
+
+			w := httptest.NewRecorder()
+			deadLetterReinjectHandler(w, r)
+
+			if w.Code != tt.status || reinjected != tt.reinjected {
+				t.Fatalf("status %d reinjected %v, want %d %v", w.Code, reinjected, tt.status, tt.reinjected)
+			}
+		})
+	}
+}
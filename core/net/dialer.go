@@ -51,7 +51,7 @@ func (dial *dialer) dial() error {
 	rwc, err := net.DialTimeout("tcp", dial.remoteAddr, time.Second*DialTimeoutSec)
 
 	if err != nil {
-		app.ErrorLog("connect to %s,", dial.remoteAddr, err.Error())
+		app.ErrorLog("connect to %s, %s", dial.remoteAddr, err.Error())
 		dial.CheckAndRedial()
 		return err
 	}
@@ -14,6 +14,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
 	"github.com/Azraid/pasque/util"
 )
@@ -99,7 +100,10 @@ func (ctxs *gridContexts) TryRemove(key string) bool {
 	return false
 }
 
-func (ctxs *gridContexts) PushAndAcquire(key string, msg *RequestMsg) (*gridContext, bool) {
+//PushAndAcquire는 key의 msgQ에 msg를 넣고, 처리할 goroutine이 없으면 context를 돌려준다.
+//msgQ가 limit을 넘으면 policy에 따라 버려진 request를 dropped로 돌려준다.
+//block policy는 기다리지 않고 reject와 같이 msg를 돌려준다. 기다리는 것은 PushWaitAndAcquire가 한다.
+func (ctxs *gridContexts) PushAndAcquire(key string, msg *RequestMsg, limit app.QueueLimit) (*gridContext, bool, *RequestMsg) {
 	ctxm := ctxs.ctxHtbl[ctxs.hash(key)]
 
 	ctx := ctxs.getNew(key)
@@ -108,13 +112,57 @@ func (ctxs *gridContexts) PushAndAcquire(key string, msg *RequestMsg) (*gridCont
 	defer ctxm.lock.RUnlock()
 
 	ctx.touched = time.Now()
-	ctx.msgQ.Push(msg) //일단 q에 넣고.
+
+	//일단 q에 넣고.
+	var dropped *RequestMsg
+	switch limit.Policy {
+	case OverloadDropOldest:
+		if v := ctx.msgQ.PushDropOldest(msg, limit.Max); v != nil {
+			dropped = v.(*RequestMsg)
+		}
+
+	default:
+		if !ctx.msgQ.PushLimit(msg, limit.Max) {
+			dropped = msg
+		}
+	}
 
 	if ok := atomic.CompareAndSwapInt32(&ctx.goRoutined, 0, 1); ok {
-		return ctx, true
+		return ctx, true, dropped
+	}
+
+	return nil, false, dropped
+}
+
+//PushWaitAndAcquire는 key의 msgQ에 자리가 날때까지 기다렸다가 넣는다.
+//기다리는 동안 ctxm.lock을 잡지 않으므로 TryRemove나 다른 key는 막히지 않는다.
+//context를 잡을때마다 start를 부른다. 넣지 못했어도 잡았으면 처리할 goroutine이 없으므로 띄워야 자리가 난다.
+func (ctxs *gridContexts) PushWaitAndAcquire(key string, msg *RequestMsg, max int, start func(ctx *gridContext, ok bool)) {
+	limit := app.QueueLimit{Max: max, Policy: OverloadReject}
+	for {
+		ctx, ok, dropped := ctxs.PushAndAcquire(key, msg, limit)
+		start(ctx, ok)
+		if dropped == nil {
+			return
+		}
+
+		//기다리는 사이에 context가 지워지면 새 context는 비어 있으므로 바로 다시 넣는다.
+		ctxs.getNew(key).msgQ.WaitRoom(max)
+	}
+}
+
+//Depth는 모든 grid key의 msgQ에 쌓여있는 request 수이다.
+func (ctxs *gridContexts) Depth() int {
+	depth := 0
+	for _, cv := range ctxs.ctxHtbl {
+		cv.lock.RLock()
+		for _, v := range cv.ctxMaps {
+			depth += v.msgQ.Len()
+		}
+		cv.lock.RUnlock()
 	}
 
-	return nil, false
+	return depth
 }
 
 func (ctx *gridContext) Release() {
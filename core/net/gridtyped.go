@@ -0,0 +1,94 @@
+/********************************************************************************
+* gridtyped.go
+* generic을 사용한 typed grid handler.
+* request body를 Req로 decode하고, key별 grid data를 *S로 넘겨준다.
+* grid data가 없는 key에 대해 RegisterGridHandlerT는 nil을 넘기고,
+* RegisterGridCreateHandlerT는 *S 타입으로 등록된 생성자로 만들어서 넘긴다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/Azraid/pasque/app"
+)
+
+type gridConstructor interface {
+	setGridConstructor(t reflect.Type, ctor func(key string) interface{})
+	newGridData(t reflect.Type, key string) interface{}
+}
+
+func gridType[S any]() reflect.Type {
+	return reflect.TypeOf((*S)(nil))
+}
+
+//RegisterGridConstructor는 *S grid data가 없을때 RegisterGridCreateHandlerT가 사용할 생성자를 등록한다.
+//S 타입마다 따로 등록하며, 등록하지 않으면 new(S)를 사용한다.
+func RegisterGridConstructor[S any](cli Client, ctor func(key string) *S) {
+	if gc, ok := cli.(gridConstructor); ok {
+		gc.setGridConstructor(gridType[S](), func(key string) interface{} {
+			return ctor(key)
+		})
+	}
+}
+
+//RegisterGridHandlerT는 body를 Req로 decode하고, grid data를 *S로 넘겨준다.
+//key에 grid data가 없으면 gd는 nil이다. 조회만 하는 handler는 nil을 그대로 돌려주면 아무것도 저장되지 않는다.
+//handler가 돌려준 *S는 grid data로 다시 저장되며, nil을 돌려주면 grid data가 삭제된다.
+//응답은 RegisterGridHandlerR과 같이 framework가 한번만 보낸다.
+func RegisterGridHandlerT[S any, Req any](cli Client, api string, handler func(cli Client, req *RequestMsg, gd *S, body *Req) (*S, interface{}, NError)) {
+	registerGridHandlerT(cli, api, false, handler)
+}
+
+//RegisterGridCreateHandlerT는 RegisterGridHandlerT와 같지만 grid data가 없으면 생성자로 만들어서 넘긴다.
+//grid data를 처음 만드는 api(join, create 등)에만 사용한다.
+func RegisterGridCreateHandlerT[S any, Req any](cli Client, api string, handler func(cli Client, req *RequestMsg, gd *S, body *Req) (*S, interface{}, NError)) {
+	registerGridHandlerT(cli, api, true, handler)
+}
+
+func registerGridHandlerT[S any, Req any](cli Client, api string, create bool, handler func(cli Client, req *RequestMsg, gd *S, body *Req) (*S, interface{}, NError)) {
+	cli.RegisterGridHandlerR(api, func(cli Client, req *RequestMsg, gridData interface{}) (interface{}, interface{}, NError) {
+		var body Req
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			app.ErrorLog("%s %s %s", req.Header.TraceTag(), api, err.Error())
+			return gridData, nil, CoRaiseNError(NErrorParsingError, 1, err.Error())
+		}
+
+		if gridData == nil && create {
+			gridData = newGridData[S](cli, req.Header.Key)
+		}
+
+		var gd *S
+		if gridData != nil {
+			var ok bool
+			if gd, ok = gridData.(*S); !ok {
+				app.ErrorLog("%s %s grid data type mismatch, %T", req.Header.TraceTag(), api, gridData)
+				return gridData, nil, CoRaiseNError(NErrorInternal, 1, fmt.Sprintf("grid data type mismatch, %T", gridData))
+			}
+		}
+
+		newGd, resBody, nerr := handler(cli, req, gd, &body)
+		//nil *S가 non-nil interface로 저장되지 않도록 한다.
+		if newGd == nil {
+			return nil, resBody, nerr
+		}
+
+		return newGd, resBody, nerr
+	})
+}
+
+func newGridData[S any](cli Client, key string) interface{} {
+	if gc, ok := cli.(gridConstructor); ok {
+		if gd := gc.newGridData(gridType[S](), key); gd != nil {
+			return gd
+		}
+	}
+
+	return new(S)
+}
@@ -0,0 +1,95 @@
+package net
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testGridA struct {
+	Key   string
+	Count int
+}
+
+type testGridB struct {
+	Name string
+}
+
+type testGridReq struct {
+	Write bool
+}
+
+func TestRegisterGridHandlerT(t *testing.T) {
+	tests := []struct {
+		name      string
+		create    bool
+		write     bool
+		stored    interface{}
+		wantNil   bool
+		wantCount int
+	}{
+		{"read unknown key", false, false, nil, true, 0},
+		{"write unknown key without create", false, true, nil, true, 0},
+		{"create unknown key", true, true, nil, false, 1},
+		{"create unknown key read only", true, false, nil, false, 0},
+		{"existing key", false, true, &testGridA{Key: "k", Count: 5}, false, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newTestClient()
+			RegisterGridConstructor(cli, func(key string) *testGridA { return &testGridA{Key: key} })
+			RegisterGridConstructor(cli, func(key string) *testGridB { return &testGridB{Name: "b-" + key} })
+
+			handler := func(cli Client, req *RequestMsg, gd *testGridA, body *testGridReq) (*testGridA, interface{}, NError) {
+				if gd != nil && body.Write {
+					gd.Count++
+				}
+				return gd, nil, nil
+			}
+
+			if tt.create {
+				RegisterGridCreateHandlerT(cli, "Api", handler)
+			} else {
+				RegisterGridHandlerT(cli, "Api", handler)
+			}
+
+			body, _ := json.Marshal(testGridReq{Write: tt.write})
+			req := &RequestMsg{Header: ReqHeader{Key: "k", Api: "Api"}, Body: body}
+
+			got := cli.reqQ.gridHandlers["Api"](cli, req, tt.stored)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("stored grid data = %#v, want nil", got)
+				}
+				return
+			}
+
+			gd, ok := got.(*testGridA)
+			if !ok {
+				t.Fatalf("stored grid data = %T, want *testGridA", got)
+			}
+			if gd.Key != "k" || gd.Count != tt.wantCount {
+				t.Fatalf("stored grid data = %+v, want key k count %d", gd, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRegisterGridConstructorPerType(t *testing.T) {
+	cli := newTestClient()
+	RegisterGridConstructor(cli, func(key string) *testGridA { return &testGridA{Key: "a-" + key} })
+	RegisterGridConstructor(cli, func(key string) *testGridB { return &testGridB{Name: "b-" + key} })
+
+	if gd, ok := newGridData[testGridA](cli, "k").(*testGridA); !ok || gd.Key != "a-k" {
+		t.Fatalf("newGridData[testGridA] = %#v", gd)
+	}
+
+	if gd, ok := newGridData[testGridB](cli, "k").(*testGridB); !ok || gd.Name != "b-k" {
+		t.Fatalf("newGridData[testGridB] = %#v", gd)
+	}
+
+	type noCtor struct{ V int }
+	if _, ok := newGridData[noCtor](cli, "k").(*noCtor); !ok {
+		t.Fatalf("newGridData without constructor must return new(S)")
+	}
+}
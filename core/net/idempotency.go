@@ -0,0 +1,216 @@
+/********************************************************************************
+* idempotency.go
+* IdempotencyKey가 있는 request의 응답을 provider에서 일정 시간 보관한다.
+* 같은 key의 request가 다시 오면 handler를 부르지 않고 보관한 응답을 돌려주고,
+* 아직 처리중이면 처리가 끝났을때 같은 응답을 보낸다.
+* tcgate 재접속이나 unsentQ 재전송, retry policy로 같은 request가 두번 와도
+* CreateRoom, MatchPlay 같은 api가 한번만 처리되도록 한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const idemCleanTimerSec = 10
+
+type idemCtxKey struct{}
+
+type idemEntry struct {
+	done    bool
+	errCode int
+	errText string
+	body    []byte
+	stamp   time.Time
+	waiters []*RequestMsg //처리중에 들어온 중복 request
+}
+
+type idemCache struct {
+	lock       *sync.Mutex
+	entries    map[string]*idemEntry
+	window     time.Duration
+	maxEntries int
+	cli        *client
+}
+
+//WithIdempotencyKey는 key를 ctx에 담는다. 이 ctx로 SendReqCtx를 하면 header에 key가 실린다.
+//같은 key로 다시 보낸 request는 provider가 처음 응답을 돌려준다.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idemCtxKey{}, key)
+}
+
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idemCtxKey{}).(string)
+	return key, ok && len(key) > 0
+}
+
+func newIdemCache(cli *client) *idemCache {
+	c := &idemCache{
+		lock:    new(sync.Mutex),
+		entries: make(map[string]*idemEntry),
+		window:  time.Duration(IdempotencyWindowSec) * time.Second,
+		cli:     cli,
+	}
+
+	cfg := app.Config.Global.Idempotency
+	if cfg.WindowSec > 0 {
+		c.window = time.Duration(cfg.WindowSec) * time.Second
+	}
+	c.maxEntries = cfg.MaxEntries
+
+	RegisterQueueDepth("idempotency", app.QueueLimit{Max: c.maxEntries}, c.Len)
+	go goIdemClean(c)
+	return c
+}
+
+//idemKey는 같은 key를 다른 api나 grid key에서 써도 섞이지 않도록 한다.
+func idemKey(h *ReqHeader) string {
+	return h.Api + "|" + h.Key + "|" + h.IdempotencyKey
+}
+
+//Begin은 msg가 중복 request인지 확인한다. 중복이면 응답을 처리하고 true를 돌려준다.
+//처음 온 request이면 처리중으로 기록하고 false를 돌려준다.
+//stream request는 중간 frame을 보관할 수 없으므로 중복 검사를 하지 않는다.
+func (c *idemCache) Begin(msg *RequestMsg) bool {
+	if len(msg.Header.IdempotencyKey) == 0 || msg.Header.Stream {
+		return false
+	}
+
+	key := idemKey(&msg.Header)
+	now := time.Now()
+
+	c.lock.Lock()
+	e, ok := c.entries[key]
+	if ok && now.Sub(e.stamp) > c.window {
+		delete(c.entries, key)
+		ok = false
+	}
+
+	if !ok {
+		if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+			c.lock.Unlock()
+			app.ErrorLog("%s idempotency cache is full, api[%s] key[%s]", msg.Header.TraceTag(), msg.Header.Api, msg.Header.Key)
+			return false
+		}
+
+		//noti는 응답이 없으므로 바로 끝난 것으로 둔다.
+		c.entries[key] = &idemEntry{done: msg.Header.TxnNo == 0, stamp: now}
+		c.lock.Unlock()
+		return false
+	}
+
+	if !e.done {
+		e.waiters = append(e.waiters, msg)
+		c.lock.Unlock()
+		app.DebugLog("%s duplicated request in progress, api[%s] idem[%s]", msg.Header.TraceTag(), msg.Header.Api, msg.Header.IdempotencyKey)
+		return true
+	}
+
+	errCode, errText, body := e.errCode, e.errText, e.body
+	c.lock.Unlock()
+
+	app.DebugLog("%s duplicated request replayed, api[%s] idem[%s]", msg.Header.TraceTag(), msg.Header.Api, msg.Header.IdempotencyKey)
+	c.reply(msg, errCode, errText, body)
+	return true
+}
+
+//Complete는 req의 응답을 보관하고 기다리던 중복 request에 같은 응답을 보낸다.
+//일시적인 실패는 보관하지 않아서 다시 보낸 request가 처리될 수 있게 한다.
+func (c *idemCache) Complete(req *RequestMsg, errCode int, errText string, body []byte) {
+	if len(req.Header.IdempotencyKey) == 0 {
+		return
+	}
+
+	key := idemKey(&req.Header)
+
+	c.lock.Lock()
+	e, ok := c.entries[key]
+	if !ok || e.done {
+		c.lock.Unlock()
+		return
+	}
+
+	waiters := e.waiters
+	e.waiters = nil
+
+	if isBreakerFailure(errCode) || errCode == NErrorInternal || errCode == NErrorCanceled {
+		delete(c.entries, key)
+	} else {
+		e.done = true
+		e.errCode, e.errText, e.body = errCode, errText, body
+		e.stamp = time.Now()
+	}
+	c.lock.Unlock()
+
+	for _, w := range waiters {
+		c.reply(w, errCode, errText, body)
+	}
+}
+
+//HasWaiters는 msg와 같은 key로 다시 온 request가 처리를 기다리고 있는지 확인한다.
+func (c *idemCache) HasWaiters(msg *RequestMsg) bool {
+	if len(msg.Header.IdempotencyKey) == 0 {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[idemKey(&msg.Header)]
+	return ok && len(e.waiters) > 0
+}
+
+func (c *idemCache) reply(msg *RequestMsg, errCode int, errText string, body []byte) {
+	if msg.Header.TxnNo == 0 || !msg.markReplied() {
+		return
+	}
+
+	header := ResHeader{ToEids: msg.Header.FromEids, TxnNo: msg.Header.TxnNo, ErrCode: errCode, ErrText: errText, TraceID: msg.Header.TraceID}
+	hb, err := json.Marshal(header)
+	if err != nil {
+		app.ErrorLog("%s idempotency reply error %s", msg.Header.TraceTag(), err.Error())
+		return
+	}
+
+	c.cli.muxio.Write(NewMsgPack(MsgTypeResponse, hb, body).Bytes(), true)
+}
+
+func (c *idemCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries)
+}
+
+func (c *idemCache) clean(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k, e := range c.entries {
+		//처리중인 request는 handler가 응답하지 않더라도 window가 지나면 지운다.
+		if now.Sub(e.stamp) > c.window {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func goIdemClean(c *idemCache) {
+	defer app.DumpRecover()
+
+	ticker := time.NewTicker(time.Second * idemCleanTimerSec)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		c.clean(now)
+	}
+}
@@ -0,0 +1,198 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReplay(t *testing.T) {
+	const (
+		begin    = "begin"
+		complete = "complete"
+		expire   = "expire"
+	)
+
+	type step struct {
+		op     string
+		req    int //같은 번호는 같은 RequestMsg
+		api    string
+		txnNo  uint64
+		stream bool
+		dup    bool   //begin이 중복으로 처리했는지
+		code   int    //complete의 errCode
+		body   string //complete의 body
+	}
+
+	type reply struct {
+		txnNo uint64
+		code  int
+		body  string
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		steps      []step
+		replies    []reply
+	}{
+		{
+			name: "first request is processed",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+			},
+		},
+		{
+			name: "completed request is replayed",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, body: `{"n":1}`},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+			},
+			replies: []reply{{2, NErrorSucess, `{"n":1}`}},
+		},
+		{
+			name: "business error is replayed",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, code: NErrorNotImplemented},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+			},
+			replies: []reply{{2, NErrorNotImplemented, ""}},
+		},
+		{
+			name: "duplicate in progress waits for completion",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+				{op: begin, req: 3, api: "A", txnNo: 3, dup: true},
+				{op: complete, req: 1, body: `"ok"`},
+			},
+			replies: []reply{{2, NErrorSucess, `"ok"`}, {3, NErrorSucess, `"ok"`}},
+		},
+		{
+			name: "transient failure is not kept",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, code: NErrorServerBusy},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: false},
+			},
+		},
+		{
+			name: "transient failure is sent to waiters",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+				{op: complete, req: 1, code: NErrorTimeout},
+				{op: begin, req: 3, api: "A", txnNo: 3, dup: false},
+			},
+			replies: []reply{{2, NErrorTimeout, ""}},
+		},
+		{
+			name: "expired entry is processed again",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, body: `1`},
+				{op: expire},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: false},
+			},
+		},
+		{
+			name: "same key on another api",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, body: `1`},
+				{op: begin, req: 2, api: "B", txnNo: 2, dup: false},
+			},
+		},
+		{
+			name: "stream request is not checked",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, stream: true, dup: false},
+				{op: begin, req: 2, api: "A", txnNo: 2, stream: true, dup: false},
+			},
+		},
+		{
+			name: "duplicate noti is dropped",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 0, dup: false},
+				{op: begin, req: 2, api: "A", txnNo: 0, dup: true},
+			},
+		},
+		{
+			name: "replied once per request",
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: complete, req: 1, body: `1`},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+				{op: begin, req: 2, api: "A", txnNo: 2, dup: true},
+			},
+			replies: []reply{{2, NErrorSucess, `1`}},
+		},
+		{
+			name:       "full cache processes without key",
+			maxEntries: 1,
+			steps: []step{
+				{op: begin, req: 1, api: "A", txnNo: 1, dup: false},
+				{op: begin, req: 2, api: "B", txnNo: 2, dup: false},
+				{op: complete, req: 2, body: `2`},
+				{op: begin, req: 3, api: "B", txnNo: 3, dup: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, sentQ := newTestMuxClient()
+			c := cli.reqQ.idem
+			c.maxEntries = tt.maxEntries
+
+			reqs := make(map[int]*RequestMsg)
+			for i, s := range tt.steps {
+				switch s.op {
+				case begin:
+					msg, ok := reqs[s.req]
+					if !ok {
+						msg = &RequestMsg{}
+						msg.Header.Api = s.api
+						msg.Header.TxnNo = s.txnNo
+						msg.Header.Stream = s.stream
+						msg.Header.FromEids = []string{"caller"}
+						msg.Header.IdempotencyKey = "idem"
+						reqs[s.req] = msg
+					}
+
+					if dup := c.Begin(msg); dup != s.dup {
+						t.Fatalf("step %d Begin = %v, want %v", i, dup, s.dup)
+					}
+
+				case complete:
+					c.Complete(reqs[s.req], s.code, "", []byte(s.body))
+
+				case expire:
+					c.clean(time.Now().Add(c.window + time.Second))
+				}
+			}
+
+			mpcks := sentQ.msgPacks(t)
+			if len(mpcks) != len(tt.replies) {
+				t.Fatalf("replies %d, want %d", len(mpcks), len(tt.replies))
+			}
+
+			for i, mpck := range mpcks {
+				h := ParseResHeader(mpck.Header())
+				if h == nil {
+					t.Fatalf("reply %d header parse error", i)
+				}
+
+				want := tt.replies[i]
+				if h.TxnNo != want.txnNo || h.ErrCode != want.code || string(mpck.Body()) != want.body {
+					t.Errorf("reply %d = txn %d code %d body %q, want %+v", i, h.TxnNo, h.ErrCode, mpck.Body(), want)
+				}
+
+				if len(h.ToEids) != 1 || h.ToEids[0] != "caller" {
+					t.Errorf("reply %d ToEids = %v", i, h.ToEids)
+				}
+			}
+		})
+	}
+}
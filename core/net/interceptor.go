@@ -0,0 +1,101 @@
+/********************************************************************************
+* interceptor.go
+* handler 호출을 감싸는 interceptor들.
+* Client.Use()로 등록하며, 등록한 순서대로 바깥쪽부터 감싼다.
+* panic recovery는 interceptor가 아니라 reqQ.safeInvoke가 chain 전체를 감싸서 맡는다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	"github.com/Azraid/pasque/util"
+)
+
+//Interceptor는 grid/rand handler 호출을 감싼다.
+//next()를 호출하지 않으면 handler는 실행되지 않으므로, 이 경우 interceptor가 직접 응답해야 한다.
+//handler나 interceptor의 panic은 safeInvoke가 잡아서 NErrorInternal로 응답하므로 recover하지 않아도 된다.
+type Interceptor func(cli Client, req *RequestMsg, next func())
+
+func (q *reqQ) Use(ic Interceptor) {
+	q.interceptors = append(q.interceptors, ic)
+}
+
+func (q *reqQ) invoke(msg *RequestMsg, handle func()) {
+	next := handle
+	for i := len(q.interceptors) - 1; i >= 0; i-- {
+		ic, inner := q.interceptors[i], next
+		next = func() {
+			ic(q.cli, msg, inner)
+		}
+	}
+
+	next()
+}
+
+//LogInterceptor는 request 처리를 info log로 남긴다.
+func LogInterceptor() Interceptor {
+	return func(cli Client, req *RequestMsg, next func()) {
+		start := time.Now()
+		next()
+		app.InfoLog("%s %s from %s(%s) %v", req.Header.TraceTag(), req.Header.Api, req.Header.FromSpn,
+			PeekFromEids(req.Header.FromEids), time.Since(start))
+	}
+}
+
+//LatencyInterceptor는 api별 처리시간을 onDone으로 넘겨준다.
+func LatencyInterceptor(onDone func(api string, elapsed time.Duration)) Interceptor {
+	return func(cli Client, req *RequestMsg, next func()) {
+		start := time.Now()
+		next()
+		onDone(req.Header.Api, time.Since(start))
+	}
+}
+
+//AllowFromSpn은 허용된 spn에서 온 request만 처리한다.
+func AllowFromSpn(spns ...string) Interceptor {
+	return func(cli Client, req *RequestMsg, next func()) {
+		for _, v := range spns {
+			if util.StrCmpI(v, req.Header.FromSpn) {
+				next()
+				return
+			}
+		}
+
+		app.ErrorLog("%s %s not allowed from spn[%s]", req.Header.TraceTag(), req.Header.Api, req.Header.FromSpn)
+		cli.SendResWithError(req, CoRaiseNError(NErrorNoPermission, 1, fmt.Sprintf("from %s", req.Header.FromSpn)), nil)
+	}
+}
+
+//ValidateBody는 api msg 타입(XxxMsg{})으로 body를 검사한다.
+//json parsing이 안되거나 required 필드가 없으면 NErrorParsingError로 응답한다.
+func ValidateBody(msgs ...interface{}) Interceptor {
+	types := make(map[string]reflect.Type)
+	for _, v := range msgs {
+		types[GetNameOfApiMsg(v)] = reflect.TypeOf(v)
+	}
+
+	return func(cli Client, req *RequestMsg, next func()) {
+		t, ok := types[req.Header.Api]
+		if !ok {
+			next()
+			return
+		}
+
+		body := reflect.New(t).Interface()
+		if err := UnmarshalMsg(req.Body, body); err != nil {
+			app.ErrorLog("%s %s %s", req.Header.TraceTag(), req.Header.Api, err.Error())
+			cli.SendResWithError(req, CoRaiseNError(NErrorParsingError, 1, err.Error()), nil)
+			return
+		}
+
+		next()
+	}
+}
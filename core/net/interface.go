@@ -18,6 +18,7 @@
 package net
 
 import (
+	"context"
 	"net"
 	"time"
 )
@@ -27,6 +28,7 @@ const (
 	ConnStatusConnected = iota
 	ConnStatusDisconnected
 	ConnStatusShutdown
+	ConnStatusHandshaking //Register한 뒤 handshake를 마칠때까지. Connect, Accept 메세지만 보낼 수 있다.
 )
 
 const (
@@ -38,6 +40,8 @@ type Topology struct {
 	Spn           string
 	FederatedKey  string
 	FederatedApis []string
+	Topics        []string
+	Subscribers   map[string][]string //gate가 router에 알리는 topic별 구독 provider
 }
 
 type GridData interface {
@@ -67,6 +71,16 @@ type NetWriter interface {
 	Write(b []byte, isLogging bool) error
 }
 
+//BuffersWriter는 frame 조각을 이어붙이지 않고 보낼 수 있는 NetWriter이다.
+type BuffersWriter interface {
+	WriteBuffers(bufs net.Buffers, isLogging bool) error
+}
+
+//MsgPackWriter는 codec, 압축을 해야 해도 frame을 이어붙이지 않고 header, body에서 바로 바꿔 보내는 NetWriter이다.
+type MsgPackWriter interface {
+	WriteMsgPack(mpck MsgPack, isLogging bool) error
+}
+
 type Dialer interface {
 	CheckAndRedial()
 }
@@ -74,6 +88,7 @@ type Dialer interface {
 type Dispatcher interface {
 	OnRequest(rawHeader []byte, rawBody []byte) error
 	OnResponse(rawHeader []byte, rawBody []byte) error
+	OnCancel(rawHeader []byte, rawBody []byte) error
 }
 
 //Client 는 Conn과 Dispatcher 객체를 포함하고 있다.
@@ -83,23 +98,41 @@ type Client interface {
 	Dial(topgy Topology) error
 	RegisterGridHandler(api string, handler func(cli Client, msg *RequestMsg, gridData interface{}) interface{})
 	RegisterRandHandler(api string, handler func(cli Client, msg *RequestMsg))
+	RegisterGridHandlerR(api string, handler func(cli Client, msg *RequestMsg, gridData interface{}) (interface{}, interface{}, NError))
+	RegisterRandHandlerR(api string, handler func(cli Client, msg *RequestMsg) (interface{}, NError))
+	Use(ic Interceptor)
+	Subscribe(topic string, handler func(cli Client, msg *RequestMsg))
 	ListGridApis() []string
 	ListRandApis() []string
+	ListTopics() []string
 	SendReq(spn string, api string, body interface{}) (res *ResponseMsg, err error)
+	SendReqCtx(ctx context.Context, spn string, api string, body interface{}) (res *ResponseMsg, err error)
 	SendNoti(spn string, api string, body interface{}) (err error)
+	Publish(topic string, body interface{}) (err error)
+	Broadcast(spn string, api string, body interface{}) (err error)
+	ScatterGather(spn string, api string, body interface{}) (results []ScatterResult, nerr NError)
+	ScatterGatherCtx(ctx context.Context, spn string, api string, body interface{}) (results []ScatterResult, nerr NError)
 	SendReqDirect(spn string, gateEid string, eid string, api string, body interface{}) (res *ResponseMsg, err error)
+	SendReqDirectCtx(ctx context.Context, spn string, gateEid string, eid string, api string, body interface{}) (res *ResponseMsg, err error)
 	SendNotiDirect(spn string, gateEid string, eid string, api string, body interface{}) (err error)
 	SendRes(req *RequestMsg, body interface{}) (err error)
 	SendResWithError(req *RequestMsg, nerr NError, body interface{}) (err error)
+	SendReqStream(ctx context.Context, spn string, api string, body interface{}) (*ResponseStream, error)
+	SendResStream(req *RequestMsg, body interface{}) error
+	EndResStream(req *RequestMsg) error
 
 	LoopbackReq(api string, body interface{}) (res *ResponseMsg, err error)
+	LoopbackReqCtx(ctx context.Context, api string, body interface{}) (res *ResponseMsg, err error)
 	LoopbackNoti(api string, body interface{}) (err error)
 	SetGridContextTimeout(timeoutSec uint32)
+	SetRetryPolicy(spn string, api string, policy RetryPolicy)
 }
 
 type Proxy interface {
 	Dial(toplgy Topology) error
+	Advertise(toplgy Topology) error
 	Send(msg MsgPack) error
+	SendResponse(h *ResHeader, msg MsgPack) error
 }
 
 type Stub interface {
@@ -136,14 +169,21 @@ type Federator interface {
 	OnAccept(eid string, toplgy *Topology) error
 }
 
+//Unsubscriber는 연결이 끊어진 remote의 topic 구독을 지우는 Deliverer이다.
+type Unsubscriber interface {
+	Unsubscribe(eid string)
+}
+
 type UnsentQ interface {
 	Register(wc NetWriter)
 	Add(b []byte)
 	SendAll()
+	Len() int
 }
 
 type MsgPack interface {
 	Bytes() []byte
+	Buffers() net.Buffers
 	MsgType() byte
 	Header() []byte
 	Body() []byte
@@ -0,0 +1,146 @@
+package net
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+	"github.com/Azraid/pasque/util"
+)
+
+//TestMain은 app.Config가 있어야 동작하는 코드를 위해 빈 설정을 읽는다.
+//각 test는 필요한 설정을 app.Config.Global에 직접 바꾸고 끝나면 되돌린다.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "pasque-net")
+	if err != nil {
+		panic(err)
+	}
+
+	fn := filepath.Join(dir, "system.json")
+	cfg := `{"ListenPortRange" : "1-1", "ConsolePortRange" : "1-1", "Log" : {}}`
+	if err := ioutil.WriteFile(fn, []byte(cfg), 0666); err != nil {
+		panic(err)
+	}
+
+	if err := app.LoadConfig(fn, "test", ""); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+//newTestClient는 gate에 접속하지 않는 client를 만든다. reqQ로 handler를 직접 호출할때 사용한다.
+func newTestClient() *client {
+	cli := &client{}
+	cli.reqQ = newReqQ(cli)
+	cli.resQ = newResQ(cli, TxnTimeoutSec)
+	cli.rsl = newResilience()
+	return cli
+}
+
+//testUnsentQ는 보내지 못한 frame을 모아둔다. io가 없는 muxio로 보낸 frame을 확인할때 쓴다.
+type testUnsentQ struct {
+	lock   sync.Mutex
+	frames [][]byte
+}
+
+func (q *testUnsentQ) Register(wc NetWriter) {}
+func (q *testUnsentQ) SendAll()              {}
+
+func (q *testUnsentQ) Add(b []byte) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.frames = append(q.frames, b)
+}
+
+func (q *testUnsentQ) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.frames)
+}
+
+//msgPacks는 모아둔 frame을 MsgPack으로 돌려준다.
+func (q *testUnsentQ) msgPacks(t *testing.T) []MsgPack {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var mpcks []MsgPack
+	for _, b := range q.frames {
+		mpck, err := ParseMsgPack(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mpcks = append(mpcks, mpck)
+	}
+
+	return mpcks
+}
+
+//testNetIO는 보낸 frame을 모아두는 NetIO이다. Read는 쓰지 않는다.
+type testNetIO struct {
+	lock   sync.Mutex
+	frames [][]byte
+}
+
+func (rw *testNetIO) Write(b []byte, isLogging bool) error {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.frames = append(rw.frames, b)
+	return nil
+}
+
+func (rw *testNetIO) Close()                              {}
+func (rw *testNetIO) IsConnected() bool                   { return true }
+func (rw *testNetIO) Register(rwc net.Conn)               {}
+func (rw *testNetIO) AddCloseEvent(onClose func())        {}
+func (rw *testNetIO) Read() (byte, []byte, []byte, error) { select {} }
+
+//msgTypes는 보낸 frame의 type을 순서대로 돌려준다.
+func (rw *testNetIO) msgTypes(t *testing.T) []byte {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	var types []byte
+	for _, b := range rw.frames {
+		mpck, err := ParseMsgPack(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, mpck.MsgType())
+	}
+
+	return types
+}
+
+//newTestMuxIO는 n개의 testNetIO로 보내는 multiplexerIO를 만든다.
+func newTestMuxIO(n int) (*multiplexerIO, []*testNetIO) {
+	muxio := &multiplexerIO{ios: util.NewRandSet(), lock: new(sync.RWMutex), unsentQ: &testUnsentQ{}}
+
+	var rws []*testNetIO
+	for i := 0; i < n; i++ {
+		rw := &testNetIO{}
+		rws = append(rws, rw)
+		muxio.ios.Add(&netIO{eid: fmt.Sprintf("remote%d", i), rw: rw})
+	}
+
+	return muxio, rws
+}
+
+//newTestMuxClient는 보내는 frame을 testUnsentQ에 모으는 client를 만든다.
+func newTestMuxClient() (*client, *testUnsentQ) {
+	cli := newTestClient()
+	sentQ := &testUnsentQ{}
+	cli.muxio = &multiplexerIO{ios: util.NewRandSet(), lock: new(sync.RWMutex), disp: cli, unsentQ: sentQ}
+	return cli, sentQ
+}
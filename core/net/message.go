@@ -14,10 +14,15 @@
 package net
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"reflect"
+	"sync/atomic"
+	"time"
 
+	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
 )
 
@@ -28,27 +33,58 @@ const (
 	MsgTypePing     byte = 'P'
 	MsgTypeRequest  byte = 'S'
 	MsgTypeResponse byte = 'R'
+	MsgTypeCancel   byte = 'X'
+	MsgTypeChunk    byte = 'K' //큰 body의 앞부분, 마지막 조각은 원래 type의 frame으로 보낸다.
+
+	MsgFlagCompressed byte = 0x80 //type byte에 더하면 body가 deflate로 압축된 frame이다.
 )
 
 const MaxBufferLength = 1 + 4 + 1024 + 5 + 65535
 
+const (
+	ChunkBodyLength          = 60000            //frame 하나에 싣는 body 크기
+	DefaultMaxMessageSize    = 16 * 1024 * 1024 //chunk로 나눠 보내는 body의 최대 크기
+	DefaultCompressThreshold = 4096             //이 크기보다 큰 body를 압축한다.
+)
+
+//msgPack은 header와 body를 따로 들고 있다가 보낼때 frame을 만든다.
+//frames는 frame head와 body 조각을 복사없이 나열한 것이고, buffer는 Bytes()가 한번에 이어붙인 것이다.
+//header만 바뀌면 head만 다시 만들고 body는 받은 slice를 그대로 보낸다.
 type msgPack struct {
 	msgType byte
 	header  []byte
 	body    []byte
+	frames  net.Buffers
 	buffer  []byte
 	changed bool
+	err     error //build 에러. 보낼 수 없는 메세지이다.
+}
+
+const (
+	frameHeadLen    = 7  //'/' + type + header 길이 5자리
+	frameBodyLenLen = 10 //body 길이 10자리
+)
+
+//ChunkHeader는 chunk frame의 header이다. Total은 전체 body 크기이다.
+type ChunkHeader struct {
+	Total int
 }
 
 type ConnHeader struct {
-	Eid       string `json:",,omitempty"`
-	Federated bool   `json:",,omitempty"`
+	Eid        string   `json:",,omitempty"`
+	Federated  bool     `json:",,omitempty"`
+	Version    int      `json:",,omitempty"` //지원하는 가장 높은 protocol version
+	MinVersion int      `json:",,omitempty"` //지원하는 가장 낮은 protocol version
+	Caps       []string `json:",,omitempty"` //지원하는 capability
+	Codecs     []string `json:",,omitempty"` //사용할 수 있는 codec, 우선순위 순서
 }
 
 type ConnBody struct {
-	Spn           string   `json:",,omitempty"`
-	FederatedKey  string   `json:",,omitempty"`
-	FederatedApis []string `json:",,omitempty"`
+	Spn           string              `json:",,omitempty"`
+	FederatedKey  string              `json:",,omitempty"`
+	FederatedApis []string            `json:",,omitempty"`
+	Topics        []string            `json:",,omitempty"`
+	Subscribers   map[string][]string `json:",,omitempty"`
 }
 
 type AccptHeader struct {
@@ -57,8 +93,11 @@ type AccptHeader struct {
 }
 
 type AccptBody struct {
-	Eid       string `json:",,omitempty"`
-	RemoteEid string `json:",,omitempty"`
+	Eid       string   `json:",,omitempty"`
+	RemoteEid string   `json:",,omitempty"`
+	Version   int      `json:",,omitempty"` //정해진 protocol version
+	Caps      []string `json:",,omitempty"` //둘 다 지원하는 capability
+	Codec     string   `json:",,omitempty"` //접속 이후 사용할 codec, 없으면 json
 }
 
 type PingHeader struct {
@@ -96,11 +135,45 @@ type ReqHeader struct {
 	FromEids  []string `json:",,omitempty"`
 	FromSpn   string   `json:",,omitempty"`
 	ToGateEid string   `json:",,omitempty"`
+	Topic     string   `json:",,omitempty"` //Publish된 메세지는 Spn 대신 Topic으로 라우팅된다.
+	TopicEids []string `json:",,omitempty"` //router가 이 gate에서 publish를 전달하도록 고른 provider, 없으면 구독 provider 모두
+	Fanout    bool     `json:",,omitempty"` //sgate에서 key 분산하지 않는다. ToEid가 없으면 모든 provider에게 보낸다.
+	Deadline  int64    `json:",,omitempty"` //UnixNano, 0이면 deadline 없음
+	Stream    bool     `json:",,omitempty"` //caller가 여러개의 response frame을 받는다.
+
+	IdempotencyKey string `json:",,omitempty"` //같은 key의 request는 provider에서 한번만 처리된다.
+
+	TraceID      string `json:",,omitempty"`
+	SpanID       string `json:",,omitempty"`
+	ParentSpanID string `json:",,omitempty"`
 }
 
 type RequestMsg struct {
-	Header ReqHeader
-	Body   json.RawMessage
+	Header   ReqHeader
+	Body     json.RawMessage
+	replied  int32
+	errCode  int32           //보낸 응답의 ErrCode, span에 남긴다.
+	canceled int32           //caller가 cancel 메세지로 포기했다.
+	ctx      context.Context //caller가 cancel하면 Done이 된다.
+	cancel   context.CancelFunc
+}
+
+//markReplied는 처음 응답하는 경우에만 true를 돌려준다.
+func (msg *RequestMsg) markReplied() bool {
+	return atomic.CompareAndSwapInt32(&msg.replied, 0, 1)
+}
+
+func (msg *RequestMsg) IsReplied() bool {
+	return atomic.LoadInt32(&msg.replied) == 1
+}
+
+func (msg *RequestMsg) setReplyCode(errCode int) {
+	atomic.StoreInt32(&msg.errCode, int32(errCode))
+}
+
+//replyCode는 handler가 보낸 응답의 ErrCode이다. 아직 응답하지 않았으면 NErrorSucess이다.
+func (msg *RequestMsg) replyCode() int {
+	return int(atomic.LoadInt32(&msg.errCode))
 }
 
 type ResHeader struct {
@@ -108,6 +181,8 @@ type ResHeader struct {
 	ToEids  []string `json:",,omitempty"`
 	ErrCode int      `json:",,omitempty"`
 	ErrText string   `json:",,omitempty"`
+	TraceID string   `json:",,omitempty"`
+	Stream  int      `json:",,omitempty"` //StreamFrameMore, StreamFrameEnd
 }
 
 type ResponseMsg struct {
@@ -115,6 +190,25 @@ type ResponseMsg struct {
 	Body   json.RawMessage
 }
 
+//CancelHeader는 caller가 포기한 request를 provider에게 알린다.
+//request와 같은 TxnNo, FromEids를 가지고 request가 지나간 경로를 따라간다.
+type CancelHeader struct {
+	TxnNo    uint64   `json:",,omitempty"`
+	FromEids []string `json:",,omitempty"`
+	Reason   string   `json:",,omitempty"`
+	TraceID  string   `json:",,omitempty"`
+}
+
+//SetDeadline은 절대시간으로 deadline을 기록한다.
+func (header *ReqHeader) SetDeadline(t time.Time) {
+	header.Deadline = t.UnixNano()
+}
+
+//IsExpired는 deadline이 지났는지 확인한다. deadline이 없으면 false이다.
+func (header ReqHeader) IsExpired(now time.Time) bool {
+	return header.Deadline > 0 && now.UnixNano() > header.Deadline
+}
+
 func (header *ResHeader) SetError(nerr NError) {
 	header.ErrCode = nerr.Code()
 	header.ErrText = nerr.Error()
@@ -137,43 +231,171 @@ func (out *msgPack) Body() []byte {
 }
 
 func (out *msgPack) Bytes() []byte {
-	if len(out.buffer) == 0 || out.changed {
-		out.build()
+	if out.changed || len(out.frames) == 0 {
+		out.rebuild()
+	}
+
+	if out.buffer == nil && len(out.frames) > 0 {
+		out.buffer = joinBuffers(out.frames, buffersLen(out.frames))
 	}
 
 	return out.buffer
 }
 
+//Buffers는 frame을 이어붙이지 않고 조각으로 돌려준다. body는 복사하지 않는다.
+//돌려준 slice는 호출한 쪽의 것이므로 net.Buffers.WriteTo로 써도 된다.
+func (out *msgPack) Buffers() net.Buffers {
+	if out.changed || len(out.frames) == 0 {
+		out.rebuild()
+	}
+
+	if out.buffer != nil {
+		return net.Buffers{out.buffer}
+	}
+
+	return append(net.Buffers(nil), out.frames...)
+}
+
+//rebuild는 build 에러를 기억하고, 실패하면 만들던 frame을 버린다.
+func (out *msgPack) rebuild() {
+	if out.err = out.build(); out.err != nil {
+		out.frames, out.buffer = out.frames[:0], nil
+	}
+}
+
 func (out *msgPack) build() error {
-	switch out.msgType {
+	msgType := out.msgType &^ MsgFlagCompressed
+
+	switch msgType {
 	case MsgTypeConnect:
 	case MsgTypeAccept:
 	case MsgTypePing:
 	case MsgTypeRequest:
 	case MsgTypeResponse:
+	case MsgTypeCancel:
+	case MsgTypeChunk:
 	default:
 		return CoRaiseNError(NErrorUnknownMsgType, 3, "unknown msg type")
 	}
 
-	out.buffer = []byte(fmt.Sprintf("/%c%05d", out.msgType, len(out.header)))
-	out.buffer = append(out.buffer, out.header...)
+	body := out.body
+	out.frames, out.buffer = out.frames[:0], nil
 
-	if out.msgType != MsgTypePing {
-		out.buffer = append(out.buffer, []byte(fmt.Sprintf("%010d", len(out.body)))...)
-		if len(out.body) > 0 {
-			out.buffer = append(out.buffer, out.body...)
+	//request, response의 큰 body는 chunk frame으로 나누고 마지막 조각만 원래 header로 보낸다.
+	if len(body) > ChunkBodyLength && (msgType == MsgTypeRequest || msgType == MsgTypeResponse) {
+		if len(body) > maxMessageSize() {
+			return CoRaiseNError(NErrorTooLargeSize, 3, fmt.Sprintf("body %d bytes", len(body)))
+		}
+
+		//chunk frame의 head는 모두 같으므로 하나를 같이 쓴다.
+		chunkHeader, _ := json.Marshal(ChunkHeader{Total: len(body)})
+		chunkHead := frameHead(MsgTypeChunk, chunkHeader, ChunkBodyLength)
+		for len(body) > ChunkBodyLength {
+			out.frames = append(out.frames, chunkHead, body[:ChunkBodyLength])
+			body = body[ChunkBodyLength:]
 		}
 	}
 
-	if len(out.buffer) > MaxBufferLength {
+	head := frameHead(out.msgType, out.header, len(body))
+	if len(head)+len(body) > MaxBufferLength {
 		return CoRaiseNError(NErrorTooLargeSize, 3)
 	}
 
+	out.frames = append(out.frames, head)
+	if msgType != MsgTypePing && len(body) > 0 {
+		out.frames = append(out.frames, body)
+	}
+
 	out.changed = false
 
 	return nil
 }
 
+//WriteMsgPack은 w가 MsgPackWriter나 BuffersWriter이면 body를 복사하지 않고 보낸다.
+//만들 수 없는 메세지이면 build 에러를 돌려준다.
+func WriteMsgPack(w NetWriter, mpck MsgPack, isLogging bool) error {
+	if mw, ok := w.(MsgPackWriter); ok {
+		return mw.WriteMsgPack(mpck, isLogging)
+	}
+
+	if bw, ok := w.(BuffersWriter); ok {
+		bufs := mpck.Buffers()
+		if err := buildError(mpck); err != nil {
+			return err
+		}
+		return bw.WriteBuffers(bufs, isLogging)
+	}
+
+	b := mpck.Bytes()
+	if err := buildError(mpck); err != nil {
+		return err
+	}
+	return w.Write(b, isLogging)
+}
+
+func buildError(mpck MsgPack) error {
+	if out, ok := mpck.(*msgPack); ok && out.err != nil {
+		return out.err
+	}
+
+	return nil
+}
+
+//IsPermanentWriteError는 다시 보내도 실패하는 에러인지 확인한다. 이런 메세지는 unsentQ에 넣지 않는다.
+func IsPermanentWriteError(err error) bool {
+	nerr, ok := err.(NError)
+	return ok && (nerr.Code() == NErrorTooLargeSize || nerr.Code() == NErrorUnknownMsgType)
+}
+
+//frameHead는 body 앞까지의 frame을 만든다. ping은 body 길이가 없다.
+func frameHead(msgType byte, header []byte, bodyLen int) []byte {
+	return appendFrameHead(nil, msgType, header, bodyLen)
+}
+
+//appendFrameHead는 frameHead를 dst 뒤에 붙인다. 자리가 모자랄때만 새로 할당한다.
+func appendFrameHead(dst []byte, msgType byte, header []byte, bodyLen int) []byte {
+	size := frameHeadLen + len(header)
+	if msgType != MsgTypePing {
+		size += frameBodyLenLen
+	}
+
+	n := len(dst)
+	if cap(dst)-n < size {
+		grown := make([]byte, n, n+size)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	dst = dst[:n+size]
+	b := dst[n:]
+	b[0], b[1] = '/', msgType
+	putDecimal(b[2:frameHeadLen], len(header))
+	copy(b[frameHeadLen:], header)
+
+	if msgType != MsgTypePing {
+		putDecimal(b[frameHeadLen+len(header):], bodyLen)
+	}
+
+	return dst
+}
+
+//putDecimal은 v를 b의 길이만큼 앞을 0으로 채운 10진수로 쓴다.
+func putDecimal(b []byte, v int) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte('0' + v%10)
+		v /= 10
+	}
+}
+
+//maxMessageSize는 chunk로 나눠 주고받을 수 있는 body의 최대 크기이다.
+func maxMessageSize() int {
+	if app.Config != nil && app.Config.Global.MaxMessageSize > 0 {
+		return app.Config.Global.MaxMessageSize
+	}
+
+	return DefaultMaxMessageSize
+}
+
 func (out *msgPack) ResetBody(key string, value interface{}) (err error) {
 	var jsbody map[string]interface{}
 
@@ -210,6 +432,9 @@ func (out *msgPack) ResetHeader(header interface{}) (err error) {
 	case ResHeader:
 		msgType = MsgTypeResponse
 
+	case CancelHeader:
+		msgType = MsgTypeCancel
+
 	default:
 		return CoRaiseNError(NErrorUnknownMsgType, 2, "unknown msg type")
 	}
@@ -235,6 +460,73 @@ func NewMsgPack(msgType byte, header []byte, body []byte) MsgPack {
 	return &msgPack{msgType: msgType, header: header, body: body, changed: true}
 }
 
+//ParseMsgPack은 Bytes()로 만들어진 buffer를 다시 MsgPack으로 되돌린다.
+//chunk frame으로 나뉜 buffer는 body를 다시 합친다.
+func ParseMsgPack(b []byte) (MsgPack, error) {
+	var chunks []byte
+
+	for {
+		msgType, header, body, n, err := parseFrame(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if msgType != MsgTypeChunk {
+			if len(chunks) > 0 {
+				body = append(chunks, body...)
+			}
+			return NewMsgPack(msgType, header, body), nil
+		}
+
+		chunks = append(chunks, body...)
+		b = b[n:]
+	}
+}
+
+//parseFrame은 buffer 앞의 frame 하나를 읽고 읽은 길이를 돌려준다.
+func parseFrame(b []byte) (byte, []byte, []byte, int, error) {
+	if len(b) < frameHeadLen || b[0] != '/' {
+		return 0, nil, nil, 0, IssueErrorf("invalid msgpack")
+	}
+
+	hlen, ok := parseDecimal(b[2:frameHeadLen])
+	if !ok || len(b) < frameHeadLen+hlen {
+		return 0, nil, nil, 0, IssueErrorf("invalid msgpack header length")
+	}
+
+	msgType := b[1]
+	header := b[frameHeadLen : frameHeadLen+hlen]
+	if msgType == MsgTypePing {
+		return msgType, header, nil, frameHeadLen + hlen, nil
+	}
+
+	offset := frameHeadLen + hlen
+	if len(b) < offset+frameBodyLenLen {
+		return 0, nil, nil, 0, IssueErrorf("invalid msgpack body length")
+	}
+
+	blen, ok := parseDecimal(b[offset : offset+frameBodyLenLen])
+	offset += frameBodyLenLen
+	if !ok || len(b) < offset+blen {
+		return 0, nil, nil, 0, IssueErrorf("invalid msgpack body length")
+	}
+
+	return msgType, header, b[offset : offset+blen], offset + blen, nil
+}
+
+//parseDecimal은 putDecimal로 쓴 길이를 읽는다. 숫자가 아닌 byte가 있으면 false이다.
+func parseDecimal(b []byte) (int, bool) {
+	v := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		v = v*10 + int(c-'0')
+	}
+
+	return v, true
+}
+
 func BuildMsgPack(header interface{}, body interface{}) (MsgPack, error) {
 	var out msgPack
 
@@ -257,6 +549,9 @@ func BuildMsgPack(header interface{}, body interface{}) (MsgPack, error) {
 	case ResHeader:
 		out.msgType = MsgTypeResponse
 
+	case CancelHeader:
+		out.msgType = MsgTypeCancel
+
 	default:
 		return nil, CoRaiseNError(NErrorUnknownMsgType, 2, "unknown msg type")
 	}
@@ -303,7 +598,7 @@ func BuildConnectMsgPack(eid string, toplgy Topology) MsgPack {
 		federated = true
 	}
 
-	mp, _ := BuildMsgPack(ConnHeader{Eid: eid, Federated: federated}, ConnBody{Spn: toplgy.Spn, FederatedKey: toplgy.FederatedKey, FederatedApis: toplgy.FederatedApis})
+	mp, _ := BuildMsgPack(ConnHeader{Eid: eid, Federated: federated, Version: ProtocolVersion, MinVersion: minProtocolVersion(), Caps: localCaps(), Codecs: linkCodecs()}, ConnBody{Spn: toplgy.Spn, FederatedKey: toplgy.FederatedKey, FederatedApis: toplgy.FederatedApis, Topics: toplgy.Topics, Subscribers: toplgy.Subscribers})
 
 	return mp
 }
@@ -322,10 +617,8 @@ func ParseAcceptMsg(header []byte, body []byte) *AcceptMsg {
 	return &msg
 }
 
-func BuildAcceptMsgPack(ne NError, eid string, remoteEid string) MsgPack {
-	mp, _ := BuildMsgPack(AccptHeader{ErrCode: ne.Code(), ErrText: ne.Error()},
-		AccptBody{Eid: eid, RemoteEid: remoteEid},
-	)
+func BuildAcceptMsgPack(ne NError, body AccptBody) MsgPack {
+	mp, _ := BuildMsgPack(AccptHeader{ErrCode: ne.Code(), ErrText: ne.Error()}, body)
 
 	return mp
 }
@@ -358,6 +651,15 @@ func ParseResHeader(b []byte) *ResHeader {
 	return &header
 }
 
+func ParseCancelHeader(b []byte) *CancelHeader {
+	var header CancelHeader
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil
+	}
+
+	return &header
+}
+
 func PeekFromEids(eids []string) string {
 	if len(eids) == 0 {
 		return ""
@@ -0,0 +1,298 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReqHeaderDeadline(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		expired  bool
+		done     bool
+	}{
+		{"no deadline", time.Time{}, false, false},
+		{"future", now.Add(time.Hour), false, false},
+		{"past", now.Add(-time.Second), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h ReqHeader
+			if !tt.deadline.IsZero() {
+				h.SetDeadline(tt.deadline)
+			}
+
+			if got := h.IsExpired(now); got != tt.expired {
+				t.Fatalf("IsExpired() = %v, want %v", got, tt.expired)
+			}
+
+			req := &RequestMsg{Header: h}
+			ctx := req.Context()
+
+			dl, ok := ctx.Deadline()
+			if ok != !tt.deadline.IsZero() {
+				t.Fatalf("Context().Deadline() ok = %v, want %v", ok, !tt.deadline.IsZero())
+			}
+			if ok && !dl.Equal(time.Unix(0, h.Deadline)) {
+				t.Fatalf("Context().Deadline() = %v, want %v", dl, time.Unix(0, h.Deadline))
+			}
+
+			if done := ctx.Err() != nil; done != tt.done {
+				t.Fatalf("Context().Err() = %v, want done %v", ctx.Err(), tt.done)
+			}
+			if tt.done && ctx.Err() != context.DeadlineExceeded {
+				t.Fatalf("Context().Err() = %v, want DeadlineExceeded", ctx.Err())
+			}
+			if req.isCanceled() {
+				t.Fatalf("deadline must not be reported as cancel")
+			}
+		})
+	}
+}
+
+func TestRequestContextTracked(t *testing.T) {
+	q := &reqQ{inflight: make(map[string]*RequestMsg), cancelLock: new(sync.Mutex)}
+
+	var h ReqHeader
+	h.TxnNo = 1
+	h.FromEids = []string{"a", "b"}
+	h.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	req := &RequestMsg{Header: h}
+	q.track(req)
+
+	ctx := req.Context()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Fatalf("tracked request context has no deadline")
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("context is not done after deadline")
+	}
+
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("Err() = %v, want DeadlineExceeded", ctx.Err())
+	}
+
+	q.untrack(req)
+	if len(q.inflight) != 0 {
+		t.Fatalf("inflight = %d after untrack", len(q.inflight))
+	}
+}
+
+func TestAppendFrameHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		dst     []byte
+		msgType byte
+		header  []byte
+		bodyLen int
+		inPlace bool //dst의 자리에 그대로 쓴다.
+	}{
+		{name: "nil dst", msgType: MsgTypeRequest, header: []byte(`{"Api":"A"}`), bodyLen: 12},
+		{name: "pool buffer", dst: make([]byte, 0, frameBufferSize), msgType: MsgTypeResponse, header: []byte(`{"TxnNo":1}`), bodyLen: 123456, inPlace: true},
+		{name: "after prefix", dst: append(make([]byte, 0, 64), "xy"...), msgType: MsgTypeCancel, header: []byte(`{}`), inPlace: true},
+		{name: "grow prefix", dst: []byte("xy"), msgType: MsgTypeRequest, header: []byte(`{"Api":"A"}`), bodyLen: 1},
+		{name: "ping", dst: make([]byte, 0, 64), msgType: MsgTypePing, header: []byte(`{"Eid":"e"}`), inPlace: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := string(tt.dst)
+			b := appendFrameHead(tt.dst, tt.msgType, tt.header, tt.bodyLen)
+
+			if want := prefix + string(frameHead(tt.msgType, tt.header, tt.bodyLen)); string(b) != want {
+				t.Fatalf("head %q, want %q", b, want)
+			}
+
+			if inPlace := cap(tt.dst) > 0 && &b[:1][0] == &tt.dst[:1][0]; inPlace != tt.inPlace {
+				t.Fatalf("in place %v, want %v", inPlace, tt.inPlace)
+			}
+		})
+	}
+}
+
+//decodeFrames는 받는 쪽처럼 encodeMsgPack이 만든 frame을 원래 JSON으로 되돌린다.
+func decodeFrames(t *testing.T, codec Codec, bufs [][]byte) (byte, []byte, []byte) {
+	ca, cb := newTestConnPair(t)
+	if codec != nil {
+		if err := SetLinkCodec(cb, codec.Name()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ca.push(writeFrames{bufs: bufs}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	f := readTimeout(t, cb)
+	if f.err != nil {
+		t.Fatal(f.err)
+	}
+
+	return f.msgType, f.header, f.body
+}
+
+func TestEncodeMsgPack(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"Name": string(testBody(10000))})
+	random, _ := json.Marshal(randomBody(10000))
+	large, _ := json.Marshal(string(testBody(2 * ChunkBodyLength)))
+
+	tests := []struct {
+		name       string
+		codec      Codec
+		compress   int
+		msgType    byte
+		body       []byte
+		compressed bool
+		chunked    bool
+	}{
+		{name: "compress", compress: 1000, msgType: MsgTypeRequest, body: body, compressed: true},
+		{name: "incompressible", compress: 1000, msgType: MsgTypeResponse, body: randomBody(10000)},
+		{name: "cancel not compressed", compress: 1000, msgType: MsgTypeCancel, body: body},
+		{name: "msgpack", codec: msgPackCodec{}, msgType: MsgTypeRequest, body: []byte(`{"Values":[1,2,3]}`)},
+		{name: "msgpack empty body", codec: msgPackCodec{}, msgType: MsgTypeResponse},
+		{name: "msgpack compress", codec: msgPackCodec{}, compress: 1000, msgType: MsgTypeResponse, body: random, compressed: true},
+		{name: "chunked", codec: msgPackCodec{}, msgType: MsgTypeRequest, body: large, chunked: true},
+		{name: "chunked compress", compress: 1000, msgType: MsgTypeRequest, body: large, compressed: true},
+	}
+
+	header := []byte(`{"Api":"A","TxnNo":1}`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := encodeMsgPack(tt.codec, tt.compress, tt.msgType, header, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if compressed := lastHead(f.bufs)[1]&MsgFlagCompressed != 0; compressed != tt.compressed {
+				t.Fatalf("compressed %v, want %v", compressed, tt.compressed)
+			}
+
+			if chunked := countChunks(f.bufs) > 0; chunked != tt.chunked {
+				t.Fatalf("chunked %v, want %v", chunked, tt.chunked)
+			}
+
+			//새로 만든 head와 압축한 body만 pool buffer이다.
+			if pooledHead := f.pooled[0] != nil; pooledHead == tt.chunked {
+				t.Fatalf("pooled head %v, chunked %v", pooledHead, tt.chunked)
+			}
+			if pooledBody := f.pooled[1] != nil; pooledBody != tt.compressed {
+				t.Fatalf("pooled body %v, want %v", pooledBody, tt.compressed)
+			}
+
+			//codec도 압축도 하지 않은 body는 복사하지 않는다.
+			if tt.codec == nil && !tt.compressed && !tt.chunked && len(tt.body) > 0 && &f.bufs[1][0] != &tt.body[0] {
+				t.Fatal("body copied")
+			}
+
+			msgType, h, b := decodeFrames(t, tt.codec, f.bufs)
+			if msgType != tt.msgType || !bytes.Equal(h, header) || !bytes.Equal(b, tt.body) {
+				t.Fatalf("decoded %c %s %d bytes, want %c %d bytes", msgType, h, len(b), tt.msgType, len(tt.body))
+			}
+		})
+	}
+}
+
+//lastHead는 chunk가 아닌 마지막 frame head이다.
+func lastHead(bufs [][]byte) []byte {
+	var head []byte
+	for _, b := range bufs {
+		if len(b) > 1 && b[0] == '/' && b[1] != MsgTypeChunk {
+			head = b
+		}
+	}
+
+	return head
+}
+
+//routeHop은 gate, router가 하는 것처럼 받은 request의 FromEids에 eid를 넣고 다음 연결로 보낸다.
+func routeHop(b *testing.B, from *conn, to *conn, eid string) {
+	_, header, body, err := from.Read()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	h := ParseReqHeader(header)
+	if h == nil {
+		b.Fatal("request header parse error")
+	}
+	h.FromEids = append(h.FromEids, eid)
+
+	mpck := NewMsgPack(MsgTypeRequest, header, body)
+	if err := mpck.ResetHeader(*h); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := WriteMsgPack(to, mpck, false); err != nil {
+		b.Fatal(err)
+	}
+}
+
+//BenchmarkRoutedMessage는 client에서 sgate, router, sgate를 거쳐 provider까지 가는 request 하나의 할당을 잰다.
+func BenchmarkRoutedMessage(b *testing.B) {
+	tests := []struct {
+		name     string
+		codec    string
+		compress int
+		size     int
+	}{
+		{name: "json small", codec: CodecJSON, size: 100},
+		{name: "json 16k", codec: CodecJSON, size: 16 * 1024},
+		{name: "compress 16k", codec: CodecJSON, compress: DefaultCompressThreshold, size: 16 * 1024},
+		{name: "msgpack small", codec: CodecMsgPack, size: 100},
+		{name: "msgpack compress 16k", codec: CodecMsgPack, compress: DefaultCompressThreshold, size: 16 * 1024},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			//client->sgate, sgate->router, router->sgate, sgate->provider
+			var links [4][2]*conn
+			for i := range links {
+				links[i][0], links[i][1] = newTestConnPair(b)
+				for _, c := range links[i] {
+					if err := SetLinkCodec(c, tt.codec); err != nil {
+						b.Fatal(err)
+					}
+					c.SetCompress(tt.compress)
+				}
+			}
+			body, _ := json.Marshal(map[string]string{"Data": string(testBody(tt.size))})
+			header := ReqHeader{Api: "A", Spn: "S", TxnNo: 1, FromEids: []string{"client"}}
+			hops := []string{"sgate1", "router", "sgate2"}
+
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				mpck, err := BuildMsgPack(header, json.RawMessage(body))
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if err := WriteMsgPack(links[0][0], mpck, false); err != nil {
+					b.Fatal(err)
+				}
+
+				for n, eid := range hops {
+					routeHop(b, links[n][1], links[n+1][0], eid)
+				}
+
+				if _, _, _, err := links[3][1].Read(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+/********************************************************************************
+* msgpack.go
+* JSON과 MessagePack 사이를 변환하는 codec.
+* JSON의 object, array, string, number, bool, null만 다루므로 ext type은 지원하지 않는다.
+* object의 key는 정렬해서 쓰므로 같은 JSON은 언제나 같은 bytes가 된다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	. "github.com/Azraid/pasque/core"
+)
+
+type msgPackCodec struct{}
+
+func (msgPackCodec) Name() string {
+	return CodecMsgPack
+}
+
+func (msgPackCodec) Marshal(js []byte) ([]byte, error) {
+	if len(js) == 0 {
+		return js, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return appendMsgPack(make([]byte, 0, len(js)), v)
+}
+
+func (msgPackCodec) Unmarshal(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+
+	v, rest, err := readMsgPack(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, IssueErrorf("msgpack %d bytes left", len(rest))
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func appendMsgPack(b []byte, v interface{}) ([]byte, error) {
+	var err error
+
+	switch t := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+
+	case bool:
+		if t {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+
+	case json.Number:
+		if i, e := strconv.ParseInt(string(t), 10, 64); e == nil {
+			b = appendMsgPackInt(b, i)
+		} else if u, e := strconv.ParseUint(string(t), 10, 64); e == nil {
+			b = append(b, 0xcf)
+			b = appendUint(b, u, 8)
+		} else if f, e := t.Float64(); e == nil {
+			b = append(b, 0xcb)
+			b = appendUint(b, math.Float64bits(f), 8)
+		} else {
+			return nil, e
+		}
+
+	case string:
+		b = appendMsgPackHead(b, len(t), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b = append(b, t...)
+
+	case []interface{}:
+		b = appendMsgPackHead(b, len(t), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range t {
+			if b, err = appendMsgPack(b, e); err != nil {
+				return nil, err
+			}
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendMsgPackHead(b, len(t), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			b = appendMsgPackHead(b, len(k), 0xa0, 32, 0xd9, 0xda, 0xdb)
+			b = append(b, k...)
+			if b, err = appendMsgPack(b, t[k]); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, IssueErrorf("msgpack unsupported type %T", v)
+	}
+
+	return b, nil
+}
+
+//appendMsgPackHead는 string, array, map의 길이를 쓴다. fix 형식은 n < fixMax일때 fix|n 이다.
+//code8이 0이면 8bit 길이 형식이 없다.
+func appendMsgPackHead(b []byte, n int, fix byte, fixMax int, code8 byte, code16 byte, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(b, code16), uint64(n), 2)
+	default:
+		return appendUint(append(b, code32), uint64(n), 4)
+	}
+}
+
+func appendMsgPackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return appendUint(append(b, 0xd1), uint64(uint16(int16(i))), 2)
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return appendUint(append(b, 0xd2), uint64(uint32(int32(i))), 4)
+	default:
+		return appendUint(append(b, 0xd3), uint64(i), 8)
+	}
+}
+
+func appendUint(b []byte, u uint64, size int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(b, buf[8-size:]...)
+}
+
+func readUint(b []byte, size int) (uint64, []byte, error) {
+	if len(b) < size {
+		return 0, nil, IssueErrorf("msgpack short buffer")
+	}
+
+	var u uint64
+	for _, c := range b[:size] {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, b[size:], nil
+}
+
+func readMsgPack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, IssueErrorf("msgpack short buffer")
+	}
+
+	c, b := b[0], b[1:]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		return readMsgPackStr(b, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return readMsgPackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return readMsgPackMap(b, int(c&0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, rest, err := readUint(b, 1<<(c-0xcc))
+		return u, rest, err
+
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, rest, err := readUint(b, size)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, rest, nil
+
+	case 0xca:
+		u, rest, err := readUint(b, 4)
+		return float64(math.Float32frombits(uint32(u))), rest, err
+
+	case 0xcb:
+		u, rest, err := readUint(b, 8)
+		return math.Float64frombits(u), rest, err
+
+	case 0xd9, 0xda, 0xdb:
+		n, rest, err := readUint(b, 1<<(c-0xd9))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgPackStr(rest, int(n))
+
+	case 0xc4, 0xc5, 0xc6: //bin은 string으로 읽는다.
+		n, rest, err := readUint(b, 1<<(c-0xc4))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgPackStr(rest, int(n))
+
+	case 0xdc, 0xdd:
+		n, rest, err := readUint(b, 2<<(c-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgPackArray(rest, int(n))
+
+	case 0xde, 0xdf:
+		n, rest, err := readUint(b, 2<<(c-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMsgPackMap(rest, int(n))
+	}
+
+	return nil, nil, IssueErrorf("msgpack unsupported code 0x%x", c)
+}
+
+func readMsgPackStr(b []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || len(b) < n {
+		return nil, nil, IssueErrorf("msgpack short buffer")
+	}
+
+	return string(b[:n]), b[n:], nil
+}
+
+func readMsgPackArray(b []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || n > len(b) {
+		return nil, nil, IssueErrorf("msgpack short buffer")
+	}
+
+	arr := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		var err error
+		if arr[i], b, err = readMsgPack(b); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return arr, b, nil
+}
+
+func readMsgPackMap(b []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || n > len(b) {
+		return nil, nil, IssueErrorf("msgpack short buffer")
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := readMsgPack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, IssueErrorf("msgpack map key is not string")
+		}
+
+		if m[key], b, err = readMsgPack(rest); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return m, b, nil
+}
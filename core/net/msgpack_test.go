@@ -0,0 +1,163 @@
+package net
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		js   string
+		want string //비어 있으면 js와 같다.
+		size int    //msgpack 크기, 0이면 확인하지 않는다.
+	}{
+		{name: "empty", js: ``},
+		{name: "null", js: `null`, size: 1},
+		{name: "true", js: `true`, size: 1},
+		{name: "false", js: `false`, size: 1},
+		{name: "fixint", js: `127`, size: 1},
+		{name: "negative fixint", js: `-32`, size: 1},
+		{name: "int8", js: `-128`, size: 2},
+		{name: "int16", js: `-32768`, size: 3},
+		{name: "int16 positive", js: `32767`, size: 3},
+		{name: "int32", js: `2147483647`, size: 5},
+		{name: "int64", js: `-9223372036854775808`, size: 9},
+		{name: "uint64", js: `18446744073709551615`, size: 9},
+		{name: "float", js: `1.5`, size: 9},
+		{name: "float exponent", js: `1e+100`},
+		{name: "float without fraction", js: `1.0`, want: `1`},
+		{name: "fixstr", js: `"` + strings.Repeat("a", 31) + `"`, size: 32},
+		{name: "str8", js: `"` + strings.Repeat("a", 32) + `"`, size: 34},
+		{name: "str16", js: `"` + strings.Repeat("a", 256) + `"`, size: 259},
+		{name: "str32", js: `"` + strings.Repeat("a", 65536) + `"`, size: 65541},
+		{name: "unicode and html", js: `"한글 <a href=\"x\">&</a>"`},
+		{name: "escaped", js: `"\u0001\n\t\\"`},
+		{name: "fixarray", js: `[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15]`, size: 16},
+		{name: "array16", js: `[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16]`, size: 19},
+		{name: "empty array", js: `[]`, size: 1},
+		{name: "empty map", js: `{}`, size: 1},
+		{name: "map sorted", js: `{"b":1,"a":2}`, want: `{"a":2,"b":1}`},
+		{name: "map16", js: `{"a":1,"b":1,"c":1,"d":1,"e":1,"f":1,"g":1,"h":1,"i":1,"j":1,"k":1,"l":1,"m":1,"n":1,"o":1,"p":1}`},
+		{name: "nested", js: `{"Body":[{"x":null},[true,false],-1.25],"Header":{"ToEids":["a","b"],"TxnNo":12}}`},
+	}
+
+	codec := msgPackCodec{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := codec.Marshal([]byte(tt.js))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.size > 0 && len(b) != tt.size {
+				t.Errorf("msgpack %d bytes, want %d", len(b), tt.size)
+			}
+
+			js, err := codec.Unmarshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			if len(want) == 0 {
+				want = tt.js
+			}
+
+			if string(js) != want {
+				t.Fatalf("round trip %s, want %s", js, want)
+			}
+		})
+	}
+}
+
+//key 순서가 달라도 같은 bytes가 된다.
+func TestMsgPackDeterministic(t *testing.T) {
+	codec := msgPackCodec{}
+
+	a, err := codec.Marshal([]byte(`{"x":1,"y":{"b":2,"a":[1,{"d":0,"c":0}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := codec.Marshal([]byte(`{"y":{"a":[1,{"c":0,"d":0}],"b":2},"x":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(a) != string(b) {
+		t.Fatalf("%x != %x", a, b)
+	}
+}
+
+func TestMsgPackErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		js      string //Marshal 입력
+		msgpack []byte //Unmarshal 입력
+	}{
+		{name: "invalid json", js: `{"a":`},
+		{name: "short str", msgpack: []byte{0xa3, 'a'}},
+		{name: "short uint", msgpack: []byte{0xcd, 0x01}},
+		{name: "short array", msgpack: []byte{0x92, 0x01}},
+		{name: "array length over buffer", msgpack: []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{name: "map key not string", msgpack: []byte{0x81, 0x01, 0x01}},
+		{name: "ext not supported", msgpack: []byte{0xd4, 0x01, 0x01}},
+		{name: "bytes left", msgpack: []byte{0x01, 0x02}},
+	}
+
+	codec := msgPackCodec{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if len(tt.js) > 0 {
+				_, err = codec.Marshal([]byte(tt.js))
+			} else {
+				_, err = codec.Unmarshal(tt.msgpack)
+			}
+
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+//msgpack link로 보낸 frame은 받는 쪽에서 같은 JSON으로 돌아온다.
+func TestMsgPackLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType byte
+		header  string
+		body    string
+	}{
+		{name: "request", msgType: MsgTypeRequest, header: `{"Api":"A","Spn":"S","TxnNo":3}`, body: `{"Name":"x","Values":[1,2]}`},
+		{name: "response empty body", msgType: MsgTypeResponse, header: `{"ErrCode":0,"TxnNo":3}`},
+		{name: "cancel", msgType: MsgTypeCancel, header: `{"Reason":"timeout","TxnNo":3}`},
+		{name: "large body chunked", msgType: MsgTypeRequest, header: `{"Api":"A"}`, body: `"` + strings.Repeat("a", 2*ChunkBodyLength) + `"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, cb := newTestConnPair(t)
+			for _, c := range []*conn{ca, cb} {
+				if err := SetLinkCodec(c, CodecMsgPack); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := WriteMsgPack(ca, NewMsgPack(tt.msgType, []byte(tt.header), []byte(tt.body)), false); err != nil {
+				t.Fatal(err)
+			}
+
+			f := readTimeout(t, cb)
+			if f.err != nil {
+				t.Fatal(f.err)
+			}
+
+			if f.msgType != tt.msgType || string(f.header) != tt.header || string(f.body) != tt.body {
+				t.Fatalf("read %c %s %d bytes", f.msgType, f.header, len(f.body))
+			}
+		})
+	}
+}
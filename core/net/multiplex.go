@@ -17,20 +17,75 @@ import (
 
 type netIO struct {
 	//index int
+	eid  string
 	rw   NetIO
 	dial Dialer
 }
 
+//Send는 cancel처럼 실패해도 다시 보내지 않는 메세지를 이 연결로 보낸다.
+func (nio *netIO) Send(mpck MsgPack) error {
+	return WriteMsgPack(nio.rw, mpck, false)
+}
+
+func (nio *netIO) String() string {
+	return nio.eid
+}
+
 type multiplexerIO struct {
 	ios     util.RandSet
 	lock    *sync.RWMutex
 	disp    Dispatcher
 	msgC    chan MsgPack
+	policy  string
 	unsentQ UnsentQ
 }
 
+//Dispatch는 받은 메세지를 msgC에 넣는다. msgC가 가득 차면 policy에 따른다.
 func (muxio *multiplexerIO) Dispatch(msg MsgPack) {
-	muxio.msgC <- msg
+	if cap(muxio.msgC) == 0 || muxio.policy == OverloadBlock {
+		muxio.msgC <- msg
+		return
+	}
+
+	for {
+		select {
+		case muxio.msgC <- msg:
+			return
+		default:
+		}
+
+		if muxio.policy == OverloadReject {
+			muxio.overflow(msg)
+			return
+		}
+
+		select {
+		case old := <-muxio.msgC:
+			muxio.overflow(old)
+		default:
+		}
+	}
+}
+
+//overflow는 버려지는 메세지를 남기고, request라면 NErrorServerBusy로 응답한다.
+func (muxio *multiplexerIO) overflow(msg MsgPack) {
+	AddDeadLetter("dispatch queue full", "", msg, func(mpck MsgPack) error {
+		muxio.Dispatch(mpck)
+		return nil
+	})
+
+	if msg.MsgType() != MsgTypeRequest {
+		return
+	}
+
+	h := ParseReqHeader(msg.Header())
+	if h == nil || h.TxnNo == 0 {
+		return
+	}
+
+	if _, res, err := buildErrorResponse(h, CoRaiseNError(NErrorServerBusy, 1, "dispatch queue full")); err == nil {
+		muxio.Write(res.Bytes(), true)
+	}
 }
 
 func (muxio *multiplexerIO) Broadcast(b []byte) {
@@ -47,6 +102,74 @@ func (muxio *multiplexerIO) Broadcast(b []byte) {
 }
 
 func (muxio *multiplexerIO) Write(b []byte, isLogging bool) error {
+	if err := muxio.write(b, isLogging); err != nil {
+		muxio.unsentQ.Add(b)
+		return err
+	}
+
+	return nil
+}
+
+//WriteMsgPack은 Write와 같지만 body를 복사하지 않고 보낸다.
+func (muxio *multiplexerIO) WriteMsgPack(mpck MsgPack, isLogging bool) error {
+	return muxio.writeMsgPackTo(muxio.pick(), mpck, isLogging)
+}
+
+//WriteMsgPackFor는 같은 key를 언제나 같은 연결로 보낸다. stream frame처럼 순서가 필요할때 쓴다.
+func (muxio *multiplexerIO) WriteMsgPackFor(key uint64, mpck MsgPack, isLogging bool) error {
+	return muxio.writeMsgPackTo(muxio.pickFor(key), mpck, isLogging)
+}
+
+//pickFor는 key로 연결을 고른다. 연결 목록은 바뀌지 않으므로 같은 key는 같은 연결이 된다.
+func (muxio *multiplexerIO) pickFor(key uint64) *netIO {
+	n := muxio.ios.Length()
+	if n == 0 {
+		return nil
+	}
+
+	var nio *netIO
+	i := key % uint64(n)
+	muxio.ios.Range(func(v interface{}) bool {
+		if i == 0 {
+			nio = v.(*netIO)
+			return false
+		}
+		i--
+		return true
+	})
+
+	return nio
+}
+
+//pick은 보낼 연결을 고른다. 연결이 없으면 nil이다.
+func (muxio *multiplexerIO) pick() *netIO {
+	if muxio.ios.Length() == 0 {
+		return nil
+	}
+
+	return muxio.ios.AnyOne().(*netIO)
+}
+
+//writeMsgPackTo는 pick으로 고른 nio로 보낸다. 보내지 못하면 unsentQ에 넣는다. 다시 보내도 실패하는 메세지는 넣지 않는다.
+func (muxio *multiplexerIO) writeMsgPackTo(nio *netIO, mpck MsgPack, isLogging bool) error {
+	if nio == nil {
+		muxio.unsentQ.Add(mpck.Bytes())
+		return IssueErrorf("no io net list")
+	}
+
+	if err := WriteMsgPack(nio.rw, mpck, isLogging); err != nil {
+		if IsPermanentWriteError(err) {
+			return err
+		}
+		nio.dial.CheckAndRedial()
+		muxio.unsentQ.Add(mpck.Bytes())
+		return err
+	}
+
+	return nil
+}
+
+func (muxio *multiplexerIO) write(b []byte, isLogging bool) error {
 	if muxio.ios.Length() == 0 {
 		return IssueErrorf("no io net list")
 	}
@@ -55,13 +178,42 @@ func (muxio *multiplexerIO) Write(b []byte, isLogging bool) error {
 
 	if err := nio.rw.Write(b, isLogging); err != nil {
 		nio.dial.CheckAndRedial()
-		muxio.unsentQ.Add(b)
 		return err
 	}
 
 	return nil
 }
 
+//muxResender는 unsentQ가 다시 보낼때 사용한다. 실패해도 unsentQ에 다시 넣지 않는다.
+type muxResender struct {
+	muxio *multiplexerIO
+}
+
+func (r muxResender) Write(b []byte, isLogging bool) error {
+	return r.muxio.write(b, isLogging)
+}
+
+//WriteAck는 고른 연결의 writer가 b를 보낸 뒤에 onDone을 부른다.
+func (r muxResender) WriteAck(b []byte, isLogging bool, onDone func(err error)) error {
+	nio := r.muxio.pick()
+	if nio == nil {
+		return IssueErrorf("no io net list")
+	}
+
+	var err error
+	if aw, ok := nio.rw.(AckWriter); ok {
+		err = aw.WriteAck(b, isLogging, onDone)
+	} else if err = nio.rw.Write(b, isLogging); err == nil {
+		onDone(nil)
+	}
+
+	if err != nil {
+		nio.dial.CheckAndRedial()
+	}
+
+	return err
+}
+
 func (muxio *multiplexerIO) Close() {
 	close(muxio.msgC)
 }
@@ -73,25 +225,38 @@ func (muxio *multiplexerIO) Dial() {
 	})
 }
 
-func newMultiplexerIO(eid string, remotes []app.Node, toplgy *Topology, disp Dispatcher) *multiplexerIO {
+//topology는 접속할때마다 불러서 그때의 topology로 ConnectMsg를 만든다.
+func newMultiplexerIO(eid string, remotes []app.Node, topology func() Topology, disp Dispatcher) *multiplexerIO {
 	muxio := &multiplexerIO{disp: disp}
-	muxio.msgC = make(chan MsgPack)
+	limit := app.Config.Global.Queues.Dispatch
+	muxio.msgC = make(chan MsgPack, limit.Max)
+	muxio.policy = overloadPolicy(limit.Policy, OverloadReject)
 	muxio.lock = new(sync.RWMutex)
 	muxio.ios = util.NewRandSet()
-	muxio.unsentQ = NewUnsentQ(muxio, TxnTimeoutSec)
+	name := "none"
+	if len(remotes) > 0 {
+		name = remotes[0].Eid
+	}
+	muxio.unsentQ = newUnsentQ(eid, name, muxResender{muxio: muxio}, TxnTimeoutSec)
+
+	RegisterQueueDepth("unsent:"+eid+":"+name, unsentLimit(), muxio.unsentQ.Len)
+	RegisterQueueDepth("dispatch:"+eid+":"+name, limit, func() int { return len(muxio.msgC) })
 
 	for _, rnodes := range remotes {
-		muxio.ios.Add(newNetIO(muxio, toplgy, rnodes))
+		muxio.ios.Add(newNetIO(muxio, topology, rnodes))
 	}
 
 	return muxio
 }
 
-func newNetIO(muxio *multiplexerIO, toplgy *Topology, rnode app.Node) *netIO {
-	nio := &netIO{rw: NewNetIO()}
+func newNetIO(muxio *multiplexerIO, topology func() Topology, rnode app.Node) *netIO {
+	nio := &netIO{eid: rnode.Eid, rw: NewNetIO()}
+	if u, ok := nio.rw.(UnsentIO); ok {
+		u.AddUnsentEvent(muxio.unsentQ.Add) //보내지 못한 메세지는 다른 연결로 다시 보낸다.
+	}
 	nio.dial = NewDialer(nio.rw, rnode.ListenAddr,
 		func() error { //onConnected
-			connMsgPack := BuildConnectMsgPack(app.App.Eid, *toplgy)
+			connMsgPack := BuildConnectMsgPack(app.App.Eid, topology())
 			if connMsgPack == nil {
 				panic("error connect message buld")
 			}
@@ -117,6 +282,17 @@ func newNetIO(muxio *multiplexerIO, toplgy *Topology, rnode app.Node) *netIO {
 						nio.rw.Close()
 						return IssueErrorf("accept net error %v", accptmsg.Header)
 					}
+
+					version, nerr := CheckAcceptProtocol(&accptmsg.Body)
+					if nerr != nil {
+						nio.rw.Close()
+						return nerr
+					}
+
+					if err := SetLinkProtocol(nio.rw, version, accptmsg.Body.Caps, accptmsg.Body.Codec); err != nil {
+						nio.rw.Close()
+						return err
+					}
 				}
 			}
 
@@ -151,7 +327,7 @@ func goNetRead(muxio *multiplexerIO, nio *netIO) {
 			}
 		}
 
-		if mpck.msgType == MsgTypeRequest || mpck.msgType == MsgTypeResponse {
+		if mpck.msgType == MsgTypeRequest || mpck.msgType == MsgTypeResponse || mpck.msgType == MsgTypeCancel {
 			muxio.Dispatch(&mpck)
 		}
 	}
@@ -169,6 +345,9 @@ func goDispatch(muxio *multiplexerIO) {
 		case MsgTypeResponse:
 			err = muxio.disp.OnResponse(msg.Header(), msg.Body())
 
+		case MsgTypeCancel:
+			err = muxio.disp.OnCancel(msg.Header(), msg.Body())
+
 		default:
 			err = IssueErrorf("msgtype is wrong")
 		}
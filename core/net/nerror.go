@@ -69,6 +69,12 @@ const (
 	NErrorTimeout         = 8
 	NErrorInvalidparams   = 9
 	NErrorNoPermission    = 10
+	NErrorCanceled        = 11
+	NErrorPartialFailure  = 12
+	NErrorNotFound        = 13
+	NErrorServerBusy      = 14
+	NErrorCircuitOpen     = 15
+	NErrorVersionMismatch = 16
 )
 
 func CoErrorName(code int) string {
@@ -95,11 +101,23 @@ func CoErrorName(code int) string {
 		return "NErrorInvalidparams"
 	case NErrorNoPermission:
 		return "NErrorNoPermission"
+	case NErrorCanceled:
+		return "NErrorCanceled"
+	case NErrorPartialFailure:
+		return "NErrorPartialFailure"
+	case NErrorNotFound:
+		return "NErrorNotFound"
+	case NErrorServerBusy:
+		return "NErrorServerBusy"
+	case NErrorCircuitOpen:
+		return "NErrorCircuitOpen"
+	case NErrorVersionMismatch:
+		return "NErrorVersionMismatch"
 	}
 
 	return "NErrorUnknown"
 }
 
 func CoRaiseNError(args ...interface{}) NError {
-	return RaiseNError(CoErrorName, args)
+	return RaiseNError(CoErrorName, args...)
 }
@@ -0,0 +1,153 @@
+/********************************************************************************
+* overload.go
+* queue가 가득 찼을때의 처리 정책과 queue 길이 조회.
+* web console의 /queues 에서 등록된 queue의 현재 길이를 볼 수 있다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azraid/pasque/app"
+)
+
+const (
+	OverloadReject     = "reject"     //새로 들어온 것을 NErrorServerBusy로 거절한다.
+	OverloadDropOldest = "dropoldest" //가장 오래된 것을 버리고 넣는다.
+	OverloadBlock      = "block"      //자리가 날때까지 기다린다. request queue는 blockLane이 기다리고 lane이 차면 거절한다.
+)
+
+type queueDepth struct {
+	depth func() int
+	limit app.QueueLimit
+}
+
+var queueDepths = new(sync.Map)
+
+func init() {
+	app.HandleConsole("/queues", "queues", queuesHandler)
+}
+
+//overloadPolicy는 설정의 policy를 정리한다. 모르는 값이면 def를 쓴다.
+func overloadPolicy(policy string, def string) string {
+	switch strings.ToLower(policy) {
+	case OverloadReject:
+		return OverloadReject
+	case OverloadDropOldest:
+		return OverloadDropOldest
+	case OverloadBlock:
+		return OverloadBlock
+	}
+
+	return def
+}
+
+//RegisterQueueDepth는 console에 보여줄 queue를 등록한다. 같은 name이면 교체된다.
+func RegisterQueueDepth(name string, limit app.QueueLimit, depth func() int) {
+	queueDepths.Store(name, queueDepth{depth: depth, limit: limit})
+}
+
+//QueueDepths는 등록된 queue의 현재 길이를 돌려준다.
+func QueueDepths() map[string]int {
+	depths := make(map[string]int)
+	queueDepths.Range(func(k, v interface{}) bool {
+		depths[k.(string)] = v.(queueDepth).depth()
+		return true
+	})
+
+	return depths
+}
+
+//blockLane은 block policy의 queue가 가득 찼을때 dispatch goroutine 대신 자리가 나기를 기다린다.
+//dispatch goroutine은 response도 전달하므로, 여기서 기다리면 handler가 기다리는 하위 request의
+//response가 전달되지 않아 handler가 끝나지 않고 queue에 자리도 나지 않는다.
+//lane에서 기다리는 것이 있는 동안에는 뒤에 온 request도 lane을 거쳐서 순서가 바뀌지 않는다.
+type blockLane struct {
+	jobC    chan func()
+	pending int32
+}
+
+const defaultBlockLaneSize = 1024
+
+func newBlockLane(size int) *blockLane {
+	if size <= 0 {
+		size = defaultBlockLaneSize
+	}
+
+	l := &blockLane{jobC: make(chan func(), size)}
+	go goBlockLane(l)
+	return l
+}
+
+//Do는 lane에 기다리는 것이 없으면 try를 부른다. try가 실패했거나 기다리는 것이 있으면 wait를 lane에 넘긴다.
+//lane도 가득 차면 false를 돌려주고, 호출한 쪽은 reject와 같이 처리한다. dispatch goroutine 하나만 호출한다.
+func (l *blockLane) Do(try func() bool, wait func()) bool {
+	if atomic.LoadInt32(&l.pending) == 0 && try() {
+		return true
+	}
+
+	atomic.AddInt32(&l.pending, 1)
+	select {
+	case l.jobC <- wait:
+		return true
+	default:
+		atomic.AddInt32(&l.pending, -1)
+		return false
+	}
+}
+
+func (l *blockLane) Len() int {
+	return int(atomic.LoadInt32(&l.pending))
+}
+
+func goBlockLane(l *blockLane) {
+	for wait := range l.jobC {
+		func() {
+			defer app.DumpRecover()
+			wait()
+		}()
+		atomic.AddInt32(&l.pending, -1)
+	}
+}
+
+//replyBusy는 queue가 넘쳐서 처리하지 못한 request에 NErrorServerBusy로 응답한다.
+func (q *reqQ) replyBusy(msg *RequestMsg, what string) {
+	app.ErrorLog("%s %s is full, api[%s] key[%s]", msg.Header.TraceTag(), what, msg.Header.Api, msg.Header.Key)
+	if msg.Header.TxnNo == 0 {
+		return
+	}
+
+	nerr := CoRaiseNError(NErrorServerBusy, 1, fmt.Sprintf("%s is full", what))
+	q.cli.SendResWithError(msg, nerr, nil)
+}
+
+func queuesHandler(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	queueDepths.Range(func(k, v interface{}) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<h1>queues : %s</h1>", app.App.Eid)
+	fmt.Fprintf(w, "<table border='1'><tr><th>Name</th><th>Depth</th><th>Max</th><th>Policy</th></tr>")
+
+	for _, name := range names {
+		if v, ok := queueDepths.Load(name); ok {
+			qd := v.(queueDepth)
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%s</td></tr>", name, qd.depth(), qd.limit.Max, qd.limit.Policy)
+		}
+	}
+
+	fmt.Fprintf(w, "</table>")
+}
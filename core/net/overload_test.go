@@ -0,0 +1,178 @@
+package net
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//handler가 하위 request의 response를 기다리는 동안 block policy의 queue가 가득 차도
+//dispatch goroutine은 막히지 않고 response를 전달해야 한다.
+func TestBlockPolicyNestedRequest(t *testing.T) {
+	const subTxnNo = 100
+
+	tests := []struct {
+		name    string
+		grid    bool
+		queues  func(q *app.QueueLimit, g *app.QueueLimit)
+		workers *app.WorkerConfig
+	}{
+		{
+			name: "rand semaphore",
+			queues: func(r *app.QueueLimit, g *app.QueueLimit) {
+				*r = app.QueueLimit{Max: 1, Policy: OverloadBlock}
+			},
+		},
+		{
+			name: "client worker pool",
+			queues: func(r *app.QueueLimit, g *app.QueueLimit) {
+				*r = app.QueueLimit{Max: 1, Policy: OverloadBlock}
+			},
+			workers: &app.WorkerConfig{Pool: 1},
+		},
+		{
+			name:    "api worker pool",
+			queues:  func(r *app.QueueLimit, g *app.QueueLimit) {},
+			workers: &app.WorkerConfig{Apis: map[string]app.ApiLimit{"Nested": {Concurrency: 1, Queue: 1, Policy: OverloadBlock}}},
+		},
+		{
+			name: "grid queue",
+			grid: true,
+			queues: func(r *app.QueueLimit, g *app.QueueLimit) {
+				*g = app.QueueLimit{Max: 1, Policy: OverloadBlock}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, savedWorkers := app.Config.Global.Queues, app.Config.Global.Workers
+			defer func() {
+				app.Config.Global.Queues, app.Config.Global.Workers = saved, savedWorkers
+			}()
+
+			tt.queues(&app.Config.Global.Queues.Rand, &app.Config.Global.Queues.Grid)
+			app.Config.Global.Workers = nil
+			if tt.workers != nil {
+				app.Config.Global.Workers = map[string]app.WorkerConfig{app.Config.Spn: *tt.workers}
+			}
+
+			cli := newTestClient()
+
+			var calls, done int32
+			started := make(chan struct{})
+			got := make(chan bool, 1)
+			resC := make(chan *ResponseMsg, 1)
+
+			handle := func() {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					close(started)
+					select {
+					case <-resC:
+						got <- true
+					case <-time.After(2 * time.Second):
+						got <- false
+					}
+				}
+				atomic.AddInt32(&done, 1)
+			}
+
+			if tt.grid {
+				cli.RegisterGridHandler("Nested", func(cli Client, msg *RequestMsg, gridData interface{}) interface{} {
+					handle()
+					return gridData
+				})
+			} else {
+				cli.RegisterRandHandler("Nested", func(cli Client, msg *RequestMsg) {
+					handle()
+				})
+			}
+
+			muxio := &multiplexerIO{disp: cli, msgC: make(chan MsgPack, 16), policy: OverloadBlock}
+			defer close(muxio.msgC)
+			go goDispatch(muxio)
+
+			key := ""
+			if tt.grid {
+				key = "k"
+			}
+
+			dispatch := func(header interface{}) {
+				mpck, err := BuildMsgPack(header, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				muxio.Dispatch(mpck)
+			}
+
+			cli.resQ.Push(subTxnNo, &RequestMsg{}, resC)
+			dispatch(ReqHeader{Api: "Nested", Key: key})
+			<-started
+
+			//처리중인 것과 queue에 들어간 것 외에 하나는 자리를 기다린다.
+			const extra = 3
+			for i := 0; i < extra; i++ {
+				dispatch(ReqHeader{Api: "Nested", Key: key})
+			}
+			dispatch(ResHeader{TxnNo: subTxnNo})
+
+			if !<-got {
+				t.Fatal("response was not delivered while the queue was blocked")
+			}
+
+			deadline := time.Now().Add(2 * time.Second)
+			for atomic.LoadInt32(&done) < extra+1 {
+				if time.Now().After(deadline) {
+					t.Fatalf("done = %d, want %d", atomic.LoadInt32(&done), extra+1)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+//block policy에서 가득 찬 msgQ를 처리하는 goroutine이 없으면 자리가 나지 않으므로
+//context를 잡은 pushGrid가 goroutine을 띄워야 한다.
+func TestBlockPolicyGridStartsFullQueue(t *testing.T) {
+	tests := []struct {
+		name   string
+		queued int //goroutine 없이 msgQ에 미리 넣어둔 request 수
+		pushes int
+	}{
+		{name: "empty queue", pushes: 2},
+		{name: "full queue without goroutine", queued: 1, pushes: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newTestClient()
+			cli.reqQ.gridLimit = app.QueueLimit{Max: 1, Policy: OverloadBlock}
+
+			var done int32
+			cli.RegisterGridHandler("A", func(cli Client, msg *RequestMsg, gridData interface{}) interface{} {
+				atomic.AddInt32(&done, 1)
+				return gridData
+			})
+
+			ctx := cli.reqQ.gridCtxs.getNew("k")
+			for i := 0; i < tt.queued; i++ {
+				ctx.msgQ.PushLimit(&RequestMsg{Header: ReqHeader{Api: "A", Key: "k"}}, 1)
+			}
+
+			for i := 0; i < tt.pushes; i++ {
+				cli.reqQ.pushGrid(&RequestMsg{Header: ReqHeader{Api: "A", Key: "k"}})
+			}
+
+			want := int32(tt.queued + tt.pushes)
+			deadline := time.Now().Add(2 * time.Second)
+			for atomic.LoadInt32(&done) < want {
+				if time.Now().After(deadline) {
+					t.Fatalf("done = %d, want %d", atomic.LoadInt32(&done), want)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/********************************************************************************
+* protocol.go
+* 접속할때 protocol version과 capability를 정한다.
+* ConnectMsg는 지원하는 version 범위와 capability를 보내고, 받는 쪽은 둘 다 지원하는
+* 가장 높은 version과 공통 capability를 AcceptMsg로 돌려준다. 맞는 version이 없으면 거절한다.
+* Version을 보내지 않는 peer는 ProtocolLegacyVersion으로 보고 capability가 없다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"fmt"
+
+	"github.com/Azraid/pasque/app"
+)
+
+const (
+	ProtocolLegacyVersion = 1 //JSON frame만 쓰는 version
+	ProtocolVersion       = 2 //chunk, codec, compress, trace를 capability로 정하는 version
+)
+
+const (
+	CapChunk    = "chunk"    //큰 body를 chunk frame으로 나눠 받을 수 있다.
+	CapCodec    = "codec"    //Codecs로 정한 codec을 쓸 수 있다.
+	CapCompress = "compress" //압축된 body를 받을 수 있다.
+	CapTrace    = "trace"    //header의 trace 정보를 이어받는다.
+)
+
+//ProtocolIO는 접속할때 정한 protocol을 기억하는 NetIO이다.
+type ProtocolIO interface {
+	SetProtocol(version int, caps []string)
+	SetConnected()
+}
+
+func localCaps() []string {
+	return []string{CapChunk, CapCodec, CapCompress, CapTrace}
+}
+
+//minProtocolVersion은 접속을 받는 최소 version이다. 모든 노드를 올린 뒤 설정에서 올린다.
+func minProtocolVersion() int {
+	if app.Config != nil && app.Config.Global.MinProtocol > 0 {
+		return app.Config.Global.MinProtocol
+	}
+
+	return ProtocolLegacyVersion
+}
+
+//peerVersions는 peer가 보낸 version 범위이다.
+func peerVersions(minVersion int, version int) (int, int) {
+	if version == 0 {
+		version = ProtocolLegacyVersion
+	}
+
+	if minVersion == 0 || minVersion > version {
+		minVersion = version
+	}
+
+	return minVersion, version
+}
+
+//NegotiateProtocol은 ConnectMsg를 보고 둘 다 지원하는 가장 높은 version과 공통 capability를 고른다.
+func NegotiateProtocol(h *ConnHeader) (int, []string, NError) {
+	peerMin, peerMax := peerVersions(h.MinVersion, h.Version)
+
+	version := ProtocolVersion
+	if peerMax < version {
+		version = peerMax
+	}
+
+	if version < peerMin || version < minProtocolVersion() {
+		return 0, nil, CoRaiseNError(NErrorVersionMismatch, 1,
+			fmt.Sprintf("protocol version %d-%d is not compatible with %d-%d", peerMin, peerMax, minProtocolVersion(), ProtocolVersion))
+	}
+
+	if version < ProtocolVersion {
+		return version, nil, nil
+	}
+
+	var caps []string
+	for _, c := range localCaps() {
+		if HasCap(h.Caps, c) {
+			caps = append(caps, c)
+		}
+	}
+
+	return version, caps, nil
+}
+
+//CheckAcceptProtocol은 AcceptMsg로 받은 version을 사용할 수 있는지 확인한다.
+func CheckAcceptProtocol(body *AccptBody) (int, NError) {
+	version := body.Version
+	if version == 0 {
+		version = ProtocolLegacyVersion
+	}
+
+	if version > ProtocolVersion || version < minProtocolVersion() {
+		return 0, CoRaiseNError(NErrorVersionMismatch, 1,
+			fmt.Sprintf("accepted protocol version %d is not in %d-%d", version, minProtocolVersion(), ProtocolVersion))
+	}
+
+	return version, nil
+}
+
+func HasCap(caps []string, c string) bool {
+	for _, v := range caps {
+		if v == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+//SetLinkProtocol은 정해진 version과 capability를 rw에 적용하고 handshake를 마친다.
+//codec은 CapCodec이 있을때만 사용한다. 이후에 다른 메세지를 보낼 수 있다.
+func SetLinkProtocol(rw NetIO, version int, caps []string, codec string) error {
+	if pio, ok := rw.(ProtocolIO); ok {
+		pio.SetProtocol(version, caps)
+	}
+
+	if !HasCap(caps, CapCodec) {
+		codec = CodecJSON
+	}
+
+	if err := SetLinkCodec(rw, codec); err != nil {
+		return err
+	}
+
+	SetLinkCompress(rw, HasCap(caps, CapCompress))
+
+	if pio, ok := rw.(ProtocolIO); ok {
+		pio.SetConnected()
+	}
+
+	return nil
+}
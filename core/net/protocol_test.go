@@ -0,0 +1,200 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azraid/pasque/app"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      ConnHeader
+		minProtocol int
+		version     int
+		caps        []string
+		mismatch    bool
+	}{
+		{name: "legacy peer", header: ConnHeader{}, version: ProtocolLegacyVersion},
+		{name: "legacy peer with caps", header: ConnHeader{Caps: []string{CapChunk}}, version: ProtocolLegacyVersion},
+		{name: "same version", header: ConnHeader{Version: ProtocolVersion, Caps: localCaps()}, version: ProtocolVersion, caps: localCaps()},
+		{name: "common caps", header: ConnHeader{Version: ProtocolVersion, Caps: []string{CapCompress, "unknown", CapChunk}}, version: ProtocolVersion, caps: []string{CapChunk, CapCompress}},
+		{name: "no caps", header: ConnHeader{Version: ProtocolVersion}, version: ProtocolVersion},
+		{name: "newer peer", header: ConnHeader{MinVersion: ProtocolLegacyVersion, Version: ProtocolVersion + 1, Caps: []string{CapTrace}}, version: ProtocolVersion, caps: []string{CapTrace}},
+		{name: "newer peer only", header: ConnHeader{MinVersion: ProtocolVersion + 1, Version: ProtocolVersion + 2}, mismatch: true},
+		{name: "min version over version", header: ConnHeader{MinVersion: ProtocolVersion + 1, Version: ProtocolVersion}, version: ProtocolVersion},
+		{name: "legacy rejected", header: ConnHeader{}, minProtocol: ProtocolVersion, mismatch: true},
+		{name: "current accepted", header: ConnHeader{Version: ProtocolVersion}, minProtocol: ProtocolVersion, version: ProtocolVersion},
+	}
+
+	saved := app.Config.Global.MinProtocol
+	defer func() { app.Config.Global.MinProtocol = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Global.MinProtocol = tt.minProtocol
+
+			version, caps, nerr := NegotiateProtocol(&tt.header)
+			if tt.mismatch {
+				if nerr == nil || nerr.Code() != NErrorVersionMismatch {
+					t.Fatalf("err %v, want NErrorVersionMismatch", nerr)
+				}
+				return
+			}
+
+			if nerr != nil {
+				t.Fatal(nerr)
+			}
+
+			if version != tt.version || !reflect.DeepEqual(caps, tt.caps) {
+				t.Fatalf("version %d caps %v, want %d %v", version, caps, tt.version, tt.caps)
+			}
+		})
+	}
+}
+
+func TestCheckAcceptProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int
+		minProtocol int
+		want        int
+		mismatch    bool
+	}{
+		{name: "legacy server", version: 0, want: ProtocolLegacyVersion},
+		{name: "current", version: ProtocolVersion, want: ProtocolVersion},
+		{name: "newer than local", version: ProtocolVersion + 1, mismatch: true},
+		{name: "legacy under min", version: 0, minProtocol: ProtocolVersion, mismatch: true},
+		{name: "current at min", version: ProtocolVersion, minProtocol: ProtocolVersion, want: ProtocolVersion},
+	}
+
+	saved := app.Config.Global.MinProtocol
+	defer func() { app.Config.Global.MinProtocol = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Global.MinProtocol = tt.minProtocol
+
+			version, nerr := CheckAcceptProtocol(&AccptBody{Version: tt.version})
+			if tt.mismatch {
+				if nerr == nil || nerr.Code() != NErrorVersionMismatch {
+					t.Fatalf("err %v, want NErrorVersionMismatch", nerr)
+				}
+				return
+			}
+
+			if nerr != nil {
+				t.Fatal(nerr)
+			}
+
+			if version != tt.want {
+				t.Fatalf("version %d, want %d", version, tt.want)
+			}
+		})
+	}
+}
+
+//SetLinkProtocol은 정한 protocol을 연결에 적용하고 handshake를 마친다.
+func TestSetLinkProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  int
+		caps     []string
+		codec    string
+		msgpack  bool
+		compress bool
+		noChunk  bool
+		fail     bool
+	}{
+		{name: "legacy", version: ProtocolLegacyVersion, codec: CodecMsgPack, noChunk: true},
+		{name: "all caps json", version: ProtocolVersion, caps: localCaps(), codec: CodecJSON, compress: true},
+		{name: "all caps msgpack", version: ProtocolVersion, caps: localCaps(), codec: CodecMsgPack, msgpack: true, compress: true},
+		{name: "codec without cap", version: ProtocolVersion, caps: []string{CapChunk}, codec: CodecMsgPack},
+		{name: "no caps", version: ProtocolVersion, noChunk: true},
+		{name: "unknown codec", version: ProtocolVersion, caps: []string{CapCodec}, codec: "xml", fail: true},
+	}
+
+	saved := app.Config.Global.Compression
+	defer func() { app.Config.Global.Compression = saved }()
+	app.Config.Global.Compression.Threshold = 0
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestHandshakePair(t)
+
+			err := SetLinkProtocol(a, tt.version, tt.caps, tt.codec)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				if a.IsConnected() {
+					t.Fatal("connected after failed handshake")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, msgpack := a.getCodec().(msgPackCodec)
+			if msgpack != tt.msgpack || (a.compress > 0) != tt.compress || a.noChunk != tt.noChunk {
+				t.Fatalf("msgpack %v compress %d noChunk %v, want %v %v %v", msgpack, a.compress, a.noChunk, tt.msgpack, tt.compress, tt.noChunk)
+			}
+
+			if !a.IsConnected() {
+				t.Fatal("not connected after handshake")
+			}
+		})
+	}
+}
+
+//handshake를 마치기 전에는 Connect, Accept 메세지만 보낼 수 있다.
+func TestHandshakeWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		mpck      MsgPack
+		handshake bool //SetLinkProtocol을 한 뒤에 보낸다.
+		closed    bool //Register하지 않은 연결로 보낸다.
+		written   bool
+	}{
+		{name: "connect", mpck: BuildConnectMsgPack("c", Topology{Spn: "s"}), written: true},
+		{name: "accept", mpck: BuildAcceptMsgPack(Sucess(), AccptBody{Version: ProtocolVersion}), written: true},
+		{name: "request before handshake", mpck: NewMsgPack(MsgTypeRequest, []byte(`{}`), []byte(`{}`))},
+		{name: "response before handshake", mpck: NewMsgPack(MsgTypeResponse, []byte(`{}`), []byte(`{}`))},
+		{name: "ping before handshake", mpck: BuildPingMsgPack("c")},
+		{name: "request after handshake", mpck: NewMsgPack(MsgTypeRequest, []byte(`{}`), []byte(`{}`)), handshake: true, written: true},
+		{name: "connect without register", mpck: BuildConnectMsgPack("c", Topology{Spn: "s"}), closed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestHandshakePair(t)
+
+			if tt.handshake {
+				if err := SetLinkProtocol(a, ProtocolVersion, nil, CodecJSON); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.closed {
+				a = NewNetIO().(*conn)
+			}
+
+			err := WriteMsgPack(a, tt.mpck, false)
+			if written := err == nil; written != tt.written {
+				t.Fatalf("written %v, want %v, err %v", written, tt.written, err)
+			}
+
+			if !tt.written {
+				return
+			}
+
+			f := readTimeout(t, b)
+			if f.err != nil || f.msgType != tt.mpck.MsgType() {
+				t.Fatalf("read %c, want %c, err %v", f.msgType, tt.mpck.MsgType(), f.err)
+			}
+		})
+	}
+}
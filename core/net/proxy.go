@@ -8,6 +8,8 @@
 package net
 
 import (
+	"sync"
+
 	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
 )
@@ -17,18 +19,33 @@ type proxy struct {
 	muxio  *multiplexerIO
 	dlver  Deliverer
 	toplgy Topology
+	lock   *sync.RWMutex //toplgy는 Advertise와 재접속하는 dialer가 같이 사용한다.
 }
 
 func NewProxy(remotes []app.Node, dlver Deliverer) Proxy {
-	prx := &proxy{dlver: dlver}
-	prx.muxio = newMultiplexerIO(app.App.Eid, remotes, &prx.toplgy, prx)
+	prx := &proxy{dlver: dlver, lock: new(sync.RWMutex)}
+	prx.muxio = newMultiplexerIO(app.App.Eid, remotes, prx.topology, prx)
 
 	return prx
 }
 
+func (prx *proxy) topology() Topology {
+	prx.lock.RLock()
+	defer prx.lock.RUnlock()
+
+	return prx.toplgy
+}
+
+func (prx *proxy) setTopology(toplgy Topology) {
+	prx.lock.Lock()
+	defer prx.lock.Unlock()
+
+	prx.toplgy = toplgy
+}
+
 //Dial() 함수는 proxy.Dial과 동일하다.
 func (prx *proxy) Dial(toplgy Topology) error {
-	prx.toplgy = toplgy
+	prx.setTopology(toplgy)
 	go goDispatch(prx.muxio)
 	prx.muxio.Dial()
 	app.RegisterService(prx)
@@ -36,11 +53,39 @@ func (prx *proxy) Dial(toplgy Topology) error {
 	return nil
 }
 
+//Advertise는 바뀐 topology를 연결된 remote에 다시 알린다.
+//이후 재접속할때도 바뀐 topology를 사용한다.
+func (prx *proxy) Advertise(toplgy Topology) error {
+	prx.setTopology(toplgy)
+
+	connMsgPack := BuildConnectMsgPack(app.App.Eid, toplgy)
+	if connMsgPack == nil {
+		return IssueErrorf("error connect message build")
+	}
+
+	prx.muxio.Broadcast(connMsgPack.Bytes())
+	return nil
+}
+
 // routesrv로 보낼때..
 // Request를 route로 보낼때는 fromEids에 자신의 eid를 맨 뒤에 붙인다.
 // Response를 route로 보낼때는 ToEids에서 자신의 eid를 뺀다.
+// Request는 보낸 router 연결을 기억해서 cancel을 그 router로만 보낸다.
 func (prx *proxy) Send(msg MsgPack) error {
-	return prx.muxio.Write(msg.Bytes(), true)
+	nio := prx.muxio.pick()
+	if nio != nil && msg.MsgType() == MsgTypeRequest {
+		if h := ParseReqHeader(msg.Header()); h != nil && h.TxnNo > 0 {
+			recordCancelRoute(h.FromEids, h.TxnNo, nio)
+		}
+	}
+
+	return prx.muxio.writeMsgPackTo(nio, msg, true)
+}
+
+//SendResponse는 response를 router로 보낸다. 같은 TxnNo는 같은 router 연결로 보내서
+//stream frame이 다른 router를 거치며 순서가 바뀌지 않게 한다.
+func (prx *proxy) SendResponse(h *ResHeader, msg MsgPack) error {
+	return prx.muxio.WriteMsgPackFor(h.TxnNo, msg, true)
 }
 
 func (prx *proxy) OnRequest(header []byte, body []byte) error {
@@ -51,6 +96,9 @@ func (prx *proxy) OnRequest(header []byte, body []byte) error {
 	} else {
 		msg := NewMsgPack(MsgTypeRequest, header, body)
 		if err := prx.dlver.LocalRequest(h, msg); err != nil {
+			AddDeadLetter(err.Error(), "", msg, Redeliver(prx.dlver))
+			//router를 거쳐 request를 보낸 쪽으로 되돌려 준다.
+			ReplyNotFound(prx.dlver, false, h, err)
 			return err
 		}
 	}
@@ -64,7 +112,11 @@ func (prx *proxy) OnResponse(header []byte, body []byte) error {
 		return IssueErrorf("paring response error! %s", string(header))
 	} else {
 		msg := NewMsgPack(MsgTypeResponse, header, body)
+		if h.Stream != StreamFrameMore {
+			forgetCancelRoute(h.ToEids, h.TxnNo)
+		}
 		if err := prx.dlver.LocalResponse(h, msg); err != nil {
+			AddDeadLetter(err.Error(), "", msg, Redeliver(prx.dlver))
 			return err
 		}
 	}
@@ -72,6 +124,16 @@ func (prx *proxy) OnResponse(header []byte, body []byte) error {
 	return nil
 }
 
+//OnCancel은 router에서 온 cancel을 request를 보낸 provider에게 전달한다.
+func (prx *proxy) OnCancel(header []byte, body []byte) error {
+	h := ParseCancelHeader(header)
+	if h == nil {
+		return IssueErrorf("paring cancel error! %s", string(header))
+	}
+
+	return DeliverCancel(h, NewMsgPack(MsgTypeCancel, header, body))
+}
+
 func (prx *proxy) Shutdown() bool {
 	prx.muxio.Close()
 	return true
@@ -10,31 +10,139 @@ package net
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
 )
 
 type reqQ struct {
-	gridHandlers map[string]func(cli Client, msg *RequestMsg, gridData interface{}) interface{}
-	randHandlers map[string]func(cli Client, msg *RequestMsg)
-	gridCtxs     *gridContexts
-	lock         *sync.RWMutex
-	cli          *client
+	gridHandlers  map[string]func(cli Client, msg *RequestMsg, gridData interface{}) interface{}
+	randHandlers  map[string]func(cli Client, msg *RequestMsg)
+	topicHandlers map[string]func(cli Client, msg *RequestMsg)
+	gridCtxs      *gridContexts
+	interceptors  []Interceptor
+	gridCtors     map[reflect.Type]func(key string) interface{} //grid data 타입별 생성자
+	gridLimit     app.QueueLimit
+	randLimit     app.QueueLimit
+	randSem       chan struct{} //처리중인 rand/topic request 수를 제한한다.
+	lane          *blockLane    //block policy에서 dispatch goroutine 대신 기다린다.
+	pool          *workerPool
+	apiPools      map[string]*workerPool
+	idem          *idemCache
+	inflight      map[string]*RequestMsg //cancel 메세지를 받을 수 있는 처리중인 request
+	cancelLock    *sync.Mutex
+	lock          *sync.RWMutex
+	cli           *client
 }
 
 func newReqQ(cli *client) *reqQ {
 	q := &reqQ{
-		cli:          cli,
-		gridHandlers: make(map[string]func(cli Client, msg *RequestMsg, gridData interface{}) interface{}),
-		randHandlers: make(map[string]func(cli Client, msg *RequestMsg)),
+		cli:           cli,
+		gridHandlers:  make(map[string]func(cli Client, msg *RequestMsg, gridData interface{}) interface{}),
+		randHandlers:  make(map[string]func(cli Client, msg *RequestMsg)),
+		topicHandlers: make(map[string]func(cli Client, msg *RequestMsg)),
+		gridCtors:     make(map[reflect.Type]func(key string) interface{}),
+		apiPools:      make(map[string]*workerPool),
+		inflight:      make(map[string]*RequestMsg),
+		cancelLock:    new(sync.Mutex),
 	}
 
 	q.gridCtxs = newGridContexts()
+	q.idem = newIdemCache(cli)
+	q.lane = newBlockLane(app.Config.Global.Queues.Dispatch.Max)
+
+	cfg := app.Config.Global.Queues
+	q.gridLimit = app.QueueLimit{Max: cfg.Grid.Max, Policy: overloadPolicy(cfg.Grid.Policy, OverloadReject)}
+	q.randLimit = app.QueueLimit{Max: cfg.Rand.Max, Policy: overloadPolicy(cfg.Rand.Policy, OverloadReject)}
+	if q.randLimit.Max > 0 {
+		q.randSem = make(chan struct{}, q.randLimit.Max)
+	}
+
+	RegisterQueueDepth("grid", q.gridLimit, q.gridCtxs.Depth)
+	RegisterQueueDepth("rand", q.randLimit, func() int { return len(q.randSem) })
+	RegisterQueueDepth("blocked", app.QueueLimit{Max: cap(q.lane.jobC), Policy: OverloadReject}, q.lane.Len)
+
+	q.initWorkers()
 	return q
 }
 
+//pushGrid는 grid key의 msgQ에 넣고, 처리하는 goroutine이 없으면 만든다.
+//block policy에서 자리가 없으면 dispatch goroutine 대신 blockLane이 기다린다.
+func (q *reqQ) pushGrid(msg *RequestMsg) {
+	start := func(ctx *gridContext, ok bool) {
+		if ok {
+			go goReqGridHandle(q, ctx)
+		}
+	}
+
+	if q.gridLimit.Policy != OverloadBlock {
+		ctx, ok, dropped := q.gridCtxs.PushAndAcquire(msg.Header.Key, msg, q.gridLimit)
+		if dropped != nil {
+			q.replyBusy(dropped, "grid queue")
+		}
+		start(ctx, ok)
+		return
+	}
+
+	queued := q.lane.Do(func() bool {
+		//넣지 못했어도 context를 잡았으면 가득 찬 msgQ를 처리할 goroutine을 띄워야 한다.
+		ctx, ok, dropped := q.gridCtxs.PushAndAcquire(msg.Header.Key, msg, q.gridLimit)
+		start(ctx, ok)
+		return dropped == nil
+	}, func() {
+		q.gridCtxs.PushWaitAndAcquire(msg.Header.Key, msg, q.gridLimit.Max, start)
+	})
+
+	if !queued {
+		q.replyBusy(msg, "grid queue")
+	}
+}
+
+//submitRandHandle은 rand/topic request를 처리할 자리를 잡고 goroutine으로 처리한다.
+//자리가 없으면 block이 아닌 경우 NErrorServerBusy로 응답한다.
+//block이면 dispatch goroutine 대신 blockLane이 자리가 나기를 기다린다.
+func (q *reqQ) submitRandHandle(msg *RequestMsg) {
+	if q.randSem == nil {
+		go goReqRandHandle(q, msg)
+		return
+	}
+
+	acquire := func() bool {
+		select {
+		case q.randSem <- struct{}{}:
+			go goReqRandHandle(q, msg)
+			return true
+		default:
+			return false
+		}
+	}
+
+	if q.randLimit.Policy != OverloadBlock {
+		if !acquire() {
+			q.replyBusy(msg, "rand queue")
+		}
+		return
+	}
+
+	queued := q.lane.Do(acquire, func() {
+		q.randSem <- struct{}{}
+		go goReqRandHandle(q, msg)
+	})
+
+	if !queued {
+		q.replyBusy(msg, "rand queue")
+	}
+}
+
+func (q *reqQ) releaseRand() {
+	if q.randSem != nil {
+		<-q.randSem
+	}
+}
+
 func (q *reqQ) Dispatch(rawHeader []byte, rawBody []byte) error {
 	h := ParseReqHeader(rawHeader)
 	if h == nil {
@@ -43,18 +151,32 @@ func (q *reqQ) Dispatch(rawHeader []byte, rawBody []byte) error {
 
 	msg := &RequestMsg{Header: *h, Body: rawBody}
 
-	if len(msg.Header.Key) > 0 {
-		if ctx, ok := q.gridCtxs.PushAndAcquire(msg.Header.Key, msg); ok {
-			go goReqGridHandle(q, ctx)
+	if q.rejectExpired(msg) {
+		return nil
+	}
+
+	if len(msg.Header.Topic) > 0 {
+		if !q.idem.Begin(msg) {
+			q.submitRand(msg)
 		}
+		return nil
+	}
+
+	if q.idem.Begin(msg) {
+		return nil
+	}
+
+	q.track(msg)
 
+	if len(msg.Header.Key) > 0 {
+		q.pushGrid(msg)
 	} else {
 		if _, ok := q.gridHandlers[msg.Header.Api]; ok {
-			app.ErrorLog("grid api %v with no key", msg.Header)
+			app.ErrorLog("%s grid api %v with no key", msg.Header.TraceTag(), msg.Header)
 			nerr := CoRaiseNError(NErrorFederationError, 1, fmt.Sprintf("%s no key", msg.Header.Api))
 			q.cli.SendResWithError(msg, nerr, nil)
 		} else {
-			go goReqRandHandle(q, msg)
+			q.submitRand(msg)
 		}
 	}
 
@@ -79,6 +201,19 @@ func (q reqQ) ListRandApis() []string {
 	return s
 }
 
+func (q reqQ) ListTopics() []string {
+	var s []string
+	for k, _ := range q.topicHandlers {
+		s = append(s, k)
+	}
+
+	return s
+}
+
+func (q *reqQ) Subscribe(topic string, handler func(cli Client, msg *RequestMsg)) {
+	q.topicHandlers[topic] = handler
+}
+
 func (q *reqQ) RegisterGridHandler(api string, handler func(cli Client, msg *RequestMsg, gridData interface{}) interface{}) {
 	q.gridHandlers[api] = handler
 }
@@ -87,24 +222,127 @@ func (q *reqQ) RegisterRandHandler(api string, handler func(cli Client, msg *Req
 	q.randHandlers[api] = handler
 }
 
+//RegisterGridHandlerR은 handler가 돌려준 (gridData, resBody, NError)로 framework가 한번만 응답한다.
+//nerr가 nil이면 성공으로 처리한다. noti(TxnNo == 0)는 응답하지 않는다.
+//handler가 직접 먼저 응답한 경우에는 resBody와 nerr 모두 nil을 돌려줘야 한다.
+func (q *reqQ) RegisterGridHandlerR(api string, handler func(cli Client, msg *RequestMsg, gridData interface{}) (interface{}, interface{}, NError)) {
+	q.RegisterGridHandler(api, func(cli Client, msg *RequestMsg, gridData interface{}) interface{} {
+		newData, resBody, nerr := handler(cli, msg, gridData)
+		autoReply(cli, msg, resBody, nerr)
+		return newData
+	})
+}
+
+//RegisterRandHandlerR은 handler가 돌려준 (resBody, NError)로 framework가 한번만 응답한다.
+func (q *reqQ) RegisterRandHandlerR(api string, handler func(cli Client, msg *RequestMsg) (interface{}, NError)) {
+	q.RegisterRandHandler(api, func(cli Client, msg *RequestMsg) {
+		resBody, nerr := handler(cli, msg)
+		autoReply(cli, msg, resBody, nerr)
+	})
+}
+
+func autoReply(cli Client, msg *RequestMsg, resBody interface{}, nerr NError) {
+	if msg.Header.TxnNo == 0 {
+		return
+	}
+
+	if msg.IsReplied() && resBody == nil && nerr == nil {
+		return
+	}
+
+	if nerr == nil || nerr.IsSuccess() {
+		cli.SendRes(msg, resBody)
+	} else {
+		cli.SendResWithError(msg, nerr, resBody)
+	}
+}
+
+//rejectExpired는 caller가 이미 포기한 request에 대해 NErrorTimeout으로 응답한다.
+func (q *reqQ) rejectExpired(msg *RequestMsg) bool {
+	if !msg.Header.IsExpired(time.Now()) {
+		return false
+	}
+
+	app.DebugLog("%s expired request %v", msg.Header.TraceTag(), msg.Header)
+	nerr := CoRaiseNError(NErrorTimeout, 1, fmt.Sprintf("%s deadline expired", msg.Header.Api))
+	q.cli.SendResWithError(msg, nerr, nil)
+	return true
+}
+
+//safeInvoke는 handler의 panic을 잡아서 NErrorInternal로 응답한다.
+//돌려주는 errCode는 handler가 보낸 응답의 ErrCode이고, span에 그대로 남긴다.
+//grid handler의 경우 gridData는 panic 이전 값을 유지하고, 남은 msgQ는 계속 처리한다.
+func (q *reqQ) safeInvoke(msg *RequestMsg, handle func()) (errCode int) {
+	defer func() {
+		if r := recover(); r != nil {
+			errCode = NErrorInternal
+			app.Dump(fmt.Sprintf("%s handler panic api[%s] key[%s] txnNo[%d] %v",
+				msg.Header.TraceTag(), msg.Header.Api, msg.Header.Key, msg.Header.TxnNo, r))
+			app.ErrorLog("%s handler panic api[%s] key[%s] %v", msg.Header.TraceTag(), msg.Header.Api, msg.Header.Key, r)
+
+			if msg.Header.TxnNo > 0 && !msg.IsReplied() {
+				nerr := CoRaiseNError(NErrorInternal, 1, fmt.Sprintf("%s panic, %v", msg.Header.Api, r))
+				q.cli.SendResWithError(msg, nerr, nil)
+			}
+		}
+	}()
+
+	q.invoke(msg, handle)
+	return msg.replyCode()
+}
+
 func goReqRandHandle(q *reqQ, msg *RequestMsg) {
 	defer app.DumpRecover()
+	defer q.releaseRand()
 
+	q.handleJob(msg)
+}
+
+func (q *reqQ) handleRand(msg *RequestMsg) {
 	PerfAdd(PerfRandTxnProcs)
 	defer func() {
 		PerfSub(PerfRandTxnProcs)
 	}()
 
+	if q.rejectExpired(msg) || q.dropCanceled(msg) {
+		return
+	}
+
 	handler, ok := q.randHandlers[msg.Header.Api]
 	if ok {
-		handler(q.cli, msg)
+		start := time.Now()
+		errCode := q.safeInvoke(msg, func() {
+			handler(q.cli, msg)
+		})
+		q.untrack(msg)
+		recordSpan(SpanKindServer, msg.Header, start, errCode)
 	} else {
-		app.ErrorLog("not implement api %v", msg.Header)
+		app.ErrorLog("%s not implement api %v", msg.Header.TraceTag(), msg.Header)
 		nerr := CoRaiseNError(NErrorNotImplemented, 1, fmt.Sprintf("%s not implemented", msg.Header.Api))
 		q.cli.SendResWithError(msg, nerr, nil)
 	}
 }
 
+//handleTopic은 publish된 메세지를 처리한다. 응답은 보내지 않는다.
+func (q *reqQ) handleTopic(msg *RequestMsg) {
+	PerfAdd(PerfRandTxnProcs)
+	defer func() {
+		PerfSub(PerfRandTxnProcs)
+	}()
+
+	handler, ok := q.topicHandlers[msg.Header.Topic]
+	if !ok {
+		app.DebugLog("%s not subscribed topic %v", msg.Header.TraceTag(), msg.Header)
+		return
+	}
+
+	start := time.Now()
+	errCode := q.safeInvoke(msg, func() {
+		handler(q.cli, msg)
+	})
+	recordSpan(SpanKindServer, msg.Header, start, errCode)
+}
+
 func goReqGridHandle(q *reqQ, ctx *gridContext) {
 	defer app.DumpRecover()
 	
@@ -124,11 +362,19 @@ func goReqGridHandle(q *reqQ, ctx *gridContext) {
 		}
 
 		msg := e.Value.(*RequestMsg)
+		if q.rejectExpired(msg) || q.dropCanceled(msg) {
+			continue
+		}
 
 		if handler, ok := q.gridHandlers[msg.Header.Api]; ok {
-			ctx.data = handler(q.cli, msg, ctx.data)
+			start := time.Now()
+			errCode := q.safeInvoke(msg, func() {
+				ctx.data = handler(q.cli, msg, ctx.data)
+			})
+			q.untrack(msg)
+			recordSpan(SpanKindServer, msg.Header, start, errCode)
 		} else {
-			app.ErrorLog("not implement api %v", msg.Header)
+			app.ErrorLog("%s not implement api %v", msg.Header.TraceTag(), msg.Header)
 			nerr := CoRaiseNError(NErrorNotImplemented, 1, fmt.Sprintf("%s not implemented", msg.Header.Api))
 			q.cli.SendResWithError(msg, nerr, nil)
 		}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+//handler가 panic하면 NErrorInternal로 응답하고, grid key의 남은 msgQ는 panic 이전 gridData로 계속 처리한다.
+func TestHandlerPanic(t *testing.T) {
+	internal := fmt.Sprintf("code %d", NErrorInternal)
+
+	tests := []struct {
+		name  string
+		grid  bool
+		txns  int
+		panic uint64            //panic하는 request의 TxnNo
+		want  map[uint64]string //TxnNo별 응답, ErrCode 또는 body
+	}{
+		{name: "rand", txns: 2, panic: 1, want: map[uint64]string{1: internal, 2: "body 1"}},
+		{name: "grid drains msgQ", grid: true, txns: 3, panic: 2, want: map[uint64]string{1: "body 1", 2: internal, 3: "body 2"}},
+		{name: "grid first panics", grid: true, txns: 2, panic: 1, want: map[uint64]string{1: internal, 2: "body 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, sentQ := newTestMuxClient()
+
+			var calls int
+			cli.RegisterRandHandler("A", func(cli Client, msg *RequestMsg) {
+				if msg.Header.TxnNo == tt.panic {
+					panic("test")
+				}
+				calls++
+				cli.SendRes(msg, calls)
+			})
+
+			//gridData는 처리한 request 수이다.
+			cli.RegisterGridHandler("A", func(cli Client, msg *RequestMsg, gridData interface{}) interface{} {
+				n, _ := gridData.(int)
+				if msg.Header.TxnNo == tt.panic {
+					panic("test")
+				}
+				cli.SendRes(msg, n+1)
+				return n + 1
+			})
+
+			for i := 1; i <= tt.txns; i++ {
+				msg := &RequestMsg{Header: ReqHeader{Api: "A", TxnNo: uint64(i), FromEids: []string{"c"}}}
+				if tt.grid {
+					msg.Header.Key = "k"
+					cli.reqQ.pushGrid(msg)
+				} else {
+					cli.reqQ.handleRand(msg)
+				}
+			}
+
+			deadline := time.Now().Add(2 * time.Second)
+			for sentQ.Len() < len(tt.want) {
+				if time.Now().After(deadline) {
+					t.Fatalf("replies %d, want %d", sentQ.Len(), len(tt.want))
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			got := make(map[uint64]string)
+			for _, mpck := range sentQ.msgPacks(t) {
+				h := ParseResHeader(mpck.Header())
+				if h.ErrCode != NErrorSucess {
+					got[h.TxnNo] = fmt.Sprintf("code %d", h.ErrCode)
+				} else {
+					got[h.TxnNo] = fmt.Sprintf("body %s", mpck.Body())
+				}
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("replies %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//R handler가 돌려준 값으로 한번만 응답한다. 직접 응답한 뒤 다시 돌려준 응답은 보내지 않는다.
+func TestAutoReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		noti    bool
+		replied bool //handler가 직접 SendRes를 한다.
+		resBody interface{}
+		nerr    NError
+		want    []string //보낸 응답, ErrCode 또는 body
+	}{
+		{name: "body", resBody: 1, want: []string{"body 1"}},
+		{name: "error", nerr: CoRaiseNError(NErrorNotFound, 1, "not found"), want: []string{fmt.Sprintf("code %d", NErrorNotFound)}},
+		{name: "success without body", nerr: Sucess(), want: []string{"body {}"}},
+		{name: "noti", noti: true, resBody: 1},
+		{name: "replied by handler", replied: true, want: []string{"body 2"}},
+		{name: "double reply dropped", replied: true, resBody: 1, want: []string{"body 2"}},
+	}
+
+	for _, tt := range tests {
+		for _, grid := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s grid %v", tt.name, grid), func(t *testing.T) {
+				cli, sentQ := newTestMuxClient()
+
+				handle := func(cli Client, msg *RequestMsg) (interface{}, NError) {
+					if tt.replied {
+						cli.SendRes(msg, 2)
+					}
+					return tt.resBody, tt.nerr
+				}
+
+				msg := &RequestMsg{Header: ReqHeader{Api: "A", FromEids: []string{"c"}}}
+				if !tt.noti {
+					msg.Header.TxnNo = 1
+				}
+
+				if grid {
+					cli.RegisterGridHandlerR("A", func(cli Client, msg *RequestMsg, gridData interface{}) (interface{}, interface{}, NError) {
+						resBody, nerr := handle(cli, msg)
+						return gridData, resBody, nerr
+					})
+					cli.reqQ.gridHandlers["A"](cli, msg, nil)
+				} else {
+					cli.RegisterRandHandlerR("A", handle)
+					cli.reqQ.randHandlers["A"](cli, msg)
+				}
+
+				var got []string
+				for _, mpck := range sentQ.msgPacks(t) {
+					if h := ParseResHeader(mpck.Header()); h.ErrCode != NErrorSucess {
+						got = append(got, fmt.Sprintf("code %d", h.ErrCode))
+					} else {
+						got = append(got, fmt.Sprintf("body %s", mpck.Body()))
+					}
+				}
+
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Fatalf("replies %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -8,6 +8,7 @@
 package net
 
 import (
+	"fmt"
 	"runtime"
 	"sync"
 	"time"
@@ -17,9 +18,10 @@ import (
 )
 
 type roundTrip struct {
-	req   *RequestMsg
-	res   chan *ResponseMsg
-	stamp time.Time
+	req    *RequestMsg
+	res    chan *ResponseMsg
+	stream *ResponseStream //streaming request이면 res 대신 사용한다.
+	stamp  time.Time
 }
 
 //RoundTripMap 은 RoundTrip을 관리하는 container이다.
@@ -66,7 +68,11 @@ func (q *resQ) Final() {
 
 	for _, rtM := range q.rtMaps {
 		for _, rt := range rtM.maps {
-			close(rt.res)
+			if rt.stream != nil {
+				rt.stream.finish(CoRaiseNError(NErrorAppStopping, 1, "Application stopping"))
+			} else {
+				close(rt.res)
+			}
 		}
 	}
 }
@@ -79,11 +85,24 @@ func (q *resQ) find(txnNo uint64) *roundTrip {
 	return nil
 }
 
-func (q *resQ) addRoundTrip(txnNo uint64, req *RequestMsg, res chan *ResponseMsg) {
+func (q *resQ) addRoundTrip(txnNo uint64, rt *roundTrip) {
 	rtM := q.rtMaps[q.hash(txnNo)]
 	rtM.lock.Lock()
 	defer rtM.lock.Unlock()
-	rtM.maps[txnNo] = &roundTrip{req: req, res: res, stamp: time.Now()}
+	rtM.maps[txnNo] = rt
+}
+
+//touchRoundTrip은 stream의 중간 frame을 받을때 timeout을 다시 시작한다.
+func (q *resQ) touchRoundTrip(txnNo uint64) *roundTrip {
+	rtM := q.rtMaps[q.hash(txnNo)]
+	rtM.lock.Lock()
+	defer rtM.lock.Unlock()
+
+	if rt, ok := rtM.maps[txnNo]; ok {
+		rt.stamp = time.Now()
+		return rt
+	}
+	return nil
 }
 
 func (q *resQ) delRoundTrip(txnNo uint64) *roundTrip {
@@ -99,14 +118,29 @@ func (q *resQ) delRoundTrip(txnNo uint64) *roundTrip {
 }
 
 func (q *resQ) Push(txnNo uint64, req *RequestMsg, res chan *ResponseMsg) {
-	q.addRoundTrip(txnNo, req, res)
+	q.addRoundTrip(txnNo, &roundTrip{req: req, res: res, stamp: time.Now()})
+}
+
+func (q *resQ) PushStream(txnNo uint64, req *RequestMsg, s *ResponseStream) {
+	q.addRoundTrip(txnNo, &roundTrip{req: req, stream: s, stamp: time.Now()})
+}
+
+//Cancel은 caller가 더이상 기다리지 않는 round trip을 제거한다.
+//이미 response가 처리되었다면 nil을 돌려준다.
+func (q *resQ) Cancel(txnNo uint64) *roundTrip {
+	return q.delRoundTrip(txnNo)
 }
 
 func (q *resQ) Fire(txnNo uint64) {
 	if rt := q.delRoundTrip(txnNo); rt != nil {
 		var res ResponseMsg
 		res.Header = ResHeader{TxnNo: txnNo, ErrCode: NErrorTimeout, ErrText: "Internal Expired"}
-		rt.res <- &res
+		if rt.stream != nil {
+			rt.stream.finish(res.Header.GetError())
+		} else {
+			rt.res <- &res
+		}
+		q.cli.sendCancel(rt.req.Header, res.Header.ErrText)
 	}
 }
 
@@ -123,13 +157,45 @@ func (q *resQ) Dispatch(rawHeader []byte, rawBody []byte) error {
 	var res ResponseMsg
 	res.Header = *h
 	res.Body = rawBody
+
+	if h.Stream == StreamFrameMore {
+		q.dispatchFrame(rawHeader, &res)
+		return nil
+	}
+
 	if rt := q.delRoundTrip(h.TxnNo); rt != nil {
-		rt.res <- &res
+		if rt.stream != nil {
+			rt.stream.end(&res)
+		} else {
+			rt.res <- &res
+		}
+	} else { //이미 timeout 되었거나 모르는 txn이다.
+		AddDeadLetter(fmt.Sprintf("txn[%d] not found", h.TxnNo), "", NewMsgPack(MsgTypeResponse, rawHeader, rawBody), nil)
 	}
 
 	return nil
 }
 
+//dispatchFrame은 stream의 중간 frame을 넘긴다.
+//caller가 받아가지 않아 buffer가 차면 stream을 끝내고 provider에게 cancel을 보낸다.
+func (q *resQ) dispatchFrame(rawHeader []byte, res *ResponseMsg) {
+	rt := q.touchRoundTrip(res.Header.TxnNo)
+	if rt == nil || rt.stream == nil {
+		AddDeadLetter(fmt.Sprintf("stream txn[%d] not found", res.Header.TxnNo), "", NewMsgPack(MsgTypeResponse, rawHeader, res.Body), nil)
+		return
+	}
+
+	if rt.stream.push(res) {
+		return
+	}
+
+	if q.delRoundTrip(res.Header.TxnNo) != nil {
+		nerr := CoRaiseNError(NErrorServerBusy, 1, "stream buffer full")
+		rt.stream.finish(nerr)
+		q.cli.sendCancel(rt.req.Header, nerr.Error())
+	}
+}
+
 func (q *resQ) NumProcess() int {
 	var num int
 	for _, rtM := range q.rtMaps {
@@ -0,0 +1,49 @@
+/********************************************************************************
+* rpc.go
+* rpcgen으로 생성된 typed stub들이 사용하는 helper.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//Call은 request를 보내고 response body를 resBody로 unmarshal한다.
+func Call(ctx context.Context, cli Client, spn string, api string, reqBody interface{}, resBody interface{}) NError {
+	res, err := cli.SendReqCtx(ctx, spn, api, reqBody)
+	if err != nil {
+		if nerr, ok := err.(NError); ok {
+			return nerr
+		}
+		return CoRaiseNError(NErrorInternal, 2, err.Error())
+	}
+
+	if res.Header.ErrCode != NErrorSucess {
+		return res.Header.GetError()
+	}
+
+	if err := json.Unmarshal(res.Body, resBody); err != nil {
+		return CoRaiseNError(NErrorParsingError, 2, err.Error())
+	}
+
+	return Sucess()
+}
+
+//DecodeBody는 request body를 unmarshal한다.
+//실패하면 NErrorParsingError로 응답하고 false를 돌려준다.
+func DecodeBody(cli Client, req *RequestMsg, body interface{}) bool {
+	if err := json.Unmarshal(req.Body, body); err != nil {
+		app.ErrorLog("%s %s %s", req.Header.TraceTag(), req.Header.Api, err.Error())
+		cli.SendResWithError(req, CoRaiseNError(NErrorParsingError, 2, err.Error()), nil)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+/********************************************************************************
+* scatter.go
+* spn의 모든 provider에게 request를 보내고, 각각의 response를 모은다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//ScatterResult는 provider 하나의 결과이다. Err가 성공이 아니면 Res는 nil일 수 있다.
+type ScatterResult struct {
+	Eid string
+	Res *ResponseMsg
+	Err NError
+}
+
+func (cli *client) ScatterGather(spn string, api string, body interface{}) (results []ScatterResult, nerr NError) {
+	return cli.ScatterGatherCtx(context.Background(), spn, api, body)
+}
+
+//ScatterGatherCtx는 config에 등록된 spn의 provider마다 request를 보내고 모든 결과를 기다린다.
+//일부만 실패하면 NErrorPartialFailure를, 모두 실패하면 첫번째 에러를 돌려준다.
+func (cli *client) ScatterGatherCtx(ctx context.Context, spn string, api string, body interface{}) (results []ScatterResult, nerr NError) {
+	svcgrp, ok := app.Config.Global.FindSvcGateGroup(spn)
+	if !ok || len(svcgrp.Providers) == 0 {
+		return nil, CoRaiseNError(NErrorInvalidparams, 1, fmt.Sprintf("no provider of %s", spn))
+	}
+
+	results = make([]ScatterResult, len(svcgrp.Providers))
+	wg := new(sync.WaitGroup)
+	for i, prov := range svcgrp.Providers {
+		results[i].Eid = prov.Eid
+
+		wg.Add(1)
+		go func(r *ScatterResult) {
+			defer wg.Done()
+
+			res, err := cli.sendReq(ctx, ReqHeader{Spn: spn, ToEid: r.Eid, Api: api, Fanout: true}, body)
+			r.Res = res
+			if err != nil {
+				if ne, ok := err.(NError); ok {
+					r.Err = ne
+				} else {
+					r.Err = CoRaiseNError(NErrorInternal, 1, err.Error())
+				}
+			} else if res.Header.ErrCode != NErrorSucess {
+				r.Err = res.Header.GetError()
+			} else {
+				r.Err = Sucess()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if !r.Err.IsSuccess() {
+			failed++
+			app.ErrorLog("scatter %s.%s to %s, %s", spn, api, r.Eid, r.Err.Error())
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return results, Sucess()
+	case failed == len(results):
+		return results, results[0].Err
+	}
+
+	return results, CoRaiseNError(NErrorPartialFailure, 1, fmt.Sprintf("%d/%d failed", failed, len(results)))
+}
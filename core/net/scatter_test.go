@@ -0,0 +1,98 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//testResponder는 보낸 request에 ToEid별로 정한 ErrCode로 응답한다. codes에 없는 eid는 응답하지 않는다.
+func testResponder(cli *client, rw *testNetIO, codes map[string]int, done chan struct{}) {
+	for sent := 0; ; {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Millisecond):
+		}
+
+		rw.lock.Lock()
+		frames := rw.frames[sent:]
+		sent = len(rw.frames)
+		rw.lock.Unlock()
+
+		for _, b := range frames {
+			mpck, err := ParseMsgPack(b)
+			if err != nil || mpck.MsgType() != MsgTypeRequest {
+				continue
+			}
+
+			h := ParseReqHeader(mpck.Header())
+			code, ok := codes[h.ToEid]
+			if !ok {
+				continue
+			}
+
+			res, _ := BuildMsgPack(ResHeader{TxnNo: h.TxnNo, ErrCode: code}, nil)
+			cli.resQ.Dispatch(res.Header(), res.Body())
+		}
+	}
+}
+
+//일부만 실패하면 NErrorPartialFailure, 모두 실패하면 첫번째 에러를 돌려주고 provider별 결과를 채운다.
+func TestScatterGatherPartialFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes map[string]int //응답하지 않는 provider는 timeout이다.
+		want  int
+	}{
+		{name: "all success", codes: map[string]int{"p1": NErrorSucess, "p2": NErrorSucess, "p3": NErrorSucess}, want: NErrorSucess},
+		{name: "one error", codes: map[string]int{"p1": NErrorSucess, "p2": NErrorNotFound, "p3": NErrorSucess}, want: NErrorPartialFailure},
+		{name: "one timeout", codes: map[string]int{"p1": NErrorSucess, "p2": NErrorSucess}, want: NErrorPartialFailure},
+		{name: "all failed", codes: map[string]int{"p1": NErrorNotFound, "p2": NErrorInternal}, want: NErrorNotFound},
+	}
+
+	saved := app.Config.Global.SNodes
+	defer func() { app.Config.Global.SNodes = saved }()
+
+	var grp app.SvcGateGroup
+	grp.Spn = "scatter"
+	grp.Providers = []app.Node{{Eid: "p1"}, {Eid: "p2"}, {Eid: "p3"}}
+	app.Config.Global.SNodes = []app.SvcGateGroup{grp}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxio, rws := newTestMuxIO(1)
+			cli := newTestClient()
+			cli.muxio = muxio
+
+			done := make(chan struct{})
+			defer close(done)
+			go testResponder(cli, rws[0], tt.codes, done)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			results, nerr := cli.ScatterGatherCtx(ctx, "scatter", "A", nil)
+			if nerr.Code() != tt.want {
+				t.Fatalf("error code %d, want %d", nerr.Code(), tt.want)
+			}
+
+			if len(results) != len(grp.Providers) {
+				t.Fatalf("results %d, want %d", len(results), len(grp.Providers))
+			}
+
+			for i, r := range results {
+				want := NErrorTimeout
+				if code, ok := tt.codes[r.Eid]; ok {
+					want = code
+				}
+
+				if r.Eid != grp.Providers[i].Eid || r.Err.Code() != want {
+					t.Fatalf("result %s code %d, want %s %d", r.Eid, r.Err.Code(), grp.Providers[i].Eid, want)
+				}
+			}
+		})
+	}
+}
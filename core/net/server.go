@@ -40,7 +40,10 @@ func (rt *routeTable) find(eid string) (Stub, bool) {
 }
 
 func (rt *routeTable) loadOrStore(eid string, rw NetIO, dlver Deliverer) Stub {
-	stb, _ := rt.stbs.LoadOrStore(eid, NewStub(eid, dlver))
+	stb, ok := rt.stbs.Load(eid)
+	if !ok {
+		stb, _ = rt.stbs.LoadOrStore(eid, NewStub(eid, dlver))
+	}
 	stb.(Stub).ResetConn(rw)
 	return stb.(Stub)
 }
@@ -191,15 +194,23 @@ func (srv *Server) SendRandom(spn string, mpck MsgPack) error {
 			}
 		} else {
 			//active list가 없다면, 아무데나 넣는다.
+			sent := false
 			rt.(*routeTable).stbs.Range(
 				func(k, v interface{}) bool {
 					v.(Stub).Send(mpck)
+					sent = true
 					return false
 				})
+
+			if !sent {
+				return IssueErrorf("%s not found", spn)
+			}
 		}
+
+		return nil
 	}
 
-	return nil
+	return IssueErrorf("%s not found", spn)
 }
 
 func (srv *Server) Shutdown() bool {
@@ -264,7 +275,7 @@ func goAccept(srv *Server, rwc net.Conn) {
 	msgType, rawHeader, rawBody, err := conn.Read()
 	if err != nil {
 		app.ErrorLog("Server Accept err %s", err.Error())
-		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "unknown msg format"), "", "")
+		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "unknown msg format"), AccptBody{})
 		if acptMsg != nil {
 			conn.Write(acptMsg.Bytes(), true)
 		}
@@ -274,7 +285,7 @@ func goAccept(srv *Server, rwc net.Conn) {
 
 	if msgType != MsgTypeConnect {
 		app.ErrorLog("Server Accept not received connection message, %s", string(rawHeader))
-		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "unknown msgtype"), "", "")
+		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "unknown msgtype"), AccptBody{})
 		if acptMsg != nil {
 			conn.Write(acptMsg.Bytes(), true)
 		}
@@ -285,7 +296,18 @@ func goAccept(srv *Server, rwc net.Conn) {
 	connMsg := ParseConnectMsg(rawHeader, rawBody)
 	if connMsg == nil {
 		app.ErrorLog("Server Accept parse error!, %s", string(rawHeader))
-		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "parse error"), "", "")
+		acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorParsingError, 1, "parse error"), AccptBody{})
+		if acptMsg != nil {
+			conn.Write(acptMsg.Bytes(), true)
+		}
+		conn.Close()
+		return
+	}
+
+	version, caps, nerr := NegotiateProtocol(&connMsg.Header)
+	if nerr != nil {
+		app.ErrorLog("[%s] %s", connMsg.Header.Eid, nerr.Error())
+		acptMsg := BuildAcceptMsgPack(nerr, AccptBody{})
 		if acptMsg != nil {
 			conn.Write(acptMsg.Bytes(), true)
 		}
@@ -295,10 +317,10 @@ func goAccept(srv *Server, rwc net.Conn) {
 
 	// Gate에 등록할 provider 등록`
 	if srv.fdr != nil {
-		toplgy := &Topology{Spn: connMsg.Body.Spn, FederatedKey: connMsg.Body.FederatedKey, FederatedApis: connMsg.Body.FederatedApis}
+		toplgy := &Topology{Spn: connMsg.Body.Spn, FederatedKey: connMsg.Body.FederatedKey, FederatedApis: connMsg.Body.FederatedApis, Topics: connMsg.Body.Topics, Subscribers: connMsg.Body.Subscribers}
 		if err := srv.fdr.OnAccept(connMsg.Header.Eid, toplgy); err != nil {
 			app.ErrorLog("connected from wrong %v, client[%s]", err, string(rawHeader))
-			acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorFederationError, 1, "federation topology can not accepted"), "", "")
+			acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorFederationError, 1, "federation topology can not accepted"), AccptBody{})
 			if acptMsg != nil {
 				conn.Write(acptMsg.Bytes(), true)
 			}
@@ -313,7 +335,7 @@ func goAccept(srv *Server, rwc net.Conn) {
 	} else {
 		if stb.IsConnected() {
 			app.ErrorLog("[%s] already established", stb.String())
-			acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorFederationError, 1, fmt.Sprintf("[%s] already established", stb.String())), "", "")
+			acptMsg := BuildAcceptMsgPack(CoRaiseNError(NErrorFederationError, 1, fmt.Sprintf("[%s] already established", stb.String())), AccptBody{})
 			if acptMsg != nil {
 				conn.Write(acptMsg.Bytes(), true)
 			}
@@ -322,13 +344,24 @@ func goAccept(srv *Server, rwc net.Conn) {
 		}
 	}
 
-	acptMsg := BuildAcceptMsgPack(Sucess(), connMsg.Header.Eid, "")
+	codec := CodecJSON
+	if HasCap(caps, CapCodec) {
+		codec = NegotiateCodec(connMsg.Header.Codecs)
+	}
+
+	acptMsg := BuildAcceptMsgPack(Sucess(), AccptBody{Eid: connMsg.Header.Eid, Version: version, Caps: caps, Codec: codec})
 	if acptMsg != nil {
 		conn.Write(acptMsg.Bytes(), true)
 	} else {
 		app.ErrorLog("can not build")
 	}
 
+	if err := SetLinkProtocol(conn, version, caps, codec); err != nil {
+		app.ErrorLog("[%s] %s", connMsg.Header.Eid, err.Error())
+		conn.Close()
+		return
+	}
+
 	app.DebugLog("connected from %s", connMsg.Header.Eid)
 	stb.ResetConn(conn) //TODO: 이 코드는 없어도 돌 듯..
 	stb.Go()
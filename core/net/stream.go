@@ -0,0 +1,232 @@
+/********************************************************************************
+* stream.go
+* 하나의 request에 여러개의 response frame을 보내는 streaming 응답.
+* handler는 SendResStream으로 중간 frame을 보내고, SendRes나 EndResStream으로 끝낸다.
+* caller는 SendReqStream이 돌려준 ResponseStream의 Next로 frame을 차례로 받는다.
+* 채팅 이력, replay, 큰 목록처럼 MaxBufferLength를 넘는 응답을 나눠 보낼때 사용한다.
+* 한 stream의 frame은 provider와 gate에서 TxnNo로 고른 같은 연결로 보내므로 순서대로 도착한다.
+* 연결이 끊겨 unsentQ로 들어간 frame은 다시 보낼때 순서가 바뀔 수 있다.
+* flow control은 없다. caller가 받아가지 않은 frame이 StreamBufferSize(256)개를 넘으면
+* stream을 NErrorServerBusy로 끝내고 provider에게 cancel을 보낸다. provider는 SendResStream이
+* NErrorCanceled를 돌려주면 멈춘다. 그보다 많은 frame을 한번에 보낼때는 caller가 나눠서 요청한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const (
+	StreamFrameMore = 1 //뒤에 frame이 더 있다.
+	StreamFrameEnd  = 2 //body 없이 stream의 끝만 알린다.
+)
+
+//ResponseStream은 streaming request의 응답 frame을 받는다.
+type ResponseStream struct {
+	frames chan *ResponseMsg
+	done   chan struct{}
+	once   *sync.Once
+	err    NError
+	ctx    context.Context
+	cli    *client
+	header ReqHeader
+	start  time.Time
+}
+
+func newResponseStream(ctx context.Context, cli *client, header ReqHeader) *ResponseStream {
+	return &ResponseStream{
+		frames: make(chan *ResponseMsg, StreamBufferSize),
+		done:   make(chan struct{}),
+		once:   new(sync.Once),
+		ctx:    ctx,
+		cli:    cli,
+		header: header,
+		start:  time.Now(),
+	}
+}
+
+//Next는 다음 frame을 돌려준다. stream이 끝나면 false를 돌려주고, 이유는 Err로 확인한다.
+func (s *ResponseStream) Next() (*ResponseMsg, bool) {
+	select {
+	case res := <-s.frames:
+		return res, true
+	default:
+	}
+
+	select {
+	case res := <-s.frames:
+		return res, true
+
+	case <-s.done:
+		//끝나기 전에 들어온 frame을 먼저 돌려준다.
+		select {
+		case res := <-s.frames:
+			return res, true
+		default:
+			return nil, false
+		}
+
+	case <-s.ctx.Done():
+		s.abort(ctxNError(s.ctx))
+		return nil, false
+	}
+}
+
+//Err는 stream이 끝난 이유이다. 정상적으로 끝났으면 nil이다.
+func (s *ResponseStream) Err() NError {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+//Close는 남은 frame을 받지 않고 provider에게 cancel을 보낸다.
+func (s *ResponseStream) Close() {
+	s.abort(CoRaiseNError(NErrorCanceled, 1, "stream closed"))
+}
+
+func (s *ResponseStream) abort(nerr NError) {
+	if rt := s.cli.resQ.Cancel(s.header.TxnNo); rt != nil {
+		s.cli.sendCancel(s.header, nerr.Error())
+	}
+
+	s.finish(nerr)
+}
+
+func (s *ResponseStream) finish(nerr NError) {
+	s.once.Do(func() {
+		s.err = nerr
+		close(s.done)
+
+		code := NErrorSucess
+		if nerr != nil {
+			code = nerr.Code()
+		}
+		recordSpan(SpanKindClient, s.header, s.start, code)
+	})
+}
+
+//push는 중간 frame을 넣는다. caller가 받아가지 않아 buffer가 차면 false를 돌려준다.
+func (s *ResponseStream) push(res *ResponseMsg) bool {
+	select {
+	case s.frames <- res:
+		return true
+	default:
+		return false
+	}
+}
+
+//end는 마지막 frame을 받아 stream을 끝낸다.
+func (s *ResponseStream) end(res *ResponseMsg) {
+	if res.Header.ErrCode != NErrorSucess {
+		s.finish(res.Header.GetError())
+		return
+	}
+
+	if res.Header.Stream != StreamFrameEnd && !s.push(res) {
+		s.finish(CoRaiseNError(NErrorServerBusy, 1, "stream buffer full"))
+		return
+	}
+
+	s.finish(nil)
+}
+
+//SendReqStream은 streaming request를 보낸다. frame 사이가 TxnTimeoutSec을 넘으면 timeout이 된다.
+//ctx가 cancel되거나 Close하면 provider에게 cancel이 전달된다.
+func (cli *client) SendReqStream(ctx context.Context, spn string, api string, body interface{}) (*ResponseStream, error) {
+	if app.IsStopping() {
+		return nil, CoRaiseNError(NErrorAppStopping, 1, "Application stopping")
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctxNError(ctx)
+	}
+
+	header := ReqHeader{Spn: spn, Api: api, Stream: true}
+	header.TxnNo = cli.newTxnNo()
+	header.newChildSpan(ctx)
+
+	if dl, ok := ctx.Deadline(); ok {
+		header.SetDeadline(dl)
+	} else {
+		header.SetDeadline(time.Now().Add(time.Second * TxnTimeoutSec))
+	}
+
+	out, neterr := BuildMsgPack(header, body)
+	if neterr != nil {
+		return nil, neterr
+	}
+
+	s := newResponseStream(ctx, cli, header)
+	cli.resQ.PushStream(header.TxnNo, &RequestMsg{Header: header, Body: out.Body()}, s)
+
+	cli.muxio.WriteMsgPack(out, true)
+	return s, nil
+}
+
+//SendResStream은 streaming request에 중간 frame을 보낸다.
+//caller가 cancel했으면 NErrorCanceled를 돌려주므로 handler는 보내기를 멈추면 된다.
+//caller가 StreamBufferSize개 넘게 받아가지 않으면 caller가 cancel한다.
+func (cli *client) SendResStream(req *RequestMsg, body interface{}) error {
+	if !req.Header.Stream {
+		return IssueErrorf("%s is not stream request", req.Header.Api)
+	}
+
+	if req.IsReplied() {
+		return IssueErrorf("%s stream already ended, txnNo[%d]", req.Header.Api, req.Header.TxnNo)
+	}
+
+	if req.isCanceled() {
+		return CoRaiseNError(NErrorCanceled, 1, fmt.Sprintf("%s stream canceled", req.Header.Api))
+	}
+
+	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo, TraceID: req.Header.TraceID, Stream: StreamFrameMore}
+	out, e := BuildMsgPack(header, body)
+	if e != nil {
+		return e
+	}
+
+	return cli.writeRes(req, out)
+}
+
+//EndResStream은 body 없이 stream을 끝낸다.
+func (cli *client) EndResStream(req *RequestMsg) error {
+	if err := checkDoubleReply(req); err != nil {
+		return err
+	}
+
+	if cli.reqQ.dropCanceled(req) {
+		return nil
+	}
+
+	header := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo, TraceID: req.Header.TraceID, Stream: StreamFrameEnd}
+	out, e := BuildMsgPack(header, nil)
+	if e != nil {
+		return e
+	}
+
+	cli.reqQ.untrack(req)
+	return cli.writeRes(req, out)
+}
+
+//writeRes는 응답을 gate로 보낸다. stream request의 frame은 TxnNo로 gate 연결을 고정해서
+//다른 gate를 거치며 순서가 바뀌지 않게 한다.
+func (cli *client) writeRes(req *RequestMsg, out MsgPack) error {
+	if req.Header.Stream {
+		return cli.muxio.WriteMsgPackFor(req.Header.TxnNo, out, true)
+	}
+
+	return cli.muxio.WriteMsgPack(out, true)
+}
@@ -0,0 +1,161 @@
+package net
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/Azraid/pasque/core"
+)
+
+//한 stream의 frame은 provider와 gate 모두 같은 연결로 순서대로 보낸다.
+func TestStreamFramesPinned(t *testing.T) {
+	tests := []struct {
+		name   string
+		links  int
+		txnNos []uint64
+		frames int
+		proxy  bool
+	}{
+		{name: "provider one link", links: 1, txnNos: []uint64{1, 2}, frames: 5},
+		{name: "provider three links", links: 3, txnNos: []uint64{1, 2, 3, 4, 5, 6, 7}, frames: 20},
+		{name: "gate four routers", links: 4, txnNos: []uint64{10, 11, 12, 13, 14}, frames: 20, proxy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxio, rws := newTestMuxIO(tt.links)
+			cli := newTestClient()
+			cli.muxio = muxio
+			prx := &proxy{muxio: muxio, lock: new(sync.RWMutex)}
+
+			send := func(req *RequestMsg, i int, last bool) {
+				if !tt.proxy {
+					var err error
+					if last {
+						err = cli.SendRes(req, i)
+					} else {
+						err = cli.SendResStream(req, i)
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				h := ResHeader{ToEids: req.Header.FromEids, TxnNo: req.Header.TxnNo}
+				if !last {
+					h.Stream = StreamFrameMore
+				}
+
+				mpck, err := BuildMsgPack(h, i)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := prx.SendResponse(&h, mpck); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			//여러 stream의 frame을 섞어서 보낸다.
+			reqs := make([]*RequestMsg, len(tt.txnNos))
+			for i, txnNo := range tt.txnNos {
+				reqs[i] = &RequestMsg{Header: ReqHeader{Api: "S", TxnNo: txnNo, Stream: true, FromEids: []string{"c"}}}
+			}
+
+			for i := 0; i < tt.frames; i++ {
+				for _, req := range reqs {
+					send(req, i, i == tt.frames-1)
+				}
+			}
+
+			links := make(map[uint64]int)
+			next := make(map[uint64]int)
+			for l, rw := range rws {
+				for _, b := range rw.frames {
+					mpck, err := ParseMsgPack(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					h := ParseResHeader(mpck.Header())
+					if h == nil {
+						t.Fatal("response header parse error")
+					}
+
+					if prev, ok := links[h.TxnNo]; ok && prev != l {
+						t.Fatalf("txn %d frames sent to link %d and %d", h.TxnNo, prev, l)
+					}
+					links[h.TxnNo] = l
+
+					i, err := strconv.Atoi(string(mpck.Body()))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if i != next[h.TxnNo] {
+						t.Fatalf("txn %d frame %d, want %d", h.TxnNo, i, next[h.TxnNo])
+					}
+					next[h.TxnNo]++
+				}
+			}
+
+			for _, txnNo := range tt.txnNos {
+				if next[txnNo] != tt.frames {
+					t.Errorf("txn %d got %d frames, want %d", txnNo, next[txnNo], tt.frames)
+				}
+			}
+		})
+	}
+}
+
+//caller가 받아가지 않은 frame이 StreamBufferSize를 넘으면 stream을 끝내고 cancel을 보낸다.
+func TestStreamBufferLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int
+		code   int
+		cancel bool
+	}{
+		{name: "within buffer", frames: StreamBufferSize, code: NErrorSucess},
+		{name: "over buffer", frames: StreamBufferSize + 1, code: NErrorServerBusy, cancel: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxio, rws := newTestMuxIO(1)
+			cli := newTestClient()
+			cli.muxio = muxio
+
+			header := ReqHeader{Api: "S", TxnNo: uint64(100 + i), Stream: true}
+			s := newResponseStream(context.Background(), cli, header)
+			cli.resQ.PushStream(header.TxnNo, &RequestMsg{Header: header}, s)
+
+			for n := 0; n < tt.frames; n++ {
+				mpck, err := BuildMsgPack(ResHeader{TxnNo: header.TxnNo, Stream: StreamFrameMore}, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := cli.resQ.Dispatch(mpck.Header(), mpck.Body()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			code := NErrorSucess
+			if nerr := s.Err(); nerr != nil {
+				code = nerr.Code()
+			}
+			if code != tt.code {
+				t.Fatalf("stream error code %d, want %d", code, tt.code)
+			}
+
+			types := rws[0].msgTypes(t)
+			if cancel := len(types) == 1 && types[0] == MsgTypeCancel; cancel != tt.cancel {
+				t.Fatalf("sent %q, cancel want %v", types, tt.cancel)
+			}
+		})
+	}
+}
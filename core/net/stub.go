@@ -32,8 +32,9 @@ func NewStub(eid string, dlver Deliverer) Stub {
 	stb := &stub{remoteEid: eid, dlver: dlver, appStatus: AppStatusRunning}
 
 	stb.unsentTick = time.NewTicker(time.Second * UnsentTimerSec)
-	stb.unsentQ = NewUnsentQ(nil, TxnTimeoutSec)
+	stb.unsentQ = newUnsentQ(eid, "stub_"+app.App.Eid, nil, TxnTimeoutSec)
 	stb.lock = new(sync.RWMutex)
+	RegisterQueueDepth("unsent:"+eid, unsentLimit(), stb.unsentQ.Len)
 	return stb
 }
 
@@ -86,6 +87,9 @@ func (stb *stub) ResetConn(rw NetIO) {
 
 		stb.rw = rw
 		stb.unsentQ.Register(rw)
+		if u, ok := rw.(UnsentIO); ok {
+			u.AddUnsentEvent(stb.unsentQ.Add)
+		}
 		stb.lastUsed = time.Now()
 		stb.appStatus = AppStatusRunning
 	}
@@ -95,6 +99,10 @@ func (stb *stub) ResetConn(rw NetIO) {
 func (stb *stub) Send(mpck MsgPack) error {
 	switch mpck.MsgType() {
 	case MsgTypeRequest:
+		if h := ParseReqHeader(mpck.Header()); h != nil && h.TxnNo > 0 {
+			recordCancelRoute(h.FromEids, h.TxnNo, stb)
+		}
+
 		if stb.appStatus == AppStatusDying { // server가 죽고 있다. request는 받지를 못함.
 			stb.unsentQ.Add(mpck.Bytes())
 			return nil
@@ -117,14 +125,27 @@ func (stb *stub) Send(mpck MsgPack) error {
 		}
 	}
 
-	b := mpck.Bytes()
-	if err := stb.rw.Write(b, true); err != nil {
-		stb.unsentQ.Add(b) //나중에 보내줄 것이므로... 여기서 retrun하지 말구 이후에도 계속 기다리자
+	if err := WriteMsgPack(stb.rw, mpck, true); err != nil {
+		if IsPermanentWriteError(err) {
+			return err
+		}
+		stb.unsentQ.Add(mpck.Bytes()) //나중에 보내줄 것이므로... 여기서 retrun하지 말구 이후에도 계속 기다리자
 	}
 
 	return nil
 }
 
+//unsubscribe는 연결이 끊어진 remote의 구독을 지운다. 이미 새 연결로 바뀌었으면 지우지 않는다.
+func (stb *stub) unsubscribe(rw NetIO) {
+	stb.lock.RLock()
+	replaced := stb.rw != rw
+	stb.lock.RUnlock()
+
+	if us, ok := stb.dlver.(Unsubscriber); ok && !replaced {
+		us.Unsubscribe(stb.remoteEid)
+	}
+}
+
 func (stb *stub) Go() {
 	goStubHandle(stb)
 }
@@ -139,6 +160,8 @@ func goStubHandle(stb *stub) {
 		return
 	}
 
+	defer stb.unsubscribe(stb.rw)
+
 	for {
 		msgType, header, body, err := stb.rw.Read()
 		if err != nil {
@@ -162,6 +185,16 @@ func goStubHandle(stb *stub) {
 				app.ErrorLog("send pong error, %v", err)
 			}
 
+		case MsgTypeConnect: //접속 이후 topology가 바뀐 경우
+			if connMsg := ParseConnectMsg(header, body); connMsg == nil {
+				app.ErrorLog("%s advertise parse error, %s", stb.remoteEid, string(header))
+			} else if fdr, ok := stb.dlver.(Federator); ok {
+				toplgy := &Topology{Spn: connMsg.Body.Spn, FederatedKey: connMsg.Body.FederatedKey, FederatedApis: connMsg.Body.FederatedApis, Topics: connMsg.Body.Topics, Subscribers: connMsg.Body.Subscribers}
+				if err := fdr.OnAccept(stb.remoteEid, toplgy); err != nil {
+					app.ErrorLog("%s advertise error, %v", stb.remoteEid, err)
+				}
+			}
+
 		case MsgTypeDie:
 			stb.appStatus = AppStatusDying
 			app.DebugLog("recv dying message from %s", stb.remoteEid)
@@ -190,7 +223,9 @@ func goStubHandle(stb *stub) {
 					}
 
 					if err != nil {
-						app.ErrorLog("Request remote %s", err.Error())
+						app.ErrorLog("%s Request remote %s", h.TraceTag(), err.Error())
+						AddDeadLetter(err.Error(), stb.remoteEid, mpck, Redeliver(stb.dlver))
+						ReplyNotFound(stb.dlver, true, h, err)
 					}
 				}
 			}
@@ -201,19 +236,74 @@ func goStubHandle(stb *stub) {
 				app.ErrorLog("Request parse error!, %v, %s", err, string(header))
 			} else {
 				mpck := NewMsgPack(MsgTypeResponse, header, body)
+				if h.Stream != StreamFrameMore {
+					forgetCancelRoute(h.ToEids, h.TxnNo)
+				}
 
 				if len(h.ToEids) == 1 && stb.dlver.(ServiceDeliverer).IsLocal(h.ToEids[0]) {
-					if err := stb.dlver.LocalResponse(h, mpck); err != nil {
-						app.ErrorLog("%v", err)
-					}
+					err = stb.dlver.LocalResponse(h, mpck)
 				} else {
-					if err := stb.dlver.RouteResponse(h, mpck); err != nil {
-						app.ErrorLog("%v", err)
-					}
+					err = stb.dlver.RouteResponse(h, mpck)
+				}
+
+				if err != nil {
+					app.ErrorLog("%v", err)
+					AddDeadLetter(err.Error(), stb.remoteEid, mpck, Redeliver(stb.dlver))
 				}
 			}
+
+		case MsgTypeCancel:
+			h := ParseCancelHeader(header)
+			if h == nil {
+				app.ErrorLog("Cancel parse error!, %s", string(header))
+			} else {
+				//request와 같은 경로가 되도록 FromEids를 붙인다.
+				h.FromEids = PushToEids(stb.remoteEid, h.FromEids)
+				mpck := NewMsgPack(MsgTypeCancel, header, body)
+
+				if err := mpck.ResetHeader(*h); err != nil {
+					app.ErrorLog("Cancel parse rebuild error %s", err.Error())
+				} else if err := DeliverCancel(h, mpck); err != nil {
+					app.ErrorLog("trace[%s] cancel %s", h.TraceID, err.Error())
+				}
+			}
+
 		default:
 			app.ErrorLog("can not deal with message type[%c]", msgType)
 		}
 	}
 }
+
+//ReplyNotFound는 전달할 수 없는 request에 대해 NErrorNotFound 응답을 FromEids 경로로 돌려보낸다.
+//caller가 TxnTimeoutSec 동안 기다리지 않도록 하기 위함이다.
+//local이면 request를 보낸 쪽이 직접 붙어 있는 stub이다.
+func ReplyNotFound(dlver Deliverer, local bool, h *ReqHeader, reason error) {
+	if h.TxnNo == 0 || len(h.FromEids) == 0 { //noti는 응답하지 않는다.
+		return
+	}
+
+	header, mpck, err := buildErrorResponse(h, CoRaiseNError(NErrorNotFound, 1, reason.Error()))
+	if err != nil {
+		app.ErrorLog("%s reply not found build error %s", h.TraceTag(), err.Error())
+		return
+	}
+
+	if local {
+		err = dlver.LocalResponse(header, mpck)
+	} else {
+		err = dlver.RouteResponse(header, mpck)
+	}
+
+	if err != nil {
+		app.ErrorLog("%s reply not found %s", h.TraceTag(), err.Error())
+	}
+}
+
+//buildErrorResponse는 request를 보낸 쪽으로 돌려보낼 error 응답을 만든다.
+func buildErrorResponse(h *ReqHeader, nerr NError) (*ResHeader, MsgPack, error) {
+	header := ResHeader{ToEids: h.FromEids, TxnNo: h.TxnNo, TraceID: h.TraceID}
+	header.SetError(nerr)
+
+	mpck, err := BuildMsgPack(header, nil)
+	return &header, mpck, err
+}
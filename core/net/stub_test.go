@@ -0,0 +1,75 @@
+package net
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//testDeliverer는 받은 response를 local/route별로 모아둔다.
+type testDeliverer struct {
+	local []*ResHeader
+	route []*ResHeader
+}
+
+func (d *testDeliverer) RouteRequest(header *ReqHeader, msg MsgPack) error { return nil }
+func (d *testDeliverer) LocalRequest(header *ReqHeader, msg MsgPack) error { return nil }
+
+func (d *testDeliverer) RouteResponse(header *ResHeader, msg MsgPack) error {
+	d.route = append(d.route, ParseResHeader(msg.Header()))
+	return nil
+}
+
+func (d *testDeliverer) LocalResponse(header *ResHeader, msg MsgPack) error {
+	d.local = append(d.local, ParseResHeader(msg.Header()))
+	return nil
+}
+
+//전달할 수 없는 request는 FromEids 경로로 NErrorNotFound 응답을 돌려보낸다. noti는 응답하지 않는다.
+func TestReplyNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    bool
+		txnNo    uint64
+		fromEids []string
+		replied  bool
+	}{
+		{name: "local", local: true, txnNo: 1, fromEids: []string{"c"}, replied: true},
+		{name: "routed back through hops", txnNo: 1, fromEids: []string{"c", "g1", "r1"}, replied: true},
+		{name: "noti", local: true, fromEids: []string{"c"}},
+		{name: "no from eids", local: true, txnNo: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &testDeliverer{}
+			h := &ReqHeader{Api: "A", TxnNo: tt.txnNo, FromEids: tt.fromEids, TraceID: "t1"}
+			ReplyNotFound(d, tt.local, h, errors.New("p1 not found"))
+
+			got, other := d.route, d.local
+			if tt.local {
+				got, other = d.local, d.route
+			}
+
+			want := 0
+			if tt.replied {
+				want = 1
+			}
+
+			if len(other) != 0 || len(got) != want {
+				t.Fatalf("local %d route %d, want local %v replied %v", len(d.local), len(d.route), tt.local, tt.replied)
+			}
+
+			if !tt.replied {
+				return
+			}
+
+			res := got[0]
+			if res.ErrCode != NErrorNotFound || res.TxnNo != tt.txnNo || res.TraceID != "t1" ||
+				!reflect.DeepEqual(res.ToEids, tt.fromEids) || !strings.Contains(res.ErrText, "p1 not found") {
+				t.Fatalf("response %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/********************************************************************************
+* topic.go
+* publish/subscribe topic의 구독 정보를 관리한다.
+* provider는 Topology.Topics로 gate에 구독을 알리고,
+* gate는 자신에게 붙은 provider들의 topic과 topic별 구독 provider를 모아 router에 다시 알린다.
+* router는 TopicRoutes로 구독 provider마다 gate 하나만 골라, 그 gate에게 전달할 provider를
+* ReqHeader.TopicEids로 알려준다. 여러 gate에 붙은 provider도 publish 메세지를 한번만 받는다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+type TopicTable struct {
+	lock *sync.RWMutex
+	subs map[string]map[string]string //topic -> eid -> spn
+}
+
+func NewTopicTable() *TopicTable {
+	return &TopicTable{lock: new(sync.RWMutex), subs: make(map[string]map[string]string)}
+}
+
+//Register는 eid의 구독 topic을 교체한다. 전체 topic 목록이 바뀌었으면 true를 돌려준다.
+func (tt *TopicTable) Register(spn string, eid string, topics []string) bool {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	before := len(tt.subs)
+	for topic, eids := range tt.subs {
+		delete(eids, eid)
+		if len(eids) == 0 {
+			delete(tt.subs, topic)
+		}
+	}
+
+	changed := false
+	for _, topic := range topics {
+		eids, ok := tt.subs[topic]
+		if !ok {
+			eids = make(map[string]string)
+			tt.subs[topic] = eids
+			changed = true
+		}
+		eids[eid] = spn
+	}
+
+	return changed || before != len(tt.subs)
+}
+
+//Unregister는 eid의 구독을 모두 지운다. 전체 topic 목록이 바뀌었으면 true를 돌려준다.
+func (tt *TopicTable) Unregister(eid string) bool {
+	return tt.Register("", eid, nil)
+}
+
+//FindEids는 topic을 구독하는 eid 목록을 돌려준다.
+func (tt *TopicTable) FindEids(topic string) []string {
+	tt.lock.RLock()
+	defer tt.lock.RUnlock()
+
+	var eids []string
+	for eid, _ := range tt.subs[topic] {
+		eids = append(eids, eid)
+	}
+
+	return eids
+}
+
+//FindSpns는 topic을 구독하는 spn 목록을 중복없이 돌려준다.
+func (tt *TopicTable) FindSpns(topic string) []string {
+	tt.lock.RLock()
+	defer tt.lock.RUnlock()
+
+	var spns []string
+	found := make(map[string]bool)
+	for _, spn := range tt.subs[topic] {
+		if !found[spn] {
+			found[spn] = true
+			spns = append(spns, spn)
+		}
+	}
+
+	return spns
+}
+
+func (tt *TopicTable) Topics() []string {
+	tt.lock.RLock()
+	defer tt.lock.RUnlock()
+
+	var topics []string
+	for topic, _ := range tt.subs {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+	return topics
+}
+
+//Subscribers는 topic마다 구독하는 eid 목록을 돌려준다. gate가 router에 구독 provider를 알릴때 쓴다.
+func (tt *TopicTable) Subscribers() map[string][]string {
+	tt.lock.RLock()
+	defer tt.lock.RUnlock()
+
+	subs := make(map[string][]string)
+	for topic, eids := range tt.subs {
+		for eid, _ := range eids {
+			subs[topic] = append(subs[topic], eid)
+		}
+		sort.Strings(subs[topic])
+	}
+
+	return subs
+}
+
+//IsSubscribed는 eid가 topic을 구독하는지 확인한다.
+func (tt *TopicTable) IsSubscribed(topic string, eid string) bool {
+	tt.lock.RLock()
+	defer tt.lock.RUnlock()
+
+	_, ok := tt.subs[topic][eid]
+	return ok
+}
+
+//TopicRoutes는 router가 gate마다 받은 topic별 구독 provider이다.
+//구독 provider를 알리지 않은 gate는 provider 목록이 nil이며, publish를 그대로 받아 모두에게 전달한다.
+type TopicRoutes struct {
+	lock  *sync.RWMutex
+	gates map[string]map[string][]string //gate eid -> topic -> provider eid
+}
+
+func NewTopicRoutes() *TopicRoutes {
+	return &TopicRoutes{lock: new(sync.RWMutex), gates: make(map[string]map[string][]string)}
+}
+
+//Register는 gate의 구독을 교체한다. subs가 nil이면 topics만 알린 gate이다.
+func (tr *TopicRoutes) Register(gate string, topics []string, subs map[string][]string) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if subs == nil {
+		subs = make(map[string][]string)
+		for _, topic := range topics {
+			subs[topic] = nil
+		}
+	}
+
+	if len(subs) == 0 {
+		delete(tr.gates, gate)
+		return
+	}
+
+	tr.gates[gate] = subs
+}
+
+//Unregister는 연결이 끊어진 gate의 구독을 지운다.
+func (tr *TopicRoutes) Unregister(gate string) {
+	tr.Register(gate, nil, nil)
+}
+
+//Route는 topic을 보낼 gate와 그 gate가 전달할 provider를 돌려준다.
+//provider가 여러 gate에 붙어 있으면 eid로 gate 하나를 고른다. gate 목록이 같으면 언제나 같은 gate이다.
+//provider 목록이 nil인 gate는 구독 provider를 알리지 않은 gate이다.
+func (tr *TopicRoutes) Route(topic string) map[string][]string {
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
+
+	routes := make(map[string][]string)
+	candidates := make(map[string][]string) //provider eid -> gate eid
+
+	for gate, subs := range tr.gates {
+		eids, ok := subs[topic]
+		if !ok {
+			continue
+		}
+
+		if eids == nil {
+			routes[gate] = nil
+			continue
+		}
+
+		for _, eid := range eids {
+			candidates[eid] = append(candidates[eid], gate)
+		}
+	}
+
+	for eid, gates := range candidates {
+		sort.Strings(gates)
+		gate := gates[pickIndex(eid, len(gates))]
+		routes[gate] = append(routes[gate], eid)
+	}
+
+	for _, eids := range routes {
+		sort.Strings(eids)
+	}
+
+	return routes
+}
+
+func pickIndex(eid string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(eid))
+	return int(h.Sum32() % uint32(n))
+}
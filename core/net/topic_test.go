@@ -0,0 +1,222 @@
+package net
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTopicTable(t *testing.T) {
+	type reg struct {
+		spn    string
+		eid    string
+		topics []string
+		unreg  bool
+	}
+
+	tests := []struct {
+		name    string
+		regs    []reg
+		changed []bool
+		topic   string
+		eids    []string
+		spns    []string
+		topics  []string
+	}{
+		{
+			name:    "single subscriber",
+			regs:    []reg{{"A", "a1", []string{"t1"}, false}},
+			changed: []bool{true},
+			topic:   "t1", eids: []string{"a1"}, spns: []string{"A"}, topics: []string{"t1"},
+		},
+		{
+			name:    "same spn two gates",
+			regs:    []reg{{"A", "a1", []string{"t1"}, false}, {"A", "a2", []string{"t1"}, false}},
+			changed: []bool{true, false},
+			topic:   "t1", eids: []string{"a1", "a2"}, spns: []string{"A"}, topics: []string{"t1"},
+		},
+		{
+			name:    "replace topics",
+			regs:    []reg{{"A", "a1", []string{"t1"}, false}, {"A", "a1", []string{"t2"}, false}},
+			changed: []bool{true, true},
+			topic:   "t1", eids: nil, spns: nil, topics: []string{"t2"},
+		},
+		{
+			name:    "unregister last subscriber",
+			regs:    []reg{{"A", "a1", []string{"t1"}, false}, {"", "a1", nil, true}},
+			changed: []bool{true, true},
+			topic:   "t1", eids: nil, spns: nil, topics: nil,
+		},
+		{
+			name:    "unregister one of two",
+			regs:    []reg{{"A", "a1", []string{"t1"}, false}, {"B", "b1", []string{"t1"}, false}, {"", "a1", nil, true}},
+			changed: []bool{true, false, false},
+			topic:   "t1", eids: []string{"b1"}, spns: []string{"B"}, topics: []string{"t1"},
+		},
+		{
+			name:    "unregister unknown",
+			regs:    []reg{{"", "x", nil, true}},
+			changed: []bool{false},
+			topic:   "t1", eids: nil, spns: nil, topics: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTopicTable()
+			for i, r := range tt.regs {
+				var changed bool
+				if r.unreg {
+					changed = table.Unregister(r.eid)
+				} else {
+					changed = table.Register(r.spn, r.eid, r.topics)
+				}
+
+				if changed != tt.changed[i] {
+					t.Fatalf("step %d changed = %v, want %v", i, changed, tt.changed[i])
+				}
+			}
+
+			eids := table.FindEids(tt.topic)
+			sort.Strings(eids)
+			if !reflect.DeepEqual(eids, tt.eids) {
+				t.Fatalf("FindEids() = %v, want %v", eids, tt.eids)
+			}
+
+			if spns := table.FindSpns(tt.topic); !reflect.DeepEqual(spns, tt.spns) {
+				t.Fatalf("FindSpns() = %v, want %v", spns, tt.spns)
+			}
+
+			if topics := table.Topics(); !reflect.DeepEqual(topics, tt.topics) {
+				t.Fatalf("Topics() = %v, want %v", topics, tt.topics)
+			}
+		})
+	}
+}
+
+//같은 publish 메세지가 여러 gate를 거쳐 와도 handler는 한번만 불린다.
+func TestTopicDuplicateDropped(t *testing.T) {
+	cli := newTestClient()
+
+	var calls int32
+	cli.reqQ.Subscribe("t1", func(cli Client, msg *RequestMsg) {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	publish := func(idem string) {
+		hb, _ := json.Marshal(ReqHeader{Topic: "t1", Api: "t1", IdempotencyKey: idem})
+		if err := cli.reqQ.Dispatch(hb, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish("p1")
+	publish("p1")
+	publish("p2")
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("handler calls = %d, want 2", n)
+	}
+}
+
+//router는 구독 provider마다 gate 하나만 고른다. provider를 알리지 않은 gate는 그대로 받는다.
+func TestTopicRoutes(t *testing.T) {
+	type reg struct {
+		gate   string
+		topics []string
+		subs   map[string][]string
+	}
+
+	tests := []struct {
+		name   string
+		regs   []reg
+		unreg  []string
+		topic  string
+		provs  []string //한번씩 받는 provider
+		legacy []string //provider 목록 없이 받는 gate
+	}{
+		{
+			name:  "one gate",
+			regs:  []reg{{"g1", []string{"t1"}, map[string][]string{"t1": {"p1", "p2"}}}},
+			topic: "t1", provs: []string{"p1", "p2"},
+		},
+		{
+			name: "provider on every gate",
+			regs: []reg{
+				{"g1", []string{"t1"}, map[string][]string{"t1": {"p1", "p2"}}},
+				{"g2", []string{"t1"}, map[string][]string{"t1": {"p1", "p2"}}},
+				{"g3", []string{"t1"}, map[string][]string{"t1": {"p1", "p2"}}},
+			},
+			topic: "t1", provs: []string{"p1", "p2"},
+		},
+		{
+			name: "provider on one of two gates",
+			regs: []reg{
+				{"g1", []string{"t1"}, map[string][]string{"t1": {"p1"}}},
+				{"g2", []string{"t1"}, map[string][]string{"t1": {"p1", "p2"}}},
+			},
+			topic: "t1", provs: []string{"p1", "p2"},
+		},
+		{
+			name:  "other topic",
+			regs:  []reg{{"g1", []string{"t2"}, map[string][]string{"t2": {"p1"}}}},
+			topic: "t1",
+		},
+		{
+			name:  "gate without providers",
+			regs:  []reg{{"g1", []string{"t1"}, nil}, {"g2", []string{"t1"}, map[string][]string{"t1": {"p1"}}}},
+			topic: "t1", provs: []string{"p1"}, legacy: []string{"g1"},
+		},
+		{
+			name: "unregistered gate",
+			regs: []reg{
+				{"g1", []string{"t1"}, map[string][]string{"t1": {"p1"}}},
+				{"g2", []string{"t1"}, map[string][]string{"t1": {"p1"}}},
+			},
+			unreg: []string{"g1", "g2"},
+			topic: "t1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := NewTopicRoutes()
+			for _, r := range tt.regs {
+				routes.Register(r.gate, r.topics, r.subs)
+			}
+			for _, gate := range tt.unreg {
+				routes.Unregister(gate)
+			}
+
+			var provs, legacy []string
+			for gate, eids := range routes.Route(tt.topic) {
+				if eids == nil {
+					legacy = append(legacy, gate)
+					continue
+				}
+
+				provs = append(provs, eids...)
+			}
+			sort.Strings(provs)
+			sort.Strings(legacy)
+
+			if !reflect.DeepEqual(provs, tt.provs) || !reflect.DeepEqual(legacy, tt.legacy) {
+				t.Fatalf("providers %v legacy %v, want %v %v", provs, legacy, tt.provs, tt.legacy)
+			}
+
+			//gate 목록이 같으면 같은 gate를 고른다.
+			if first, again := routes.Route(tt.topic), routes.Route(tt.topic); !reflect.DeepEqual(first, again) {
+				t.Fatalf("route changed %v, %v", first, again)
+			}
+		})
+	}
+}
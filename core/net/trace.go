@@ -0,0 +1,123 @@
+/********************************************************************************
+* trace.go
+* 서비스간 호출을 추적하기 위한 TraceID/SpanID 관리
+* span은 zipkin v2 json 포맷으로 한줄씩 trace log에 기록한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+)
+
+const (
+	SpanKindClient = "CLIENT"
+	SpanKindServer = "SERVER"
+)
+
+type TraceSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+}
+
+type traceCtxKey struct{}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+func NewTraceID() string {
+	return fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64())
+}
+
+func NewSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+//WithTraceSpan은 span을 ctx에 담는다. 이 ctx로 SendReqCtx를 하면 span을 부모로 하는 하위 span이 만들어진다.
+func WithTraceSpan(ctx context.Context, span TraceSpan) context.Context {
+	return context.WithValue(ctx, traceCtxKey{}, span)
+}
+
+func TraceSpanFromContext(ctx context.Context) (TraceSpan, bool) {
+	span, ok := ctx.Value(traceCtxKey{}).(TraceSpan)
+	return span, ok
+}
+
+//Context는 handler안에서 하위 request를 보낼때 사용한다.
+//cli.SendReqCtx(req.Context(), ...) 로 보내면 trace가 이어진다.
+//caller가 request를 cancel하거나 header의 Deadline이 지나면 Done이 되고, 하위 request에도 전달된다.
+func (req *RequestMsg) Context() context.Context {
+	return WithTraceSpan(req.baseContext(), req.Header.TraceSpan())
+}
+
+func (header ReqHeader) TraceSpan() TraceSpan {
+	return TraceSpan{TraceID: header.TraceID, SpanID: header.SpanID, ParentSpanID: header.ParentSpanID}
+}
+
+//newChildSpan은 ctx에 부모 span이 있으면 상속받고, 없으면 새 trace를 시작한다.
+func (header *ReqHeader) newChildSpan(ctx context.Context) {
+	if parent, ok := TraceSpanFromContext(ctx); ok && len(parent.TraceID) > 0 {
+		header.TraceID = parent.TraceID
+		header.ParentSpanID = parent.SpanID
+	} else {
+		header.TraceID = NewTraceID()
+		header.ParentSpanID = ""
+	}
+
+	header.SpanID = NewSpanID()
+}
+
+//TraceTag는 log에 찍을 trace 정보이다.
+func (header ReqHeader) TraceTag() string {
+	return fmt.Sprintf("trace[%s:%s]", header.TraceID, header.SpanID)
+}
+
+//recordSpan은 한 hop의 처리 시간을 trace log에 남긴다.
+func recordSpan(kind string, header ReqHeader, start time.Time, errCode int) {
+	if len(header.TraceID) == 0 || !app.IsTraceEnabled() {
+		return
+	}
+
+	zs := zipkinSpan{
+		TraceID:       header.TraceID,
+		ID:            header.SpanID,
+		ParentID:      header.ParentSpanID,
+		Name:          header.Api,
+		Kind:          kind,
+		Timestamp:     start.UnixNano() / int64(time.Microsecond),
+		Duration:      int64(time.Since(start) / time.Microsecond),
+		LocalEndpoint: zipkinEndpoint{ServiceName: app.App.Eid},
+		Tags:          map[string]string{"spn": header.Spn, "txnNo": fmt.Sprint(header.TxnNo)},
+	}
+
+	if errCode != NErrorSucess {
+		zs.Tags["error"] = CoErrorName(errCode)
+	}
+
+	if b, err := json.Marshal(zs); err == nil {
+		app.TraceLog(b)
+	}
+}
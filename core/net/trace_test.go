@@ -0,0 +1,71 @@
+package net
+
+import (
+	"context"
+	"testing"
+)
+
+//ctx에 부모 span이 있으면 TraceID를 잇고 부모 SpanID를 ParentSpanID로 가진다.
+func TestTraceChildSpan(t *testing.T) {
+	parent := TraceSpan{TraceID: "t1", SpanID: "s1"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		inherit bool
+	}{
+		{name: "no parent", ctx: context.Background()},
+		{name: "parent span", ctx: WithTraceSpan(context.Background(), parent), inherit: true},
+		{name: "empty parent", ctx: WithTraceSpan(context.Background(), TraceSpan{})},
+		{name: "request context", ctx: (&RequestMsg{Header: ReqHeader{TraceID: "t1", SpanID: "s1"}}).Context(), inherit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header ReqHeader
+			header.newChildSpan(tt.ctx)
+
+			if len(header.TraceID) == 0 || len(header.SpanID) == 0 || header.SpanID == parent.SpanID {
+				t.Fatalf("span %+v", header.TraceSpan())
+			}
+
+			if inherited := header.TraceID == parent.TraceID && header.ParentSpanID == parent.SpanID; inherited != tt.inherit {
+				t.Fatalf("span %+v, want inherit %v", header.TraceSpan(), tt.inherit)
+			}
+
+			if !tt.inherit && len(header.ParentSpanID) > 0 {
+				t.Fatalf("root span has parent %s", header.ParentSpanID)
+			}
+		})
+	}
+}
+
+//server span에는 handler가 보낸 응답의 ErrCode를 남긴다.
+func TestTraceSpanReplyCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(cli *client, msg *RequestMsg)
+		want   int
+	}{
+		{name: "no reply", handle: func(cli *client, msg *RequestMsg) {}, want: NErrorSucess},
+		{name: "reply", handle: func(cli *client, msg *RequestMsg) { cli.SendRes(msg, nil) }, want: NErrorSucess},
+		{
+			name: "reply with error",
+			handle: func(cli *client, msg *RequestMsg) {
+				cli.SendResWithError(msg, CoRaiseNError(NErrorNotFound, 1, "not found"), nil)
+			},
+			want: NErrorNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, _ := newTestMuxClient()
+			msg := &RequestMsg{Header: ReqHeader{Api: "A", TxnNo: 1, FromEids: []string{"c"}, TraceID: "t1", SpanID: "s1"}}
+
+			if code := cli.reqQ.safeInvoke(msg, func() { tt.handle(cli, msg) }); code != tt.want {
+				t.Fatalf("span errCode %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
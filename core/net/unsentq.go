@@ -11,6 +11,7 @@ import (
 	"container/list"
 	"github.com/Azraid/pasque/app"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,15 +26,39 @@ type unsentQ struct {
 	unsentLock *sync.RWMutex
 	timeoutSec uint32
 	wc         NetWriter
+	eid        string //dead letter에 남길 eid
+	maxCount   int
+	policy     string
+	cond       *sync.Cond
+	sending    int32 //SendAll이 보내고 있다.
 }
 
-func NewUnsentQ(wc NetWriter, timeoutSec uint32) UnsentQ {
-	return &unsentQ{
+func NewUnsentQ(eid string, wc NetWriter, timeoutSec uint32) UnsentQ {
+	q := &unsentQ{
+		eid:        eid,
 		timeoutSec: timeoutSec,
 		rtTick:     time.NewTicker(time.Second * 1),
 		unsentLock: new(sync.RWMutex),
 		unsentL:    list.New(),
+		policy:     OverloadDropOldest,
 		wc:         wc}
+
+	if app.Config != nil {
+		q.maxCount = app.Config.Global.UnsentQ.MaxCount
+		q.policy = overloadPolicy(app.Config.Global.UnsentQ.Policy, OverloadDropOldest)
+	}
+
+	q.cond = sync.NewCond(q.unsentLock)
+	return q
+}
+
+func unsentLimit() app.QueueLimit {
+	if app.Config == nil {
+		return app.QueueLimit{}
+	}
+
+	cfg := app.Config.Global.UnsentQ
+	return app.QueueLimit{Max: cfg.MaxCount, Policy: overloadPolicy(cfg.Policy, OverloadDropOldest)}
 }
 
 func (q *unsentQ) Register(wc NetWriter) {
@@ -44,38 +69,82 @@ func (q *unsentQ) Add(b []byte) {
 	q.unsentLock.Lock()
 	defer q.unsentLock.Unlock()
 
+	if q.maxCount > 0 && q.unsentL.Len() >= q.maxCount {
+		switch q.policy {
+		case OverloadBlock:
+			for q.unsentL.Len() >= q.maxCount {
+				q.cond.Wait()
+			}
+
+		case OverloadReject:
+			AddDeadLetterBytes("unsent full", q.eid, b, q.reinject)
+			return
+
+		default:
+			for q.unsentL.Len() >= q.maxCount {
+				u := q.unsentL.Remove(q.unsentL.Front()).(*unsent)
+				AddDeadLetterBytes("unsent overflow", q.eid, u.data, q.reinject)
+			}
+		}
+	}
+
 	q.unsentL.PushBack(&unsent{data: b, stamp: time.Now()})
 }
 
+func (q *unsentQ) reinject(mpck MsgPack) error {
+	q.Add(mpck.Bytes())
+	return nil
+}
+
+func (q *unsentQ) Len() int {
+	q.unsentLock.RLock()
+	defer q.unsentLock.RUnlock()
+
+	return q.unsentL.Len()
+}
+
+//SendAll은 ticker와 접속할때 불리므로 한번에 하나만 보낸다.
+//wc.Write는 queue가 가득 차면 기다리거나 보내지 못한 메세지를 다시 Add하므로 lock 밖에서 보낸다.
 func (q *unsentQ) SendAll() {
 	defer app.DumpRecover()
 
-	q.unsentLock.Lock()
-	defer q.unsentLock.Unlock()
-
-	if q.wc == nil {
+	if !atomic.CompareAndSwapInt32(&q.sending, 0, 1) {
 		return
 	}
+	defer atomic.StoreInt32(&q.sending, 0)
 
-	var sent []*list.Element
+	q.unsentLock.Lock()
+	wc := q.wc
+	var sends []*list.Element
 	now := time.Now()
 
-	for e := q.unsentL.Front(); e != nil; e = e.Next() {
+	for e := q.unsentL.Front(); e != nil && wc != nil; {
+		next := e.Next()
 		u := e.Value.(*unsent)
 		if uint32(now.Sub(u.stamp).Seconds()) > q.timeoutSec {
-			tmp := e
-			e = e.Next()
-			q.unsentL.Remove(tmp)
-		} else if err := q.wc.Write(u.data, true); err == nil {
-			sent = append(sent, e)
+			q.unsentL.Remove(e)
+			AddDeadLetterBytes("unsent timeout", q.eid, u.data, q.reinject)
+		} else {
+			sends = append(sends, e)
 		}
+		e = next
+	}
+	q.unsentLock.Unlock()
 
-		if e == nil {
-			break
+	var sent []*list.Element
+	for _, e := range sends {
+		if err := wc.Write(e.Value.(*unsent).data, true); err == nil {
+			sent = append(sent, e)
 		}
 	}
 
+	q.unsentLock.Lock()
+	defer q.unsentLock.Unlock()
+
+	//보내는 동안 dropoldest로 지운 element는 Remove해도 바뀌지 않는다.
 	for _, e := range sent {
 		q.unsentL.Remove(e)
 	}
+
+	q.cond.Broadcast()
 }
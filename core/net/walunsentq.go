@@ -0,0 +1,467 @@
+/********************************************************************************
+* walunsentq.go
+* 보내지 못한 메세지를 write-ahead-log 파일에 남기는 UnsentQ.
+* 프로세스가 재시작하면 파일에 남아 있는 메세지를 순서대로 다시 보낸다.
+* fsync는 메세지마다 하지 않고 SyncMs 동안 쌓인 record를 한번에 한다.
+* 다시 보낼때는 AckWriter로 connection writer가 실제로 보낸 뒤에 완료를 남긴다. 보내지 못한 메세지는
+* 원래 자리에 seq, stamp 그대로 남아 있다가 다음에 순서대로 다시 보낸다.
+* 따라서 프로세스가 아니라 장비가 죽으면 마지막 SyncMs 동안의 메세지는 잃을 수 있다.
+* gate, router의 link(muxio)와 stub에 사용한다. tcgate의 client stub은 client가
+* 재접속하면 새 session이 되므로 메모리 UnsentQ만 사용한다.
+*
+* record format
+*   'A' [seq:8][stamp:8][len:4][data]  메세지 추가
+*   'D' [seq:8]                        메세지 처리 완료(보냈거나 버림)
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+	. "github.com/Azraid/pasque/core"
+)
+
+const (
+	walRecAdd  byte = 'A'
+	walRecDone byte = 'D'
+
+	walCompactCount = 1024 //done record가 이만큼 쌓이면 파일을 다시 쓴다.
+
+	DefaultWalSyncMs = 10
+)
+
+type walUnsent struct {
+	seq      uint64
+	data     []byte
+	stamp    time.Time
+	elem     *list.Element //unsentL에서 지우면 nil이다.
+	inflight bool          //writer가 보내고 있다. 결과를 받을때까지 다시 보내지 않는다.
+}
+
+type walUnsentQ struct {
+	lock       *sync.Mutex
+	unsentL    *list.List
+	fn         string
+	f          *os.File
+	w          *bufio.Writer
+	dirty      bool          //fsync하지 않은 record가 있다.
+	syncC      chan struct{} //goWalSync를 깨운다.
+	syncDelay  time.Duration //0보다 작으면 Add할때마다 fsync한다.
+	lastSeq    uint64
+	numBytes   int
+	numDone    int
+	maxCount   int
+	maxBytes   int
+	policy     string
+	cond       *sync.Cond
+	timeoutSec uint32
+	wc         NetWriter
+	eid        string
+	sending    int32 //SendAll이 보내고 있다.
+}
+
+//NewWalUnsentQ는 fn 파일을 열어 남아 있는 메세지를 읽어들인 UnsentQ를 만든다.
+func NewWalUnsentQ(eid string, fn string, wc NetWriter, timeoutSec uint32, maxCount int, maxBytes int) (UnsentQ, error) {
+	q := &walUnsentQ{
+		lock:       new(sync.Mutex),
+		unsentL:    list.New(),
+		fn:         fn,
+		maxCount:   maxCount,
+		maxBytes:   maxBytes,
+		timeoutSec: timeoutSec,
+		wc:         wc,
+		eid:        eid,
+		policy:     OverloadDropOldest,
+		syncC:      make(chan struct{}, 1),
+		syncDelay:  DefaultWalSyncMs * time.Millisecond,
+	}
+
+	q.cond = sync.NewCond(q.lock)
+	if app.Config != nil {
+		cfg := app.Config.Global.UnsentQ
+		q.policy = overloadPolicy(cfg.Policy, OverloadDropOldest)
+		if cfg.SyncMs < 0 {
+			q.syncDelay = -1
+		} else if cfg.SyncMs > 0 {
+			q.syncDelay = time.Duration(cfg.SyncMs) * time.Millisecond
+		}
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+
+	//읽어들인 내용만으로 파일을 새로 쓴다.
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	if q.unsentL.Len() > 0 {
+		app.InfoLog("%s unsent wal replayed %d messages", fn, q.unsentL.Len())
+	}
+
+	if q.syncDelay >= 0 {
+		go goWalSync(q)
+	}
+
+	return q, nil
+}
+
+//newUnsentQ는 설정에 따라 WAL 또는 메모리 UnsentQ를 만든다.
+func newUnsentQ(eid string, name string, wc NetWriter, timeoutSec uint32) UnsentQ {
+	cfg := app.Config.Global.UnsentQ
+	if !cfg.Durable {
+		return NewUnsentQ(eid, wc, timeoutSec)
+	}
+
+	if cfg.ExpireSec > 0 {
+		timeoutSec = cfg.ExpireSec
+	}
+
+	path := cfg.Path
+	if len(path) == 0 {
+		path = app.App.LogPath
+	}
+
+	fn := fmt.Sprintf("%s/unsent_%s_%s.wal", path, eid, name)
+	q, err := NewWalUnsentQ(eid, fn, wc, timeoutSec, cfg.MaxCount, cfg.MaxBytes)
+	if err != nil {
+		app.ErrorLog("%s open error, use memory unsentq, %s", fn, err.Error())
+		return NewUnsentQ(eid, wc, timeoutSec)
+	}
+
+	return q
+}
+
+func (q *walUnsentQ) replay() error {
+	f, err := os.Open(q.fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	pending := make(map[uint64]*list.Element)
+
+	for {
+		rec, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var seq uint64
+		if err := binary.Read(r, binary.BigEndian, &seq); err != nil {
+			break //마지막 record가 덜 써진 경우는 버린다.
+		}
+
+		if seq > q.lastSeq {
+			q.lastSeq = seq
+		}
+
+		switch rec {
+		case walRecAdd:
+			var stamp int64
+			var l uint32
+			if err := binary.Read(r, binary.BigEndian, &stamp); err != nil {
+				return nil
+			}
+			if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+				return nil
+			}
+
+			data := make([]byte, l)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil
+			}
+
+			u := &walUnsent{seq: seq, data: data, stamp: time.Unix(0, stamp)}
+			u.elem = q.unsentL.PushBack(u)
+			pending[seq] = u.elem
+			q.numBytes += len(data)
+
+		case walRecDone:
+			if e, ok := pending[seq]; ok {
+				q.numBytes -= len(e.Value.(*walUnsent).data)
+				q.unsentL.Remove(e)
+				delete(pending, seq)
+			}
+
+		default:
+			return IssueErrorf("%s broken wal record[%c]", q.fn, rec)
+		}
+	}
+
+	return nil
+}
+
+//compact는 남아 있는 메세지만으로 파일을 다시 쓴다. lock을 잡은 상태에서 호출한다.
+func (q *walUnsentQ) compact() error {
+	tmp := q.fn + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for e := q.unsentL.Front(); e != nil; e = e.Next() {
+		writeWalAdd(w, e.Value.(*walUnsent))
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Sync()
+	f.Close()
+
+	if q.f != nil {
+		q.f.Close()
+	}
+
+	if err := os.Rename(tmp, q.fn); err != nil {
+		return err
+	}
+
+	if q.f, err = os.OpenFile(q.fn, os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+
+	q.w = bufio.NewWriter(q.f)
+	q.numDone = 0
+	q.dirty = false
+	return nil
+}
+
+//written은 record를 쓴 뒤에 부른다. lock을 잡은 상태에서 호출한다.
+//syncDelay가 있으면 goWalSync가 모아서 fsync한다.
+func (q *walUnsentQ) written() {
+	if q.syncDelay < 0 {
+		if err := q.w.Flush(); err != nil {
+			app.ErrorLog("%s write error %s", q.fn, err.Error())
+		}
+		q.f.Sync()
+		return
+	}
+
+	q.dirty = true
+	select {
+	case q.syncC <- struct{}{}:
+	default:
+	}
+}
+
+//flush는 쌓인 record를 파일에 쓰고 fsync할 파일을 돌려준다. lock을 잡은 상태에서 호출한다.
+func (q *walUnsentQ) flush() *os.File {
+	if !q.dirty || q.f == nil {
+		return nil
+	}
+
+	q.dirty = false
+	if err := q.w.Flush(); err != nil {
+		app.ErrorLog("%s write error %s", q.fn, err.Error())
+	}
+
+	return q.f
+}
+
+//goWalSync는 Add가 깨우면 syncDelay 동안 더 모은 뒤 한번에 fsync한다.
+//fsync하는 동안 lock을 잡지 않으므로 Add는 기다리지 않는다.
+func goWalSync(q *walUnsentQ) {
+	defer app.DumpRecover()
+
+	for range q.syncC {
+		time.Sleep(q.syncDelay)
+
+		q.lock.Lock()
+		f := q.flush()
+		q.lock.Unlock()
+
+		if f != nil {
+			f.Sync() //compact가 파일을 바꿨으면 에러가 나지만, compact가 이미 fsync했다.
+		}
+	}
+}
+
+func writeWalAdd(w io.Writer, u *walUnsent) {
+	w.Write([]byte{walRecAdd})
+	binary.Write(w, binary.BigEndian, u.seq)
+	binary.Write(w, binary.BigEndian, u.stamp.UnixNano())
+	binary.Write(w, binary.BigEndian, uint32(len(u.data)))
+	w.Write(u.data)
+}
+
+//done은 seq 메세지가 처리되었음을 남긴다. lock을 잡은 상태에서 호출한다.
+func (q *walUnsentQ) done(e *list.Element) {
+	u := q.unsentL.Remove(e).(*walUnsent)
+	u.elem = nil
+	q.numBytes -= len(u.data)
+	q.numDone++
+
+	if q.f != nil {
+		b := make([]byte, 9)
+		b[0] = walRecDone
+		binary.BigEndian.PutUint64(b[1:], u.seq)
+		q.w.Write(b)
+		q.written()
+	}
+}
+
+func (q *walUnsentQ) Register(wc NetWriter) {
+	q.wc = wc
+}
+
+func (q *walUnsentQ) Add(b []byte) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.overLimit(1, len(b)) {
+		switch q.policy {
+		case OverloadBlock:
+			for q.unsentL.Len() > 0 && q.overLimit(1, len(b)) {
+				q.cond.Wait()
+			}
+
+		case OverloadReject:
+			AddDeadLetterBytes("unsent full", q.eid, b, q.reinject)
+			return
+		}
+	}
+
+	q.lastSeq++
+	u := &walUnsent{seq: q.lastSeq, data: b, stamp: time.Now()}
+
+	if q.f != nil {
+		writeWalAdd(q.w, u)
+		q.written()
+	}
+
+	u.elem = q.unsentL.PushBack(u)
+	q.numBytes += len(b)
+
+	//크기 제한을 넘으면 오래된 것부터 버린다.
+	for q.unsentL.Len() > 1 && q.overLimit(0, 0) {
+		e := q.unsentL.Front()
+		AddDeadLetterBytes("unsent overflow", q.eid, e.Value.(*walUnsent).data, q.reinject)
+		q.done(e)
+	}
+}
+
+//overLimit은 count개, n byte를 더 넣으면 제한을 넘는지 확인한다. lock을 잡은 상태에서 호출한다.
+func (q *walUnsentQ) overLimit(count int, n int) bool {
+	return (q.maxCount > 0 && q.unsentL.Len()+count > q.maxCount) || (q.maxBytes > 0 && q.numBytes+n > q.maxBytes)
+}
+
+func (q *walUnsentQ) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.unsentL.Len()
+}
+
+func (q *walUnsentQ) reinject(mpck MsgPack) error {
+	q.Add(mpck.Bytes())
+	return nil
+}
+
+//SendAll은 남은 메세지를 순서대로 보낸다. ticker와 접속할때 불리므로 한번에 하나만 보낸다.
+//wc.Write는 queue가 가득 차면 기다리거나 보내지 못한 메세지를 다시 Add하므로 lock 밖에서 보낸다.
+//wc가 AckWriter이면 writer가 보낸 뒤에 완료를 남기고, 앞의 메세지를 보내는 중이면 다음에 보낸다.
+func (q *walUnsentQ) SendAll() {
+	defer app.DumpRecover()
+
+	if !atomic.CompareAndSwapInt32(&q.sending, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&q.sending, 0)
+
+	q.lock.Lock()
+	wc := q.wc
+	aw, ack := wc.(AckWriter)
+	var sends []*walUnsent
+	now := time.Now()
+
+	for e := q.unsentL.Front(); e != nil && wc != nil; {
+		next := e.Next()
+		u := e.Value.(*walUnsent)
+
+		if u.inflight {
+			break
+		}
+
+		if uint32(now.Sub(u.stamp).Seconds()) > q.timeoutSec {
+			AddDeadLetterBytes("unsent timeout", q.eid, u.data, q.reinject)
+			q.done(e)
+		} else {
+			u.inflight = ack
+			sends = append(sends, u)
+		}
+
+		e = next
+	}
+
+	q.cond.Broadcast()
+	q.compactIfNeeded()
+	q.lock.Unlock()
+
+	for i, u := range sends {
+		var err error
+		if ack {
+			u := u
+			err = aw.WriteAck(u.data, true, func(err error) { q.sent(u, err) })
+		} else if err = wc.Write(u.data, true); err == nil {
+			q.sent(u, nil)
+		}
+
+		if err != nil {
+			//순서를 지키기 위해 실패하면 남은 메세지는 다음에 다시 보낸다.
+			q.lock.Lock()
+			for _, v := range sends[i:] {
+				v.inflight = false
+			}
+			q.lock.Unlock()
+			break
+		}
+	}
+}
+
+//sent는 u를 보냈거나 보내지 못했을때 부른다. 보내지 못한 u는 원래 자리에 seq, stamp 그대로 남는다.
+func (q *walUnsentQ) sent(u *walUnsent, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	u.inflight = false
+	if err != nil || u.elem == nil { //보내는 동안 overflow로 버려졌다.
+		return
+	}
+
+	q.done(u.elem)
+	q.cond.Broadcast()
+	q.compactIfNeeded()
+}
+
+//compactIfNeeded는 done record가 많이 쌓였거나 모두 보냈으면 파일을 다시 쓴다. lock을 잡은 상태에서 호출한다.
+func (q *walUnsentQ) compactIfNeeded() {
+	if q.numDone >= walCompactCount || (q.unsentL.Len() == 0 && q.numDone > 0) {
+		if err := q.compact(); err != nil {
+			app.ErrorLog("%s compact error %s", q.fn, err.Error())
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package net
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azraid/pasque/app"
+)
+
+//testWriter는 limit개까지만 보내고 이후에는 실패하는 NetWriter이다. limit이 음수이면 모두 보낸다.
+type testWriter struct {
+	limit int
+	sent  [][]byte
+}
+
+func (w *testWriter) Write(b []byte, isLogging bool) error {
+	if w.limit >= 0 && len(w.sent) >= w.limit {
+		return errors.New("disconnected")
+	}
+
+	w.sent = append(w.sent, b)
+	return nil
+}
+
+func testFrame(t *testing.T, api string) []byte {
+	mpck, err := BuildMsgPack(ReqHeader{Api: api}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mpck.Bytes()
+}
+
+//syncWal은 goWalSync를 기다리지 않고 쌓인 record를 fsync한다.
+func syncWal(q *walUnsentQ) {
+	q.lock.Lock()
+	f := q.flush()
+	q.lock.Unlock()
+
+	if f != nil {
+		f.Sync()
+	}
+}
+
+func TestWalUnsentQReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		adds     []string
+		sent     int //SendAll에서 보내지는 개수, 음수이면 SendAll을 부르지 않는다.
+		maxCount int
+		truncate int //다시 열기 전에 파일 끝에서 자르는 byte
+		want     []string
+	}{
+		{"not sent", []string{"a", "b", "c"}, -1, 0, 0, []string{"a", "b", "c"}},
+		{"partially sent", []string{"a", "b", "c"}, 2, 0, 0, []string{"c"}},
+		{"all sent", []string{"a", "b"}, 2, 0, 0, nil},
+		{"overflow drops oldest", []string{"a", "b", "c"}, -1, 2, 0, []string{"b", "c"}},
+		{"torn last record", []string{"a", "b"}, -1, 0, 3, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			fn := filepath.Join(dir, "unsent.wal")
+			uq, err := NewWalUnsentQ("test", fn, nil, 60, tt.maxCount, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := uq.(*walUnsentQ)
+
+			frames := make(map[string][]byte)
+			for _, api := range tt.adds {
+				frames[api] = testFrame(t, api)
+				q.Add(frames[api])
+			}
+
+			if tt.sent >= 0 {
+				w := &testWriter{limit: tt.sent}
+				q.Register(w)
+				q.SendAll()
+				if len(w.sent) != tt.sent {
+					t.Fatalf("sent %d, want %d", len(w.sent), tt.sent)
+				}
+			}
+			syncWal(q)
+
+			if tt.truncate > 0 {
+				st, _ := os.Stat(fn)
+				if err := os.Truncate(fn, st.Size()-int64(tt.truncate)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			uq2, err := NewWalUnsentQ("test", fn, nil, 60, tt.maxCount, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uq2.Len() != len(tt.want) {
+				t.Fatalf("replayed %d, want %d", uq2.Len(), len(tt.want))
+			}
+
+			w := &testWriter{limit: -1}
+			uq2.Register(w)
+			uq2.SendAll()
+
+			var want [][]byte
+			for _, api := range tt.want {
+				want = append(want, frames[api])
+			}
+			if !reflect.DeepEqual(w.sent, want) {
+				t.Fatalf("resent %q, want %q", w.sent, want)
+			}
+
+			//모두 보냈으면 compact되어 빈 파일이 된다.
+			if st, err := os.Stat(fn); err != nil || st.Size() != 0 {
+				t.Fatalf("wal is not compacted, %v %v", st.Size(), err)
+			}
+		})
+	}
+}
+
+func TestWalUnsentQSyncBatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	app.Config.Global.UnsentQ.SyncMs = 20
+	defer func() { app.Config.Global.UnsentQ.SyncMs = 0 }()
+
+	fn := filepath.Join(dir, "unsent.wal")
+	q, err := NewWalUnsentQ("test", fn, nil, 60, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		q.Add(testFrame(t, "a"))
+	}
+
+	//Add는 fsync를 기다리지 않으므로 아직 파일에 없다.
+	if st, _ := os.Stat(fn); st.Size() != 0 {
+		t.Fatalf("wal written before sync, size %d", st.Size())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if st, _ := os.Stat(fn); st.Size() > 0 {
+			q2, err := NewWalUnsentQ("test", fn, nil, 60, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q2.Len() != 10 {
+				t.Fatalf("replayed %d, want 10", q2.Len())
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("wal is not synced")
+}
+
+//testAckWriter는 WriteAck로 받은 frame을 모아두고, 결과는 test가 onDone으로 알려준다.
+type testAckWriter struct {
+	sent   [][]byte
+	onDone []func(err error)
+}
+
+func (w *testAckWriter) Write(b []byte, isLogging bool) error {
+	return errors.New("use WriteAck")
+}
+
+func (w *testAckWriter) WriteAck(b []byte, isLogging bool, onDone func(err error)) error {
+	w.sent = append(w.sent, b)
+	w.onDone = append(w.onDone, onDone)
+	return nil
+}
+
+//writer가 보낸 뒤에만 완료를 남기고, 보내지 못한 메세지는 seq, stamp 그대로 제자리에서 다시 보낸다.
+func TestWalUnsentQAck(t *testing.T) {
+	failed := errors.New("broken pipe")
+
+	tests := []struct {
+		name   string
+		adds   []string
+		acks   []error  //처음 SendAll로 보낸 frame의 결과, 없으면 아직 보내는 중이다.
+		resend []string //다음 SendAll이 보내는 frame
+		replay []string //다시 열었을때 남아 있는 frame
+	}{
+		{name: "not flushed yet", adds: []string{"a", "b"}, replay: []string{"a", "b"}},
+		{name: "flushed", adds: []string{"a", "b"}, acks: []error{nil, nil}},
+		{name: "failed kept in place", adds: []string{"a", "b", "c"}, acks: []error{nil, failed, failed}, resend: []string{"b", "c"}, replay: []string{"b", "c"}},
+		{name: "all failed", adds: []string{"a", "b"}, acks: []error{failed, failed}, resend: []string{"a", "b"}, replay: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			fn := filepath.Join(dir, "unsent.wal")
+			uq, err := NewWalUnsentQ("test", fn, nil, 60, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := uq.(*walUnsentQ)
+
+			frames := make(map[string][]byte)
+			origs := make(map[string]walUnsent)
+			for _, api := range tt.adds {
+				frames[api] = testFrame(t, api)
+				q.Add(frames[api])
+				origs[api] = *q.unsentL.Back().Value.(*walUnsent)
+			}
+
+			w := &testAckWriter{}
+			q.Register(w)
+			q.SendAll()
+			if len(w.sent) != len(tt.adds) {
+				t.Fatalf("sent %d, want %d", len(w.sent), len(tt.adds))
+			}
+
+			for i, err := range tt.acks {
+				w.onDone[i](err)
+			}
+
+			for e := q.unsentL.Front(); e != nil; e = e.Next() {
+				u := e.Value.(*walUnsent)
+				api := ParseReqHeader(mustParse(t, u.data).Header()).Api
+				if o := origs[api]; u.seq != o.seq || !u.stamp.Equal(o.stamp) {
+					t.Fatalf("%s seq %d stamp %v, want %d %v", api, u.seq, u.stamp, o.seq, o.stamp)
+				}
+			}
+
+			w.sent = nil
+			q.SendAll()
+
+			var resend [][]byte
+			for _, api := range tt.resend {
+				resend = append(resend, frames[api])
+			}
+			if !reflect.DeepEqual(w.sent, resend) {
+				t.Fatalf("resent %q, want %q", w.sent, resend)
+			}
+			syncWal(q)
+
+			uq2, err := NewWalUnsentQ("test", fn, nil, 60, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w2 := &testWriter{limit: -1}
+			uq2.Register(w2)
+			uq2.SendAll()
+
+			var replay [][]byte
+			for _, api := range tt.replay {
+				replay = append(replay, frames[api])
+			}
+			if !reflect.DeepEqual(w2.sent, replay) {
+				t.Fatalf("replayed %q, want %q", w2.sent, replay)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, b []byte) MsgPack {
+	mpck, err := ParseMsgPack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mpck
+}
+
+//readdWriter는 보내지 못한 frame을 바로 unsentQ에 다시 넣는다. writer가 실패를 넘기는 것과 같다.
+type readdWriter struct {
+	q UnsentQ
+}
+
+func (w *readdWriter) Write(b []byte, isLogging bool) error {
+	w.q.Add(b)
+	return errors.New("disconnected")
+}
+
+//SendAll은 lock 밖에서 보내므로 보내는 중에 Add를 불러도 멈추지 않는다.
+func TestUnsentQSendAllReentrant(t *testing.T) {
+	tests := []struct {
+		name string
+		wal  bool
+	}{
+		{name: "memory"},
+		{name: "wal", wal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewUnsentQ("test", nil, 60)
+			if tt.wal {
+				dir, err := ioutil.TempDir("", "wal")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dir)
+
+				if q, err = NewWalUnsentQ("test", filepath.Join(dir, "unsent.wal"), nil, 60, 0, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			q.Add(testFrame(t, "a"))
+			q.Register(&readdWriter{q: q})
+
+			doneC := make(chan struct{})
+			go func() {
+				q.SendAll()
+				close(doneC)
+			}()
+
+			select {
+			case <-doneC:
+			case <-time.After(time.Second):
+				t.Fatal("SendAll deadlock")
+			}
+
+			if q.Len() != 2 {
+				t.Fatalf("len %d, want 2", q.Len())
+			}
+		})
+	}
+}
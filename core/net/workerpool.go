@@ -0,0 +1,135 @@
+/********************************************************************************
+* workerpool.go
+* rand/topic request를 정해진 수의 worker goroutine으로 처리한다.
+* Config.Global.Workers[spn].Apis에 지정된 api는 별도의 worker와 queue를 가져서
+* 무거운 api가 다른 api를 굶기지 않도록 한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package net
+
+import (
+	"github.com/Azraid/pasque/app"
+)
+
+type workerPool struct {
+	jobC   chan *RequestMsg
+	policy string
+}
+
+const defaultWorkerQueueSize = 1024
+
+//newWorkerPool은 workers개의 goroutine이 queue 길이의 jobC를 처리하도록 만든다.
+//queue가 없으면 jobC가 unbuffered가 되어 worker가 모두 바쁠때마다 reject되므로 기본 길이를 쓴다.
+func newWorkerPool(name string, workers int, queue int, policy string, handle func(msg *RequestMsg)) *workerPool {
+	if queue <= 0 {
+		queue = defaultWorkerQueueSize
+	}
+
+	p := &workerPool{
+		jobC:   make(chan *RequestMsg, queue),
+		policy: overloadPolicy(policy, OverloadReject),
+	}
+
+	for i := 0; i < workers; i++ {
+		go goWorker(p, handle)
+	}
+
+	RegisterQueueDepth(name, app.QueueLimit{Max: queue, Policy: p.policy}, func() int { return len(p.jobC) })
+	return p
+}
+
+//TrySubmit은 queue에 자리가 있을때만 msg를 worker에게 넘긴다.
+func (p *workerPool) TrySubmit(msg *RequestMsg) bool {
+	select {
+	case p.jobC <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+//Submit은 msg를 worker에게 넘긴다. 넘기지 못하고 버려진 request를 돌려준다.
+//block policy는 기다리지 않고 reject와 같다. 기다리는 것은 reqQ의 blockLane이 한다.
+func (p *workerPool) Submit(msg *RequestMsg) *RequestMsg {
+	if p.TrySubmit(msg) {
+		return nil
+	}
+
+	if p.policy == OverloadDropOldest {
+		var dropped *RequestMsg
+		select {
+		case dropped = <-p.jobC:
+		default:
+		}
+
+		p.jobC <- msg //Dispatch goroutine 하나만 넣으므로 자리가 있다.
+		return dropped
+	}
+
+	return msg
+}
+
+func goWorker(p *workerPool, handle func(msg *RequestMsg)) {
+	for msg := range p.jobC {
+		func() {
+			defer app.DumpRecover()
+			handle(msg)
+		}()
+	}
+}
+
+//initWorkers는 설정에 따라 client의 worker pool과 api별 pool을 만든다.
+func (q *reqQ) initWorkers() {
+	cfg, ok := app.Config.Global.Workers[app.Config.Spn]
+	if !ok {
+		return
+	}
+
+	if cfg.Pool > 0 {
+		q.pool = newWorkerPool("pool", cfg.Pool, q.randLimit.Max, q.randLimit.Policy, q.handleJob)
+	}
+
+	for api, limit := range cfg.Apis {
+		if limit.Concurrency <= 0 {
+			continue
+		}
+
+		q.apiPools[api] = newWorkerPool("pool:"+api, limit.Concurrency, limit.Queue, limit.Policy, q.handleJob)
+	}
+}
+
+//submitRand는 rand/topic request를 api pool, client pool, goroutine 순으로 넘긴다.
+func (q *reqQ) submitRand(msg *RequestMsg) {
+	p, ok := q.apiPools[msg.Header.Api]
+	if !ok || len(msg.Header.Topic) > 0 {
+		p = q.pool
+	}
+
+	if p == nil {
+		q.submitRandHandle(msg)
+		return
+	}
+
+	if p.policy == OverloadBlock {
+		try := func() bool { return p.TrySubmit(msg) }
+		if !q.lane.Do(try, func() { p.jobC <- msg }) {
+			q.replyBusy(msg, "worker queue")
+		}
+		return
+	}
+
+	if dropped := p.Submit(msg); dropped != nil {
+		q.replyBusy(dropped, "worker queue")
+	}
+}
+
+func (q *reqQ) handleJob(msg *RequestMsg) {
+	if len(msg.Header.Topic) > 0 {
+		q.handleTopic(msg)
+	} else {
+		q.handleRand(msg)
+	}
+}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testJob(txnNo uint64) *RequestMsg {
+	return &RequestMsg{Header: ReqHeader{Api: "A", TxnNo: txnNo, FromEids: []string{"c"}}}
+}
+
+//worker 없이 queue만 확인한다. 가득 찬 queue에서 버려진 request를 돌려준다.
+func TestWorkerPoolSubmit(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   int
+		policy  string
+		submits int
+		dropped []uint64 //Submit이 돌려준 request의 TxnNo
+		queued  []uint64 //jobC에 남은 request의 TxnNo
+	}{
+		{name: "default queue", submits: 3, queued: []uint64{1, 2, 3}},
+		{name: "reject when full", queue: 2, policy: OverloadReject, submits: 3, dropped: []uint64{3}, queued: []uint64{1, 2}},
+		{name: "dropoldest when full", queue: 2, policy: OverloadDropOldest, submits: 4, dropped: []uint64{1, 2}, queued: []uint64{3, 4}},
+		{name: "block rejects without lane", queue: 1, policy: OverloadBlock, submits: 2, dropped: []uint64{2}, queued: []uint64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newWorkerPool("test:"+tt.name, 0, tt.queue, tt.policy, nil)
+			if tt.queue == 0 && cap(p.jobC) != defaultWorkerQueueSize {
+				t.Fatalf("queue %d, want %d", cap(p.jobC), defaultWorkerQueueSize)
+			}
+
+			var dropped []uint64
+			for i := 1; i <= tt.submits; i++ {
+				if msg := p.Submit(testJob(uint64(i))); msg != nil {
+					dropped = append(dropped, msg.Header.TxnNo)
+				}
+			}
+
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Fatalf("dropped %v, want %v", dropped, tt.dropped)
+			}
+
+			var queued []uint64
+			for len(p.jobC) > 0 {
+				queued = append(queued, (<-p.jobC).Header.TxnNo)
+			}
+
+			if !reflect.DeepEqual(queued, tt.queued) {
+				t.Fatalf("queued %v, want %v", queued, tt.queued)
+			}
+		})
+	}
+}
+
+//api pool이 있으면 api pool로, topic이나 다른 api는 client pool로 보낸다.
+func TestSubmitRandPool(t *testing.T) {
+	tests := []struct {
+		name  string
+		api   string
+		topic string
+		toApi bool
+	}{
+		{name: "api pool", api: "A", toApi: true},
+		{name: "other api", api: "B"},
+		{name: "topic with same api", api: "A", topic: "T"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestClient().reqQ
+			q.pool = newWorkerPool("test:pool", 0, 1, OverloadReject, nil)
+			q.apiPools["A"] = newWorkerPool("test:pool:A", 0, 1, OverloadReject, nil)
+
+			q.submitRand(&RequestMsg{Header: ReqHeader{Api: tt.api, Topic: tt.topic}})
+
+			if got := len(q.apiPools["A"].jobC) == 1; got != tt.toApi || len(q.pool.jobC)+len(q.apiPools["A"].jobC) != 1 {
+				t.Fatalf("api pool %d client pool %d, want api pool %v", len(q.apiPools["A"].jobC), len(q.pool.jobC), tt.toApi)
+			}
+		})
+	}
+}
+
+//block policy의 pool이 가득 차면 blockLane이 대신 기다리고, lane도 가득 차면 ServerBusy로 응답한다.
+func TestSubmitRandBlockLane(t *testing.T) {
+	tests := []struct {
+		name    string
+		submits int
+		busy    int //ServerBusy로 응답한 수
+	}{
+		{name: "queued", submits: 1},
+		{name: "waits in lane", submits: 3},
+		{name: "lane full", submits: 4, busy: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, sentQ := newTestMuxClient()
+			q := cli.reqQ
+			q.lane = newBlockLane(1)
+			p := newWorkerPool("test:block", 0, 1, OverloadBlock, nil)
+			q.apiPools["A"] = p
+
+			//첫 request는 queue에, 두번째는 lane goroutine이 jobC에 넣으려고 기다리고, 세번째는 lane에 있다.
+			for i := 1; i <= tt.submits; i++ {
+				q.submitRand(testJob(uint64(i)))
+				if i == 2 {
+					waitFor(t, func() bool { return len(q.lane.jobC) == 0 })
+				}
+			}
+
+			if sentQ.Len() != tt.busy {
+				t.Fatalf("busy replies %d, want %d", sentQ.Len(), tt.busy)
+			}
+
+			//worker가 꺼내는대로 lane에서 기다리던 request가 순서대로 들어온다.
+			for i := 1; i <= tt.submits-tt.busy; i++ {
+				select {
+				case msg := <-p.jobC:
+					if msg.Header.TxnNo != uint64(i) {
+						t.Fatalf("job %d, want %d", msg.Header.TxnNo, i)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("job %d not queued", i)
+				}
+			}
+
+			waitFor(t, func() bool { return q.lane.Len() == 0 })
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,5 +1,7 @@
 package auth
 
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnSession -apis GetUserLocation,LoginToken,CreateSession,Logout -o proto_sess_rpc.go
+
 import (
 	. "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
@@ -35,6 +37,19 @@ func RaiseNError(args ...interface{}) n.NError {
 	return n.RaiseNError(ErrorName, args[0], 2, args[1:])
 }
 
+//session topic. 다른 서비스는 Subscribe하여 login/logout에 반응한다.
+const (
+	TopicSessionLogin  = "session.login"
+	TopicSessionLogout = "session.logout"
+)
+
+type SessionEvent struct {
+	UserID  TUserID
+	GateSpn string
+	GateEid string
+	Eid     string
+}
+
 type GetUserLocationMsg struct {
 	UserID TUserID
 	Spn    string
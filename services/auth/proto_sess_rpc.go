@@ -0,0 +1,146 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package auth
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// GetUserLocation sends GetUserLocation to co.SpnSession.
+func GetUserLocation(ctx context.Context, cli n.Client, req GetUserLocationMsg) (*GetUserLocationMsgR, n.NError) {
+	var res GetUserLocationMsgR
+	if nerr := n.Call(ctx, cli, co.SpnSession, "GetUserLocation", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterGetUserLocationGrid registers a grid handler for GetUserLocation with a decoded body.
+func RegisterGetUserLocationGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetUserLocationMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("GetUserLocation", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body GetUserLocationMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterGetUserLocationRand registers a rand handler for GetUserLocation with a decoded body.
+func RegisterGetUserLocationRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetUserLocationMsg)) {
+	cli.RegisterRandHandler("GetUserLocation", func(cli n.Client, req *n.RequestMsg) {
+		var body GetUserLocationMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// LoginToken sends LoginToken to co.SpnSession.
+func LoginToken(ctx context.Context, cli n.Client, req LoginTokenMsg) (*LoginTokenMsgR, n.NError) {
+	var res LoginTokenMsgR
+	if nerr := n.Call(ctx, cli, co.SpnSession, "LoginToken", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterLoginTokenGrid registers a grid handler for LoginToken with a decoded body.
+func RegisterLoginTokenGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LoginTokenMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("LoginToken", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body LoginTokenMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterLoginTokenRand registers a rand handler for LoginToken with a decoded body.
+func RegisterLoginTokenRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LoginTokenMsg)) {
+	cli.RegisterRandHandler("LoginToken", func(cli n.Client, req *n.RequestMsg) {
+		var body LoginTokenMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// CreateSession sends CreateSession to co.SpnSession.
+func CreateSession(ctx context.Context, cli n.Client, req CreateSessionMsg) (*CreateSessionMsgR, n.NError) {
+	var res CreateSessionMsgR
+	if nerr := n.Call(ctx, cli, co.SpnSession, "CreateSession", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterCreateSessionGrid registers a grid handler for CreateSession with a decoded body.
+func RegisterCreateSessionGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CreateSessionMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("CreateSession", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body CreateSessionMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterCreateSessionRand registers a rand handler for CreateSession with a decoded body.
+func RegisterCreateSessionRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CreateSessionMsg)) {
+	cli.RegisterRandHandler("CreateSession", func(cli n.Client, req *n.RequestMsg) {
+		var body CreateSessionMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// Logout sends Logout to co.SpnSession.
+func Logout(ctx context.Context, cli n.Client, req LogoutMsg) (*LogoutMsgR, n.NError) {
+	var res LogoutMsgR
+	if nerr := n.Call(ctx, cli, co.SpnSession, "Logout", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterLogoutGrid registers a grid handler for Logout with a decoded body.
+func RegisterLogoutGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LogoutMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("Logout", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body LogoutMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterLogoutRand registers a rand handler for Logout with a decoded body.
+func RegisterLogoutRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LogoutMsg)) {
+	cli.RegisterRandHandler("Logout", func(cli n.Client, req *n.RequestMsg) {
+		var body LogoutMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
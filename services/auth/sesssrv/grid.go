@@ -28,26 +28,19 @@ type GridData struct {
 	Lasted time.Time
 }
 
-func GetGridData(gridData interface{}) *GridData {
-	if gridData == nil {
-		return nil
-	}
-
-	g := gridData.(*GridData)
-	g.Lasted = time.Now()
-
+// key is UserID
+func newGridData(userID string) *GridData {
+	g := &GridData{UserID: co.TUserID(userID), Lasted: time.Now()}
+	g.Loc = make(map[string]Location)
 	return g
 }
 
-// key is UserID
-func CreateGridData(userID string, gridData interface{}) *GridData {
-	if gridData == nil {
-		g := &GridData{UserID: co.TUserID(userID), Lasted: time.Now()}
-		g.Loc = make(map[string]Location)
-		return g
-	}
+func (g *GridData) Touch() {
+	g.Lasted = time.Now()
+}
 
-	return GetGridData(gridData)
+func (g GridData) HasSession() bool {
+	return len(g.Loc) > 0
 }
 
 func (g *GridData) DeleteSession(gateSpn string) {
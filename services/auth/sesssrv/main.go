@@ -28,10 +28,11 @@ func main() {
 	loadUserAuthDB(app.App.ConfigPath + "/userauthdb.json")
 
 	cli := n.NewClient(eid)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(LogoutMsg{}), OnLogout)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(CreateSessionMsg{}), OnCreateSession)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(GetUserLocationMsg{}), OnGetUserLocation)
-	cli.RegisterRandHandler(n.GetNameOfApiMsg(LoginTokenMsg{}), OnLoginToken)
+	n.RegisterGridConstructor(cli, newGridData)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(LogoutMsg{}), OnLogout)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(CreateSessionMsg{}), OnCreateSession)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(GetUserLocationMsg{}), OnGetUserLocation)
+	RegisterLoginTokenRand(cli, OnLoginToken)
 
 	toplgy := n.Topology{
 		Spn:           app.Config.Spn,
@@ -4,79 +4,51 @@ import (
 	"encoding/json"
 
 	"github.com/Azraid/pasque/app"
-	. "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
 	. "github.com/Azraid/pasque/services/auth"
-	juli "github.com/Azraid/pasque/services/juli"
 )
 
-func OnGetUserLocation(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body GetUserLocationMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorSessionNotExists), nil)
-		return gridData
+func OnGetUserLocation(cli n.Client, req *n.RequestMsg, g *GridData, body *GetUserLocationMsg) (*GridData, interface{}, n.NError) {
+	if g == nil {
+		return nil, nil, RaiseNError(NErrorSessionNotExists)
 	}
 
-	g := GetGridData(gridData)
+	g.Touch()
 
 	if v, ok := g.Loc[body.Spn]; ok {
-		cli.SendRes(req, GetUserLocationMsgR{GateEid: v.GateEid, Eid: v.Eid})
-		return g
+		return g, GetUserLocationMsgR{GateEid: v.GateEid, Eid: v.Eid}, nil
 	}
 
-	cli.SendResWithError(req, RaiseNError(NErrorSessionNotExists), nil)
-	return g
+	return g, nil, RaiseNError(NErrorSessionNotExists)
 }
 
 //OnCreateSession Session을 생성한다.
-func OnCreateSession(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body CreateSessionMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
+func OnCreateSession(cli n.Client, req *n.RequestMsg, g *GridData, body *CreateSessionMsg) (*GridData, interface{}, n.NError) {
+	g.Touch()
 
-	var g *GridData
-	res := CreateSessionMsgR{}
-	if gridData != nil {
-		g = GetGridData(gridData)
+	if g.HasSession() {
 		if !g.Validate(body.GateSpn, body.GateEid, body.GateEid) {
 			//TODO Kick()....
-			cli.SendReq(SpnJuliUser, "LeaveRoom", juli.LeaveRoomMsg{UserID: g.UserID})
+			if old, ok := g.Loc[body.GateSpn]; ok {
+				cli.Publish(TopicSessionLogout, SessionEvent{UserID: g.UserID, GateSpn: body.GateSpn, GateEid: old.GateEid, Eid: old.Eid})
+			}
 			app.DebugLog("shoud be kick. different from %s, %v", g, req.Header)
 			//우선 update
 			g.ResetSession(body.GateSpn, body.GateEid, body.Eid)
+			cli.Publish(TopicSessionLogin, SessionEvent{UserID: g.UserID, GateSpn: body.GateSpn, GateEid: body.GateEid, Eid: body.Eid})
 		}
-
-		res.SessionID = g.Loc[body.GateSpn].SessionID
 		//cli.SendResWithError(req, RaiseNError(NErrorSessionAlreadyExists, "Session Exists"), res)
 	} else {
-		g = CreateGridData(req.Header.Key, gridData)
 		g.ResetSession(body.GateSpn, body.GateEid, body.Eid)
+		cli.Publish(TopicSessionLogin, SessionEvent{UserID: g.UserID, GateSpn: body.GateSpn, GateEid: body.GateEid, Eid: body.Eid})
 	}
 
-	res.SessionID = g.Loc[body.GateSpn].SessionID
-	cli.SendRes(req, res)
-	return g
+	return g, CreateSessionMsgR{SessionID: g.Loc[body.GateSpn].SessionID}, nil
 }
 
 //doLoginToken Session을 생성한다.
 //나중에 deleteSession을 만들자.
-func OnLoginToken(cli n.Client, req *n.RequestMsg) {
-	var body LoginTokenMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return
-	}
-
+func OnLoginToken(cli n.Client, req *n.RequestMsg, body *LoginTokenMsg) {
 	userID, ok := getUserID(body.Token)
 	if !ok {
 		cli.SendResWithError(req, RaiseNError(NErrorAuthTokenError, "Not found UserID"), nil)
@@ -92,7 +64,7 @@ func OnLoginToken(cli n.Client, req *n.RequestMsg) {
 	cliEid := req.Header.FromEids[lstIdx-1]
 	gateEid := req.Header.FromEids[lstIdx]
 
-	r, err := cli.LoopbackReq("CreateSession", CreateSessionMsg{
+	r, err := cli.LoopbackReqCtx(req.Context(), "CreateSession", CreateSessionMsg{
 		UserID:  userID,
 		GateSpn: req.Header.FromSpn,
 		GateEid: gateEid,
@@ -114,21 +86,15 @@ func OnLoginToken(cli n.Client, req *n.RequestMsg) {
 	cli.SendRes(req, LoginTokenMsgR{UserID: userID, SessionID: rmsgR.SessionID})
 }
 
-func OnLogout(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body LogoutMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+func OnLogout(cli n.Client, req *n.RequestMsg, g *GridData, body *LogoutMsg) (*GridData, interface{}, n.NError) {
+	if g == nil {
+		return nil, LogoutMsgR{}, nil
 	}
 
-	if g := GetGridData(gridData); g != nil {
-		//TODO: pub/sub으로 구현해야 함.
-		cli.SendReq(SpnJuliUser, "LeaveRoom", juli.LeaveRoomMsg{UserID: g.UserID})
+	if v, ok := g.Loc[body.GateSpn]; ok {
+		cli.Publish(TopicSessionLogout, SessionEvent{UserID: g.UserID, GateSpn: body.GateSpn, GateEid: v.GateEid, Eid: v.Eid})
 		g.DeleteSession(body.GateSpn)
 	}
 
-	res := LogoutMsgR{}
-	cli.SendRes(req, res)
-	return nil //grid Cache might be removed
+	return nil, LogoutMsgR{}, nil //grid Cache might be removed
 }
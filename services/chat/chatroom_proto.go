@@ -1,5 +1,7 @@
 package chat
 
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnChatRoom -prefix Room -apis GetRoom,JoinRoom,SendChat -o chatroom_rpc.go
+
 import (
 	. "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
@@ -0,0 +1,112 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package chat
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// RoomGetRoom sends GetRoom to co.SpnChatRoom.
+func RoomGetRoom(ctx context.Context, cli n.Client, req GetRoomMsg) (*GetRoomMsgR, n.NError) {
+	var res GetRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatRoom, "GetRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterRoomGetRoomGrid registers a grid handler for GetRoom with a decoded body.
+func RegisterRoomGetRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("GetRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body GetRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterRoomGetRoomRand registers a rand handler for GetRoom with a decoded body.
+func RegisterRoomGetRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetRoomMsg)) {
+	cli.RegisterRandHandler("GetRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body GetRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// RoomJoinRoom sends JoinRoom to co.SpnChatRoom.
+func RoomJoinRoom(ctx context.Context, cli n.Client, req JoinRoomMsg) (*JoinRoomMsgR, n.NError) {
+	var res JoinRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatRoom, "JoinRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterRoomJoinRoomGrid registers a grid handler for JoinRoom with a decoded body.
+func RegisterRoomJoinRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterRoomJoinRoomRand registers a rand handler for JoinRoom with a decoded body.
+func RegisterRoomJoinRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg)) {
+	cli.RegisterRandHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// RoomSendChat sends SendChat to co.SpnChatRoom.
+func RoomSendChat(ctx context.Context, cli n.Client, req SendChatMsg) (*SendChatMsgR, n.NError) {
+	var res SendChatMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatRoom, "SendChat", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterRoomSendChatGrid registers a grid handler for SendChat with a decoded body.
+func RegisterRoomSendChatGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *SendChatMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("SendChat", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body SendChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterRoomSendChatRand registers a rand handler for SendChat with a decoded body.
+func RegisterRoomSendChatRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *SendChatMsg)) {
+	cli.RegisterRandHandler("SendChat", func(cli n.Client, req *n.RequestMsg) {
+		var body SendChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
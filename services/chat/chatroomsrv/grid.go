@@ -14,10 +14,6 @@ type GridData struct {
 	Members map[co.TUserID]RoomMember //key = UserID
 }
 
-func getGridData(key string, gridData interface{}) *GridData {
-	if gridData == nil {
-		return &GridData{Members: make(map[co.TUserID]RoomMember)}
-	}
-
-	return gridData.(*GridData)
+func newGridData(key string) *GridData {
+	return &GridData{Members: make(map[co.TUserID]RoomMember)}
 }
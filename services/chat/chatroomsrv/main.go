@@ -26,9 +26,10 @@ func main() {
 	app.InitApp(eid, "", workPath)
 
 	cli := n.NewClient(eid)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(GetRoomMsg{}), OnGetRoom)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(SendChatMsg{}), OnSendChat)
+	n.RegisterGridConstructor(cli, newGridData)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(GetRoomMsg{}), OnGetRoom)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(SendChatMsg{}), OnSendChat)
 
 	toplgy := n.Topology{
 		Spn:           app.Config.Spn,
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/Azraid/pasque/app"
@@ -10,39 +9,21 @@ import (
 	. "github.com/Azraid/pasque/services/chat"
 )
 
-func OnJoinRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body JoinRoomMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	gd := getGridData(req.Header.Key, gridData)
-
+func OnJoinRoom(cli n.Client, req *n.RequestMsg, gd *GridData, body *JoinRoomMsg) (*GridData, interface{}, n.NError) {
 	if _, ok := gd.Members[body.UserID]; !ok {
 		gd.Members[body.UserID] = RoomMember{Joined: time.Now()}
 	}
 
-	cli.SendRes(req, JoinRoomMsgR{})
-
-	return gd
+	return gd, JoinRoomMsgR{}, nil
 }
 
 //GetRoom 채팅방의 정보에 대한 요청
-func OnGetRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-
-	var body GetRoomMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+func OnGetRoom(cli n.Client, req *n.RequestMsg, gd *GridData, body *GetRoomMsg) (*GridData, interface{}, n.NError) {
+	res := GetRoomMsgR{}
+	if gd == nil {
+		return nil, res, nil
 	}
 
-	gd := getGridData(req.Header.Key, gridData)
-
-	res := GetRoomMsgR{}
 	res.UserIDs = make([]TUserID, len(gd.Members))
 
 	i := 0
@@ -51,30 +32,19 @@ func OnGetRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{
 		i++
 	}
 
-	if err := cli.SendRes(req, res); err != nil {
-		app.ErrorLog(err.Error())
-	}
-
-	return gd
+	return gd, res, nil
 }
 
 //SendChat 채팅 메세지 요청
-func OnSendChat(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-
-	var body SendChatMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
+func OnSendChat(cli n.Client, req *n.RequestMsg, gd *GridData, body *SendChatMsg) (*GridData, interface{}, n.NError) {
+	if err := cli.SendRes(req, SendChatMsgR{}); err != nil {
 		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
 	}
 
-	rbody := SendChatMsgR{}
-	if err := cli.SendRes(req, rbody); err != nil {
-		app.ErrorLog(err.Error())
+	if gd == nil {
+		return nil, nil, nil
 	}
 
-	gd := getGridData(req.Header.Key, gridData)
-
 	for k, _ := range gd.Members {
 		chatuserReq := RecvChatMsg{
 			UserID:     k,
@@ -87,5 +57,5 @@ func OnSendChat(cli n.Client, req *n.RequestMsg, gridData interface{}) interface
 		cli.SendNoti(SpnChatUser, "RecvChat", chatuserReq)
 	}
 
-	return gd
+	return gd, nil, nil
 }
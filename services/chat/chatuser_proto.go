@@ -1,5 +1,7 @@
 package chat
 
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnChatUser -prefix User -apis CreateRoom,JoinRoom,ListMyRooms,SendChat,RecvChat -o chatuser_rpc.go
+
 import (
 	"time"
 
@@ -0,0 +1,180 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package chat
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// UserCreateRoom sends CreateRoom to co.SpnChatUser.
+func UserCreateRoom(ctx context.Context, cli n.Client, req CreateRoomMsg) (*CreateRoomMsgR, n.NError) {
+	var res CreateRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatUser, "CreateRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserCreateRoomGrid registers a grid handler for CreateRoom with a decoded body.
+func RegisterUserCreateRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CreateRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("CreateRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body CreateRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserCreateRoomRand registers a rand handler for CreateRoom with a decoded body.
+func RegisterUserCreateRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CreateRoomMsg)) {
+	cli.RegisterRandHandler("CreateRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body CreateRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserJoinRoom sends JoinRoom to co.SpnChatUser.
+func UserJoinRoom(ctx context.Context, cli n.Client, req JoinRoomMsg) (*JoinRoomMsgR, n.NError) {
+	var res JoinRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatUser, "JoinRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserJoinRoomGrid registers a grid handler for JoinRoom with a decoded body.
+func RegisterUserJoinRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserJoinRoomRand registers a rand handler for JoinRoom with a decoded body.
+func RegisterUserJoinRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg)) {
+	cli.RegisterRandHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserListMyRooms sends ListMyRooms to co.SpnChatUser.
+func UserListMyRooms(ctx context.Context, cli n.Client, req ListMyRoomsMsg) (*ListMyRoomsMsgR, n.NError) {
+	var res ListMyRoomsMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatUser, "ListMyRooms", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserListMyRoomsGrid registers a grid handler for ListMyRooms with a decoded body.
+func RegisterUserListMyRoomsGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *ListMyRoomsMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("ListMyRooms", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body ListMyRoomsMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserListMyRoomsRand registers a rand handler for ListMyRooms with a decoded body.
+func RegisterUserListMyRoomsRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *ListMyRoomsMsg)) {
+	cli.RegisterRandHandler("ListMyRooms", func(cli n.Client, req *n.RequestMsg) {
+		var body ListMyRoomsMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserSendChat sends SendChat to co.SpnChatUser.
+func UserSendChat(ctx context.Context, cli n.Client, req SendChatMsg) (*SendChatMsgR, n.NError) {
+	var res SendChatMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatUser, "SendChat", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserSendChatGrid registers a grid handler for SendChat with a decoded body.
+func RegisterUserSendChatGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *SendChatMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("SendChat", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body SendChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserSendChatRand registers a rand handler for SendChat with a decoded body.
+func RegisterUserSendChatRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *SendChatMsg)) {
+	cli.RegisterRandHandler("SendChat", func(cli n.Client, req *n.RequestMsg) {
+		var body SendChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserRecvChat sends RecvChat to co.SpnChatUser.
+func UserRecvChat(ctx context.Context, cli n.Client, req RecvChatMsg) (*RecvChatMsgR, n.NError) {
+	var res RecvChatMsgR
+	if nerr := n.Call(ctx, cli, co.SpnChatUser, "RecvChat", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserRecvChatGrid registers a grid handler for RecvChat with a decoded body.
+func RegisterUserRecvChatGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *RecvChatMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("RecvChat", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body RecvChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserRecvChatRand registers a rand handler for RecvChat with a decoded body.
+func RegisterUserRecvChatRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *RecvChatMsg)) {
+	cli.RegisterRandHandler("RecvChat", func(cli n.Client, req *n.RequestMsg) {
+		var body RecvChatMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
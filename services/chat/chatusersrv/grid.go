@@ -2,8 +2,6 @@ package main
 
 import (
 	"time"
-
-	co "github.com/Azraid/pasque/core"
 )
 
 type ChatRoom struct {
@@ -14,11 +12,7 @@ type GridData struct {
 	Rooms map[string]ChatRoom //key = RoomID
 }
 
-func getGridData(key co.TUserID, gridData interface{}) *GridData {
-	if gridData == nil {
-		return &GridData{Rooms: make(map[string]ChatRoom)}
-	}
-
-	return gridData.(*GridData)
+func newGridData(key string) *GridData {
+	return &GridData{Rooms: make(map[string]ChatRoom)}
 }
 
@@ -5,7 +5,9 @@ import (
 	"os"
 
 	"github.com/Azraid/pasque/app"
+	co "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
+	"github.com/Azraid/pasque/services/auth"
 	. "github.com/Azraid/pasque/services/chat"
 )
 
@@ -28,11 +30,14 @@ func main() {
 	app.InitApp(eid, "", workPath)
 
 	cli := n.NewClient(eid)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(CreateRoomMsg{}), OnCreateRoom)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(ListMyRoomsMsg{}), OnListMyRooms)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(SendChatMsg{}), OnSendChat)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(RecvChatMsg{}), OnRecvChat)
+	n.RegisterGridConstructor(cli, newGridData)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(CreateRoomMsg{}), OnCreateRoom)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(ListMyRoomsMsg{}), OnListMyRooms)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(SendChatMsg{}), OnSendChat)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(RecvChatMsg{}), OnRecvChat)
+	cli.SetRetryPolicy(co.SpnSession, n.GetNameOfApiMsg(auth.GetUserLocationMsg{}), n.DefaultRetryPolicy)
+	cli.SetRetryPolicy(co.SpnChatRoom, n.GetNameOfApiMsg(JoinRoomMsg{}), n.DefaultRetryPolicy)
 
 	toplgy := n.Topology{
 		Spn:           app.Config.Spn,
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -12,68 +11,32 @@ import (
 	. "github.com/Azraid/pasque/services/chat"
 )
 
-func OnCreateRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body CreateRoomMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
+func OnCreateRoom(cli n.Client, req *n.RequestMsg, gd *GridData, body *CreateRoomMsg) (*GridData, interface{}, n.NError) {
 	roomID := GenerateGuid().String()
-	if r, err := cli.SendReq(SpnChatRoom, "JoinRoom", JoinRoomMsg{RoomID: roomID, UserID: body.UserID}); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gridData
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, r.Header.GetError(), nil)
-		return gridData
+	if _, nerr := RoomJoinRoom(req.Context(), cli, JoinRoomMsg{RoomID: roomID, UserID: body.UserID}); !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	gd := getGridData(ToUserID(req.Header.Key), gridData)
 	gd.Rooms[roomID] = ChatRoom{Lasted: time.Now()}
-
-	cli.SendRes(req, CreateRoomMsgR{RoomID: roomID})
-	return gd
+	return gd, CreateRoomMsgR{RoomID: roomID}, nil
 }
 
-func OnJoinRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body JoinRoomMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if r, err := cli.SendReq(SpnChatRoom, "JoinRoom", JoinRoomMsg{RoomID: body.RoomID, UserID: body.UserID}); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gridData
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, r.Header.GetError(), nil)
-		return gridData
+func OnJoinRoom(cli n.Client, req *n.RequestMsg, gd *GridData, body *JoinRoomMsg) (*GridData, interface{}, n.NError) {
+	if _, nerr := RoomJoinRoom(req.Context(), cli, JoinRoomMsg{RoomID: body.RoomID, UserID: body.UserID}); !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	gd := getGridData(ToUserID(req.Header.Key), gridData)
 	gd.Rooms[body.RoomID] = ChatRoom{Lasted: time.Now()}
-
-	cli.SendRes(req, JoinRoomMsgR{})
-	return gd
+	return gd, JoinRoomMsgR{}, nil
 }
 
 //ListRooms 사용자가 채팅중인 방 리스트를 보여준다.
-func OnListMyRooms(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-
-	var body ListMyRoomsMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+func OnListMyRooms(cli n.Client, req *n.RequestMsg, gd *GridData, body *ListMyRoomsMsg) (*GridData, interface{}, n.NError) {
+	res := ListMyRoomsMsgR{}
+	if gd == nil {
+		return nil, res, nil
 	}
 
-	gd := getGridData(ToUserID(req.Header.Key), gridData)
-
-	res := ListMyRoomsMsgR{}
 	res.Rooms = make([]struct {
 		RoomID string
 		Lasted time.Time
@@ -85,84 +48,51 @@ func OnListMyRooms(cli n.Client, req *n.RequestMsg, gridData interface{}) interf
 		i++
 	}
 
-	if err := cli.SendRes(req, res); err != nil {
-		app.ErrorLog(err.Error())
-	}
-
-	return gd
+	return gd, res, nil
 }
 
 //SendChatMsg 채팅 메세지를 전송한다.
-func OnSendChat(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+func OnSendChat(cli n.Client, req *n.RequestMsg, gd *GridData, body *SendChatMsg) (*GridData, interface{}, n.NError) {
+	userID := ToUserID(req.Header.Key)
 
-	var body SendChatMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+	if gd == nil {
+		app.ErrorLog("RoomID[%s] not found", body.RoomID)
+		return nil, nil, RaiseNError(NErrorChatNotFoundRoomID)
 	}
 
-	userID := ToUserID(req.Header.Key)
-	gd := getGridData(userID, gridData)
-
 	if v, ok := gd.Rooms[body.RoomID]; !ok {
 		app.ErrorLog("RoomID[%s] not found", body.RoomID)
-		cli.SendResWithError(req, RaiseNError(NErrorChatNotFoundRoomID), nil)
-		return gd
+		return gd, nil, RaiseNError(NErrorChatNotFoundRoomID)
 	} else {
 		v.Lasted = time.Now()
 	}
 
 	chatroomReq := SendChatMsg{UserID: userID, RoomID: body.RoomID, ChatType: 1, Msg: body.Msg}
-
-	res, err := cli.SendReq(SpnChatRoom, "SendChat", chatroomReq)
-	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gd
-	}
-
-	if res.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, res.Header.GetError(), nil)
-		return gd
+	if _, nerr := RoomSendChat(req.Context(), cli, chatroomReq); !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	if err := cli.SendRes(req, SendChatMsgR{}); err != nil {
-		app.ErrorLog(err.Error())
-	}
-	return gd
+	return gd, SendChatMsgR{}, nil
 }
 
 //RecvChatMsg 채팅 메세지를 수신한다.
-func OnRecvChat(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body RecvChatMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
+func OnRecvChat(cli n.Client, req *n.RequestMsg, gd *GridData, body *RecvChatMsg) (*GridData, interface{}, n.NError) {
 	userID := ToUserID(req.Header.Key)
-	gd := getGridData(userID, gridData)
-	if v, ok := gd.Rooms[body.RoomID]; ok {
-		v.Lasted = time.Now()
+	if gd != nil {
+		if v, ok := gd.Rooms[body.RoomID]; ok {
+			v.Lasted = time.Now()
+		}
 	}
 
-	res, err := cli.SendReq(SpnSession, "GetUserLocation", auth.GetUserLocationMsg{UserID: userID,
-		Spn: GameSpn})
-	if err != nil {
+	rbody, nerr := auth.GetUserLocation(req.Context(), cli, auth.GetUserLocationMsg{UserID: userID, Spn: GameSpn})
+	if !nerr.IsSuccess() {
 		app.DebugLog("no user session at OnRecvChat")
-		return gd
-	}
-
-	var rbody auth.GetUserLocationMsgR
-	if err := json.Unmarshal(res.Body, &rbody); err != nil {
-		app.ErrorLog(err.Error())
-		return gd
+		return gd, nil, nil
 	}
 
-	cli.SendReqDirect(GameSpn, rbody.GateEid, rbody.Eid, "RecvChat", body)
+	cli.SendReqDirectCtx(req.Context(), GameSpn, rbody.GateEid, rbody.Eid, "RecvChat", body)
 
 	fmt.Printf("%s:%s-%s\r\n", body.ChatUserID, body.Msg, time.Now().Format(time.RFC3339))
 
-	return gd
+	return gd, nil, nil
 }
@@ -0,0 +1,282 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package juli
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// UserJoinIn sends JoinIn to co.SpnJuliUser.
+func UserJoinIn(ctx context.Context, cli n.Client, req JoinInMsg) (*JoinInMsgR, n.NError) {
+	var res JoinInMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "JoinIn", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserJoinInGrid registers a grid handler for JoinIn with a decoded body.
+func RegisterUserJoinInGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinInMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("JoinIn", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body JoinInMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserJoinInRand registers a rand handler for JoinIn with a decoded body.
+func RegisterUserJoinInRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinInMsg)) {
+	cli.RegisterRandHandler("JoinIn", func(cli n.Client, req *n.RequestMsg) {
+		var body JoinInMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserLeaveRoom sends LeaveRoom to co.SpnJuliUser.
+func UserLeaveRoom(ctx context.Context, cli n.Client, req LeaveRoomMsg) (*LeaveRoomMsgR, n.NError) {
+	var res LeaveRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "LeaveRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserLeaveRoomGrid registers a grid handler for LeaveRoom with a decoded body.
+func RegisterUserLeaveRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("LeaveRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body LeaveRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserLeaveRoomRand registers a rand handler for LeaveRoom with a decoded body.
+func RegisterUserLeaveRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveRoomMsg)) {
+	cli.RegisterRandHandler("LeaveRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body LeaveRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserPlayReady sends PlayReady to co.SpnJuliUser.
+func UserPlayReady(ctx context.Context, cli n.Client, req PlayReadyMsg) (*PlayReadyMsgR, n.NError) {
+	var res PlayReadyMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "PlayReady", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserPlayReadyGrid registers a grid handler for PlayReady with a decoded body.
+func RegisterUserPlayReadyGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *PlayReadyMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("PlayReady", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body PlayReadyMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserPlayReadyRand registers a rand handler for PlayReady with a decoded body.
+func RegisterUserPlayReadyRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *PlayReadyMsg)) {
+	cli.RegisterRandHandler("PlayReady", func(cli n.Client, req *n.RequestMsg) {
+		var body PlayReadyMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserDrawGroup sends DrawGroup to co.SpnJuliUser.
+func UserDrawGroup(ctx context.Context, cli n.Client, req DrawGroupMsg) (*DrawGroupMsgR, n.NError) {
+	var res DrawGroupMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "DrawGroup", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserDrawGroupGrid registers a grid handler for DrawGroup with a decoded body.
+func RegisterUserDrawGroupGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawGroupMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("DrawGroup", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body DrawGroupMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserDrawGroupRand registers a rand handler for DrawGroup with a decoded body.
+func RegisterUserDrawGroupRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawGroupMsg)) {
+	cli.RegisterRandHandler("DrawGroup", func(cli n.Client, req *n.RequestMsg) {
+		var body DrawGroupMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserDrawSingle sends DrawSingle to co.SpnJuliUser.
+func UserDrawSingle(ctx context.Context, cli n.Client, req DrawSingleMsg) (*DrawSingleMsgR, n.NError) {
+	var res DrawSingleMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "DrawSingle", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserDrawSingleGrid registers a grid handler for DrawSingle with a decoded body.
+func RegisterUserDrawSingleGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawSingleMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("DrawSingle", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body DrawSingleMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserDrawSingleRand registers a rand handler for DrawSingle with a decoded body.
+func RegisterUserDrawSingleRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawSingleMsg)) {
+	cli.RegisterRandHandler("DrawSingle", func(cli n.Client, req *n.RequestMsg) {
+		var body DrawSingleMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserCMatchUp sends CMatchUp to co.SpnJuliUser.
+func UserCMatchUp(ctx context.Context, cli n.Client, req CMatchUpMsg) (*CMatchUpMsgR, n.NError) {
+	var res CMatchUpMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "CMatchUp", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserCMatchUpGrid registers a grid handler for CMatchUp with a decoded body.
+func RegisterUserCMatchUpGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CMatchUpMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("CMatchUp", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body CMatchUpMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserCMatchUpRand registers a rand handler for CMatchUp with a decoded body.
+func RegisterUserCMatchUpRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CMatchUpMsg)) {
+	cli.RegisterRandHandler("CMatchUp", func(cli n.Client, req *n.RequestMsg) {
+		var body CMatchUpMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserCPlayStart sends CPlayStart to co.SpnJuliUser.
+func UserCPlayStart(ctx context.Context, cli n.Client, req CPlayStartMsg) (*CPlayStartMsgR, n.NError) {
+	var res CPlayStartMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "CPlayStart", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserCPlayStartGrid registers a grid handler for CPlayStart with a decoded body.
+func RegisterUserCPlayStartGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CPlayStartMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("CPlayStart", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body CPlayStartMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserCPlayStartRand registers a rand handler for CPlayStart with a decoded body.
+func RegisterUserCPlayStartRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CPlayStartMsg)) {
+	cli.RegisterRandHandler("CPlayStart", func(cli n.Client, req *n.RequestMsg) {
+		var body CPlayStartMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// UserCPlayEnd sends CPlayEnd to co.SpnJuliUser.
+func UserCPlayEnd(ctx context.Context, cli n.Client, req CPlayEndMsg) (*CPlayEndMsgR, n.NError) {
+	var res CPlayEndMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliUser, "CPlayEnd", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterUserCPlayEndGrid registers a grid handler for CPlayEnd with a decoded body.
+func RegisterUserCPlayEndGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CPlayEndMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("CPlayEnd", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body CPlayEndMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterUserCPlayEndRand registers a rand handler for CPlayEnd with a decoded body.
+func RegisterUserCPlayEndRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *CPlayEndMsg)) {
+	cli.RegisterRandHandler("CPlayEnd", func(cli n.Client, req *n.RequestMsg) {
+		var body CPlayEndMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
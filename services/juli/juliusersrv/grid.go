@@ -16,12 +16,14 @@ type GridData struct {
 	PlNo   int
 }
 
-func CreateGridData(key co.TUserID, gridData interface{}) *GridData {
-	if gridData == nil {
-		return &GridData{UserID: key}
-	}
+// key is UserID
+func newGridData(key string) *GridData {
+	return &GridData{UserID: co.TUserID(key)}
+}
 
-	return gridData.(*GridData)
+//IsJoined는 gd가 nil이면(grid data가 없으면) false이다.
+func (gd *GridData) IsJoined() bool {
+	return gd != nil && len(gd.RoomID) > 0
 }
 
 func (gd *GridData) ClearRoom() {
@@ -5,7 +5,9 @@ import (
 	"os"
 
 	"github.com/Azraid/pasque/app"
+	co "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
+	"github.com/Azraid/pasque/services/auth"
 	. "github.com/Azraid/pasque/services/juli"
 )
 
@@ -28,14 +30,18 @@ func main() {
 	app.InitApp(eid, "", workPath)
 
 	cli := n.NewClient(eid)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(JoinInMsg{}), OnJoinIn)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(PlayReadyMsg{}), OnPlayReady)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(CPlayStartMsg{}), OnCPlayStart)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(CPlayEndMsg{}), OnCPlayEnd)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(CMatchUpMsg{}), OnCMatchUp)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(LeaveRoomMsg{}), OnLeaveRoom)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(DrawGroupMsg{}), OnDrawGroup)
-	cli.RegisterGridHandler(n.GetNameOfApiMsg(DrawSingleMsg{}), OnDrawSingle)
+	n.RegisterGridConstructor(cli, newGridData)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(JoinInMsg{}), OnJoinIn)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(PlayReadyMsg{}), OnPlayReady)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(CPlayStartMsg{}), OnCPlayStart)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(CPlayEndMsg{}), OnCPlayEnd)
+	n.RegisterGridCreateHandlerT(cli, n.GetNameOfApiMsg(CMatchUpMsg{}), OnCMatchUp)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(LeaveRoomMsg{}), OnLeaveRoom)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(DrawGroupMsg{}), OnDrawGroup)
+	n.RegisterGridHandlerT(cli, n.GetNameOfApiMsg(DrawSingleMsg{}), OnDrawSingle)
+	cli.Subscribe(auth.TopicSessionLogout, OnSessionLogout)
+	cli.SetRetryPolicy(co.SpnSession, n.GetNameOfApiMsg(auth.GetUserLocationMsg{}), n.DefaultRetryPolicy)
+	cli.SetRetryPolicy(co.SpnMatch, n.GetNameOfApiMsg(MatchPlayMsg{}), n.DefaultRetryPolicy)
 
 	toplgy := n.Topology{
 		Spn:           app.Config.Spn,
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -11,37 +12,24 @@ import (
 	. "github.com/Azraid/pasque/services/juli"
 )
 
-func doGetUserLocation(cli n.Client, userID TUserID) (string, string, string, string, error) {
+func doGetUserLocation(ctx context.Context, cli n.Client, userID TUserID) (string, string, string, string, error) {
 	req := auth.GetUserLocationMsg{UserID: userID, Spn: GameTcGateSpn}
 
-	res, err := cli.SendReq(SpnSession, n.GetNameOfApiMsg(req), req)
-	if err != nil {
-		return "", "", "", "", err
-	}
-
-	var rbody auth.GetUserLocationMsgR
-	if err := json.Unmarshal(res.Body, &rbody); err != nil {
-		return "", "", "", "", err
+	rbody, nerr := auth.GetUserLocation(ctx, cli, req)
+	if !nerr.IsSuccess() {
+		return "", "", "", "", nerr
 	}
 
 	return GameTcGateSpn, rbody.GateEid, rbody.Eid, rbody.SessionID, nil
 }
 
-func doJoinRoom(cli n.Client, roomID string, userID TUserID, mode TGMode) (int, n.NError) {
+func doJoinRoom(ctx context.Context, cli n.Client, roomID string, userID TUserID, mode TGMode) (int, n.NError) {
 	req := JoinRoomMsg{RoomID: roomID,
 		UserID: userID,
 		Mode:   mode.String()}
-	r, err := cli.SendReq(SpnJuliWorld, n.GetNameOfApiMsg(req), req)
-
-	if err != nil {
-		return 0, RaiseNError(n.NErrorInternal, err.Error())
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		return 0, RaiseNError(r.Header.ErrCode)
-	}
-
-	var rbody JoinRoomMsgR
-	if err := json.Unmarshal(r.Body, &rbody); err != nil {
-		return 0, RaiseNError(n.NErrorInternal, err.Error())
+	rbody, nerr := WorldJoinRoom(ctx, cli, req)
+	if !nerr.IsSuccess() {
+		return 0, nerr
 	}
 
 	return rbody.PlNo, RaiseNError(n.NErrorSucess)
@@ -81,236 +69,124 @@ func doLeaveRoom(cli n.Client, roomID string, userID TUserID) n.NError {
 	return RaiseNError(n.NErrorSucess)
 }
 
-func OnJoinIn(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body JoinInMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
+func OnJoinIn(cli n.Client, req *n.RequestMsg, gd *GridData, body *JoinInMsg) (*GridData, interface{}, n.NError) {
 	gmode, err := ParseTGMode(body.Mode)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+		return gd, nil, RaiseNError(n.NErrorParsingError)
 	}
 
-	gd := CreateGridData(TUserID(req.Header.Key), gridData)
-	if len(gd.RoomID) > 0 {
+	if gd.IsJoined() {
 		doLeaveRoom(cli, gd.RoomID, gd.UserID)
 		emreq := LeaveWaitingMsg{UserID: body.UserID}
-		cli.SendReq(SpnMatch, n.GetNameOfApiMsg(emreq), emreq)
-		cli.SendResWithError(req, RaiseNError(NErrorjuliGameRunning), nil)
+		cli.SendReqCtx(req.Context(), SpnMatch, n.GetNameOfApiMsg(emreq), emreq)
 		gd.ClearRoom()
-		return gd
+		return gd, nil, RaiseNError(NErrorjuliGameRunning)
 	}
 
 	roomID := GenerateGuid().String()
 
 	if gmode == EGMODE_PP {
-		_matchPlay := MatchPlayMsg{UserID: gd.UserID, Grade: 1}
-		res, err := cli.SendReq(SpnMatch, n.GetNameOfApiMsg(_matchPlay), _matchPlay)
-		if err != nil {
-			cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-			return gd
-		} else if res.Header.ErrCode != n.NErrorSucess {
-			cli.SendResWithError(req, res.Header.GetError(), nil)
-			return gd
-		}
-
-		var rbody MatchPlayMsgR
-		if err := json.Unmarshal(res.Body, &rbody); err != nil {
-			app.ErrorLog(err.Error())
-			cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-			return gd
+		rbody, nerr := MatchPlay(req.Context(), cli, MatchPlayMsg{UserID: gd.UserID, Grade: 1})
+		if !nerr.IsSuccess() {
+			return gd, nil, nerr
 		}
 
 		if !rbody.GuestID.IsZero() && !rbody.OwnerID.IsZero() { // 매치가 성사되었다면..
-			ownerPlNo, nerr := doJoinRoom(cli, roomID, rbody.OwnerID, EGMODE_PP)
+			ownerPlNo, nerr := doJoinRoom(req.Context(), cli, roomID, rbody.OwnerID, EGMODE_PP)
 			if !nerr.IsSuccess() {
-				cli.SendResWithError(req, nerr, nil)
-				return gd
+				return gd, nil, nerr
 			}
 
-			guestPlNo, nerr := doJoinRoom(cli, roomID, rbody.GuestID, EGMODE_PP)
+			guestPlNo, nerr := doJoinRoom(req.Context(), cli, roomID, rbody.GuestID, EGMODE_PP)
 			if !nerr.IsSuccess() {
-				cli.SendResWithError(req, nerr, nil)
-				return gd
+				return gd, nil, nerr
 			}
 
-			
+			//상대에게 matchup을 알리기 전에 먼저 응답한다.
 			cli.SendRes(req, JoinInMsgR{Nick: `송혜교`, Grade: 1})
 
 			doMatchUp(cli, roomID, rbody.OwnerID, ownerPlNo, rbody.GuestID, guestPlNo)
 			doMatchUp(cli, roomID, rbody.GuestID, guestPlNo, rbody.OwnerID, ownerPlNo)
 
-			return gd
+			return gd, nil, nil
 		}
 	} else { //다른 play mode
-		plNo, nerr := doJoinRoom(cli, roomID, gd.UserID, gmode)
+		plNo, nerr := doJoinRoom(req.Context(), cli, roomID, gd.UserID, gmode)
 		if !nerr.IsSuccess() {
-			cli.SendResWithError(req, nerr, nil)
-			return gd
+			return gd, nil, nerr
 		}
 
 		doMatchUp(cli, roomID, gd.UserID, plNo, TUserID(""), 0)
 	}
 
-	cli.SendRes(req, JoinInMsgR{Nick: `송혜교`, Grade: 1})
-	return gd
+	return gd, JoinInMsgR{Nick: `송혜교`, Grade: 1}, nil
 }
 
-func OnPlayReady(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body PlayReadyMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet"), nil)
-		return gridData
+func OnPlayReady(cli n.Client, req *n.RequestMsg, gd *GridData, body *PlayReadyMsg) (*GridData, interface{}, n.NError) {
+	if !gd.IsJoined() {
+		return gd, nil, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet")
 	}
 
-	gd := gridData.(*GridData)
 	body.RoomID = gd.RoomID
 
-	if r, err := cli.SendReq(SpnJuliWorld, n.GetNameOfApiMsg(body), body); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gd
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, r.Header.GetError(), nil)
-		return gd
-	} else {
-		var rbody PlayReadyMsgR
-		if err := json.Unmarshal(r.Body, &rbody); err != nil {
-			app.ErrorLog(err.Error())
-			cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-			return gd
-		}
-
-		cli.SendRes(req, rbody)
+	rbody, nerr := WorldPlayReady(req.Context(), cli, *body)
+	if !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	return gd
+	return gd, rbody, nil
 }
 
-func OnLeaveRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body LeaveRoomMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
+func OnLeaveRoom(cli n.Client, req *n.RequestMsg, gd *GridData, body *LeaveRoomMsg) (*GridData, interface{}, n.NError) {
 	emreq := LeaveWaitingMsg{UserID: body.UserID}
-	cli.SendReq(SpnMatch, n.GetNameOfApiMsg(emreq), emreq)
+	cli.SendReqCtx(req.Context(), SpnMatch, n.GetNameOfApiMsg(emreq), emreq)
 
-	if gridData != nil {
-		gd := gridData.(*GridData)
-		if len(gd.RoomID) > 0 {
-			doLeaveRoom(cli, gd.RoomID, gd.UserID)
-		}
+	if gd.IsJoined() {
+		doLeaveRoom(cli, gd.RoomID, gd.UserID)
 		gd.ClearRoom()
 	}
 
-	cli.SendRes(req, LeaveRoomMsgR{})
-	return gridData
+	return gd, LeaveRoomMsgR{}, nil
 }
 
-func OnDrawGroup(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body DrawGroupMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet"), nil)
-		return gridData
+func OnDrawGroup(cli n.Client, req *n.RequestMsg, gd *GridData, body *DrawGroupMsg) (*GridData, interface{}, n.NError) {
+	if !gd.IsJoined() {
+		return gd, nil, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet")
 	}
 
-	gd := gridData.(*GridData)
 	body.RoomID = gd.RoomID
 
-	if r, err := cli.SendReq(SpnJuliWorld, "DrawGroup", body); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gd
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, r.Header.GetError(), nil)
-		return gd
-	} else {
-		var rbody DrawGroupMsgR
-		if err := json.Unmarshal(r.Body, &rbody); err != nil {
-			app.ErrorLog(err.Error())
-			cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-			return gd
-		}
-
-		cli.SendRes(req, rbody)
+	rbody, nerr := WorldDrawGroup(req.Context(), cli, *body)
+	if !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	return gd
+	return gd, rbody, nil
 }
 
-func OnDrawSingle(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body DrawSingleMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet"), nil)
-		return gridData
+func OnDrawSingle(cli n.Client, req *n.RequestMsg, gd *GridData, body *DrawSingleMsg) (*GridData, interface{}, n.NError) {
+	if !gd.IsJoined() {
+		return gd, nil, RaiseNError(NErrorjuliNotFoundRoomID, "not join room yet")
 	}
 
-	gd := gridData.(*GridData)
 	body.RoomID = gd.RoomID
 
-	if r, err := cli.SendReq(SpnJuliWorld, "DrawSingle", body); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal), nil)
-		return gd
-	} else if r.Header.ErrCode != n.NErrorSucess {
-		cli.SendResWithError(req, r.Header.GetError(), nil)
-		return gd
-	} else {
-		var rbody DrawSingleMsgR
-		if err := json.Unmarshal(r.Body, &rbody); err != nil {
-			app.ErrorLog(err.Error())
-			cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-			return gd
-		}
-
-		cli.SendRes(req, rbody)
+	rbody, nerr := WorldDrawSingle(req.Context(), cli, *body)
+	if !nerr.IsSuccess() {
+		return gd, nil, nerr
 	}
 
-	return gd
+	return gd, rbody, nil
 }
 
 //no reply
-func OnCMatchUp(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body CMatchUpMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	gd := CreateGridData(TUserID(req.Header.Key), gridData)
+func OnCMatchUp(cli n.Client, req *n.RequestMsg, gd *GridData, body *CMatchUpMsg) (*GridData, interface{}, n.NError) {
 	gd.PlNo = body.PlNo
 	gd.RoomID = body.RoomID
 
 	ok := true
-	if spn, gateEid, eid, _, err := doGetUserLocation(cli, body.UserID); err == nil {
-		if res, err := cli.SendReqDirect(spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
+	if spn, gateEid, eid, _, err := doGetUserLocation(req.Context(), cli, body.UserID); err == nil {
+		if res, err := cli.SendReqDirectCtx(req.Context(), spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
 			app.ErrorLog(err.Error())
 			ok = false
 		} else if res.Header.ErrCode != n.NErrorSucess {
@@ -327,23 +203,14 @@ func OnCMatchUp(cli n.Client, req *n.RequestMsg, gridData interface{}) interface
 		gd.ClearRoom()
 	}
 
-	return gd
+	return gd, nil, nil
 }
 
-func OnCPlayStart(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body CPlayStartMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	gd := CreateGridData(TUserID(req.Header.Key), gridData)
+func OnCPlayStart(cli n.Client, req *n.RequestMsg, gd *GridData, body *CPlayStartMsg) (*GridData, interface{}, n.NError) {
 
 	ok := true
-	if spn, gateEid, eid, _, err := doGetUserLocation(cli, body.UserID); err == nil {
-		if res, err := cli.SendReqDirect(spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
+	if spn, gateEid, eid, _, err := doGetUserLocation(req.Context(), cli, body.UserID); err == nil {
+		if res, err := cli.SendReqDirectCtx(req.Context(), spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
 			app.ErrorLog(err.Error())
 			ok = false
 		} else if res.Header.ErrCode != n.NErrorSucess {
@@ -355,29 +222,18 @@ func OnCPlayStart(cli n.Client, req *n.RequestMsg, gridData interface{}) interfa
 		ok = false
 	}
 
-	cli.SendRes(req, CPlayStartMsgR{})
-
 	if !ok {
 		doLeaveRoom(cli, gd.RoomID, gd.UserID)
 		gd.ClearRoom()
 	}
 
-	return gd
+	return gd, CPlayStartMsgR{}, nil
 }
 
-func OnCPlayEnd(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body CPlayEndMsg
+func OnCPlayEnd(cli n.Client, req *n.RequestMsg, gd *GridData, body *CPlayEndMsg) (*GridData, interface{}, n.NError) {
 
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	gd := CreateGridData(TUserID(req.Header.Key), gridData)
-
-	if spn, gateEid, eid, _, err := doGetUserLocation(cli, body.UserID); err == nil {
-		if res, err := cli.SendReqDirect(spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
+	if spn, gateEid, eid, _, err := doGetUserLocation(req.Context(), cli, body.UserID); err == nil {
+		if res, err := cli.SendReqDirectCtx(req.Context(), spn, gateEid, eid, n.GetNameOfApiMsg(body), body); err != nil {
 			app.ErrorLog(err.Error())
 		} else if res.Header.ErrCode != n.NErrorSucess {
 			app.ErrorLog(PrintNError(res.Header.ErrCode))
@@ -387,5 +243,16 @@ func OnCPlayEnd(cli n.Client, req *n.RequestMsg, gridData interface{}) interface
 	}
 
 	gd.ClearRoom()
-	return gd
+	return gd, nil, nil
+}
+
+//OnSessionLogout은 session이 끊어진 사용자를 방에서 나가게 한다.
+func OnSessionLogout(cli n.Client, msg *n.RequestMsg) {
+	var body auth.SessionEvent
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		app.ErrorLog(err.Error())
+		return
+	}
+
+	cli.SendNoti(SpnJuliUser, n.GetNameOfApiMsg(LeaveRoomMsg{}), LeaveRoomMsg{UserID: body.UserID})
 }
@@ -1,5 +1,8 @@
 package juli
 
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnJuliWorld -prefix World -apis JoinRoom,GetRoom,LeaveRoom,PlayReady,DrawGroup,DrawSingle -o juliworld_rpc.go
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnJuliUser -prefix User -apis JoinIn,LeaveRoom,PlayReady,DrawGroup,DrawSingle,CMatchUp,CPlayStart,CPlayEnd -o juliuser_rpc.go
+
 import (
 	. "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
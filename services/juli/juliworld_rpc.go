@@ -0,0 +1,214 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package juli
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// WorldJoinRoom sends JoinRoom to co.SpnJuliWorld.
+func WorldJoinRoom(ctx context.Context, cli n.Client, req JoinRoomMsg) (*JoinRoomMsgR, n.NError) {
+	var res JoinRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "JoinRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldJoinRoomGrid registers a grid handler for JoinRoom with a decoded body.
+func RegisterWorldJoinRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldJoinRoomRand registers a rand handler for JoinRoom with a decoded body.
+func RegisterWorldJoinRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *JoinRoomMsg)) {
+	cli.RegisterRandHandler("JoinRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body JoinRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// WorldGetRoom sends GetRoom to co.SpnJuliWorld.
+func WorldGetRoom(ctx context.Context, cli n.Client, req GetRoomMsg) (*GetRoomMsgR, n.NError) {
+	var res GetRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "GetRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldGetRoomGrid registers a grid handler for GetRoom with a decoded body.
+func RegisterWorldGetRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("GetRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body GetRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldGetRoomRand registers a rand handler for GetRoom with a decoded body.
+func RegisterWorldGetRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *GetRoomMsg)) {
+	cli.RegisterRandHandler("GetRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body GetRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// WorldLeaveRoom sends LeaveRoom to co.SpnJuliWorld.
+func WorldLeaveRoom(ctx context.Context, cli n.Client, req LeaveRoomMsg) (*LeaveRoomMsgR, n.NError) {
+	var res LeaveRoomMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "LeaveRoom", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldLeaveRoomGrid registers a grid handler for LeaveRoom with a decoded body.
+func RegisterWorldLeaveRoomGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveRoomMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("LeaveRoom", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body LeaveRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldLeaveRoomRand registers a rand handler for LeaveRoom with a decoded body.
+func RegisterWorldLeaveRoomRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveRoomMsg)) {
+	cli.RegisterRandHandler("LeaveRoom", func(cli n.Client, req *n.RequestMsg) {
+		var body LeaveRoomMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// WorldPlayReady sends PlayReady to co.SpnJuliWorld.
+func WorldPlayReady(ctx context.Context, cli n.Client, req PlayReadyMsg) (*PlayReadyMsgR, n.NError) {
+	var res PlayReadyMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "PlayReady", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldPlayReadyGrid registers a grid handler for PlayReady with a decoded body.
+func RegisterWorldPlayReadyGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *PlayReadyMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("PlayReady", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body PlayReadyMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldPlayReadyRand registers a rand handler for PlayReady with a decoded body.
+func RegisterWorldPlayReadyRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *PlayReadyMsg)) {
+	cli.RegisterRandHandler("PlayReady", func(cli n.Client, req *n.RequestMsg) {
+		var body PlayReadyMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// WorldDrawGroup sends DrawGroup to co.SpnJuliWorld.
+func WorldDrawGroup(ctx context.Context, cli n.Client, req DrawGroupMsg) (*DrawGroupMsgR, n.NError) {
+	var res DrawGroupMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "DrawGroup", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldDrawGroupGrid registers a grid handler for DrawGroup with a decoded body.
+func RegisterWorldDrawGroupGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawGroupMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("DrawGroup", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body DrawGroupMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldDrawGroupRand registers a rand handler for DrawGroup with a decoded body.
+func RegisterWorldDrawGroupRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawGroupMsg)) {
+	cli.RegisterRandHandler("DrawGroup", func(cli n.Client, req *n.RequestMsg) {
+		var body DrawGroupMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// WorldDrawSingle sends DrawSingle to co.SpnJuliWorld.
+func WorldDrawSingle(ctx context.Context, cli n.Client, req DrawSingleMsg) (*DrawSingleMsgR, n.NError) {
+	var res DrawSingleMsgR
+	if nerr := n.Call(ctx, cli, co.SpnJuliWorld, "DrawSingle", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterWorldDrawSingleGrid registers a grid handler for DrawSingle with a decoded body.
+func RegisterWorldDrawSingleGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawSingleMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("DrawSingle", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body DrawSingleMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterWorldDrawSingleRand registers a rand handler for DrawSingle with a decoded body.
+func RegisterWorldDrawSingleRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *DrawSingleMsg)) {
+	cli.RegisterRandHandler("DrawSingle", func(cli n.Client, req *n.RequestMsg) {
+		var body DrawSingleMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
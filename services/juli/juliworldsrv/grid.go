@@ -88,14 +88,10 @@ type GridData struct {
 
 var procTimer time.Duration = time.Millisecond * DEFAULT_TICK_MS
 
-func CreateGridData(key string, mode TGMode, gridData interface{}) (g *GridData) {
-	if gridData != nil {
-		g = gridData.(*GridData)
-	} else {
-		g = &GridData{GameStat: EGROOM_STAT_INIT, Mode: mode}
-		g.lock = new(sync.RWMutex)
-		g.tick = time.NewTicker(procTimer)
-	}
+// key is RoomID
+func newGridData(key string) *GridData {
+	g := &GridData{GameStat: EGROOM_STAT_INIT}
+	g.lock = new(sync.RWMutex)
 
 	g.opt = &GameOption{
 		responseDelayTimeMs: 0,
@@ -217,6 +213,20 @@ func (g *GridData) RemovePlayer(userID TUserID) {
 	}
 }
 
+//Open은 처음 JoinRoom된 방의 mode를 정하고 tick을 시작한다.
+func (g *GridData) Open(mode TGMode) {
+	g.Mode = mode
+	if g.tick == nil {
+		g.tick = time.NewTicker(procTimer)
+	}
+}
+
+//IsEmpty는 JoinRoom한 player가 없는 방인지 확인한다.
+//IsEmpty는 g가 nil이면(grid data가 없으면) true이다.
+func (g *GridData) IsEmpty() bool {
+	return g == nil || (g.p1 == nil && g.p2 == nil)
+}
+
 func (g *GridData) IsNull() bool {
 	if g.p1 == nil && g.p2 == nil && g.tick == nil {
 		return true
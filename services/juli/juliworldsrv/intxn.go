@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/Azraid/pasque/app"
@@ -24,58 +23,32 @@ func doCPlayEnd(cli n.Client, userID TUserID, status TEnd) n.NError {
 	return RaiseNError(n.NErrorSucess)
 }
 
-func OnJoinRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body JoinRoomMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
+func OnJoinRoom(cli n.Client, req *n.RequestMsg, g *GridData, body *JoinRoomMsg) (*GridData, interface{}, n.NError) {
 	mode, err := ParseTGMode(body.Mode)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError, "GMode error"), nil)
-		return gridData
+		return g, nil, RaiseNError(n.NErrorParsingError, "GMode error")
 	}
 
-	g := func() *GridData {
-		if gridData == nil {
-			return CreateGridData(req.Header.Key, mode, gridData)
-		} else {
-			return gridData.(*GridData)
-		}
-	}()
+	if g.IsEmpty() {
+		g.Open(mode)
+	}
 
 	if g.Mode != mode {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliGameModeMissMatch, "GMode error"), nil)
-		return g
+		return g, nil, RaiseNError(NErrorjuliGameModeMissMatch, "GMode error")
 	}
 	if p, err := g.SetPlayer(body.UserID); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal, "set player"), nil)
-		return g
+		return g, nil, RaiseNError(n.NErrorInternal, "set player")
 	} else {
-		cli.SendRes(req, JoinRoomMsgR{PlNo: p.plNo})
-		return g
+		return g, JoinRoomMsgR{PlNo: p.plNo}, nil
 	}
 }
 
 //GetRoom 전투방 정보에 대한 요청
-func OnGetRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body GetRoomMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
+func OnGetRoom(cli n.Client, req *n.RequestMsg, g *GridData, body *GetRoomMsg) (*GridData, interface{}, n.NError) {
+	if g.IsEmpty() {
+		return nil, nil, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID))
 	}
 
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID)),
-			nil)
-		return gridData
-	}
-
-	g := gridData.(*GridData)
 	res := GetRoomMsgR{Mode: g.Mode.String()}
 
 	res.Players[0].UserID = g.p1.userID
@@ -84,28 +57,14 @@ func OnGetRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{
 	res.Players[1].UserID = g.p2.userID
 	res.Players[1].PlNo = g.p2.plNo
 
-	if err := cli.SendRes(req, res); err != nil {
-		app.ErrorLog(err.Error())
-	}
-
-	return gridData
+	return g, res, nil
 }
 
-func OnLeaveRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body LeaveRoomMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID)),
-			nil)
-		return gridData
+func OnLeaveRoom(cli n.Client, req *n.RequestMsg, g *GridData, body *LeaveRoomMsg) (*GridData, interface{}, n.NError) {
+	if g.IsEmpty() {
+		return nil, nil, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID))
 	}
 
-	g := gridData.(*GridData)
 	g.Lock()
 	defer g.Unlock()
 
@@ -120,41 +79,24 @@ func OnLeaveRoom(cli n.Client, req *n.RequestMsg, gridData interface{}) interfac
 		g = nil
 	}
 
-	res := GetRoomMsgR{}
-
-	if err := cli.SendRes(req, res); err != nil {
-		app.ErrorLog(err.Error())
-	}
-	return g
+	return g, GetRoomMsgR{}, nil
 }
 
-func OnPlayReady(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body PlayReadyMsg
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
-
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID)),
-			nil)
-		return gridData
+func OnPlayReady(cli n.Client, req *n.RequestMsg, g *GridData, body *PlayReadyMsg) (*GridData, interface{}, n.NError) {
+	if g.IsEmpty() {
+		return nil, nil, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID))
 	}
 
-	g := gridData.(*GridData)
 	g.Lock()
 	defer g.Unlock()
 
 	if err := g.PlayReady(body.UserID); err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal, err.Error()), nil)
-		return gridData
+		return g, nil, RaiseNError(n.NErrorInternal, err.Error())
 	}
 
 	p, err := g.GetPlayer(body.UserID)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal, err.Error()), nil)
-		return g
+		return g, nil, RaiseNError(n.NErrorInternal, err.Error())
 	}
 
 	res := PlayReadyMsgR{}
@@ -170,41 +112,26 @@ func OnPlayReady(cli n.Client, req *n.RequestMsg, gridData interface{}) interfac
 
 	g.TryStart()
 
-	return g
+	return g, nil, nil
 }
 
-func OnDrawGroup(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body DrawGroupMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
+func OnDrawGroup(cli n.Client, req *n.RequestMsg, g *GridData, body *DrawGroupMsg) (*GridData, interface{}, n.NError) {
 
 	if body.Count < 1 {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("Count : %d", body.Count)), nil)
-		return gridData
+		return g, nil, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("Count : %d", body.Count))
 	}
 
 	dol, err := ParseTDol(body.DolKind)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("DolKind : %s", body.DolKind)), nil)
-		return gridData
+		return g, nil, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("DolKind : %s", body.DolKind))
 	}
 
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID)),
-			nil)
-		return gridData
+	if g.IsEmpty() {
+		return nil, nil, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID))
 	}
 
-	g := gridData.(*GridData)
-
 	if g.GameStat != EGROOM_STAT_READY && g.GameStat != EGROOM_STAT_PLAYING {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotPlaying, fmt.Sprintf("game stat %s", g.GameStat.String())), nil)
-
-		return g
+		return g, nil, RaiseNError(NErrorjuliNotPlaying, fmt.Sprintf("game stat %s", g.GameStat.String()))
 	}
 
 	g.Lock()
@@ -212,33 +139,22 @@ func OnDrawGroup(cli n.Client, req *n.RequestMsg, gridData interface{}) interfac
 
 	p, err := g.GetPlayer(body.UserID)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal, err.Error()), nil)
-
-		return g
+		return g, nil, RaiseNError(n.NErrorInternal, err.Error())
 	}
 
 	for i := 0; i < body.Count; i++ {
 		if !p.ValidIndex(body.Routes[i]) {
-			cli.SendResWithError(req, RaiseNError(NErrorjuliInvalidIndex, fmt.Sprintf("UserID:%s", body.UserID)),
-				nil)
-
-			return g
+			return g, nil, RaiseNError(NErrorjuliInvalidIndex, fmt.Sprintf("UserID:%s", body.UserID))
 		}
 
 		if !p.AbleToGenerate(body.Routes[i]) {
-			cli.SendResWithError(req, RaiseNError(NErrorjuliNotEmptySpace, fmt.Sprintf("UserID:%s", body.UserID)),
-				nil)
-
-			return g
+			return g, nil, RaiseNError(NErrorjuliNotEmptySpace, fmt.Sprintf("UserID:%s", body.UserID))
 		}
 	}
 
 	grpID := p.GetFreeGroupID()
 	if grpID < 0 {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliResourceFull, fmt.Sprintf("UserID:%s", body.UserID)),
-			nil)
-
-		return g
+		return g, nil, RaiseNError(NErrorjuliResourceFull, fmt.Sprintf("UserID:%s", body.UserID))
 	}
 
 	p.SetGroupSize(grpID, body.Count)
@@ -257,7 +173,7 @@ func OnDrawGroup(cli n.Client, req *n.RequestMsg, gridData interface{}) interfac
 		if p.other != nil {
 			SendGroupResultFall(p.other.userID, p, body.DolKind, body.Routes, body.Count, grpID)
 		}
-		return g
+		return g, nil, nil
 	}
 
 	SendGroupResultFirm(p.userID, p, body.DolKind, body.Routes, body.Count, grpID)
@@ -277,36 +193,22 @@ func OnDrawGroup(cli n.Client, req *n.RequestMsg, gridData interface{}) interfac
 		p.SlideAllDown()
 	}
 
-	return g
+	return g, nil, nil
 }
 
-func OnDrawSingle(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
-	var body DrawSingleMsg
-
-	if err := json.Unmarshal(req.Body, &body); err != nil {
-		app.ErrorLog(err.Error())
-		cli.SendResWithError(req, RaiseNError(n.NErrorParsingError), nil)
-		return gridData
-	}
+func OnDrawSingle(cli n.Client, req *n.RequestMsg, g *GridData, body *DrawSingleMsg) (*GridData, interface{}, n.NError) {
 
 	dol, err := ParseTDol(body.DolKind)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("DolKind : %s", body.DolKind)), nil)
-		return gridData
+		return g, nil, RaiseNError(n.NErrorInvalidparams, fmt.Sprintf("DolKind : %s", body.DolKind))
 	}
 
-	if gridData == nil {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID)),
-			nil)
-		return gridData
+	if g.IsEmpty() {
+		return nil, nil, RaiseNError(NErrorjuliNotFoundRoomID, fmt.Sprintf("roomID[%s]", body.RoomID))
 	}
 
-	g := gridData.(*GridData)
-
 	if g.GameStat != EGROOM_STAT_READY && g.GameStat != EGROOM_STAT_PLAYING {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotPlaying, fmt.Sprintf("game stat %s", g.GameStat.String())), nil)
-
-		return g
+		return g, nil, RaiseNError(NErrorjuliNotPlaying, fmt.Sprintf("game stat %s", g.GameStat.String()))
 	}
 
 	g.Lock()
@@ -314,23 +216,15 @@ func OnDrawSingle(cli n.Client, req *n.RequestMsg, gridData interface{}) interfa
 
 	p, err := g.GetPlayer(body.UserID)
 	if err != nil {
-		cli.SendResWithError(req, RaiseNError(n.NErrorInternal, err.Error()), nil)
-
-		return g
+		return g, nil, RaiseNError(n.NErrorInternal, err.Error())
 	}
 
 	if !p.ValidIndex(body.DrawPos) {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliInvalidIndex),
-			nil)
-
-		return g
+		return g, nil, RaiseNError(NErrorjuliInvalidIndex)
 	}
 
 	if !p.AbleToGenerate(body.DrawPos) {
-		cli.SendResWithError(req, RaiseNError(NErrorjuliNotEmptySpace),
-			nil)
-
-		return g
+		return g, nil, RaiseNError(NErrorjuliNotEmptySpace)
 	}
 
 	//reply sucess
@@ -344,7 +238,7 @@ func OnDrawSingle(cli n.Client, req *n.RequestMsg, gridData interface{}) interfa
 		if p.other != nil {
 			SendSingleResultFall(p.other.userID, p, body.DolKind, body.DrawPos, p.GetObjID(body.DrawPos))
 		}
-		return g
+		return g, nil, nil
 	}
 
 	SendSingleResultFirm(p.userID, p, body.DolKind, body.DrawPos, p.GetObjID(body.DrawPos))
@@ -364,5 +258,5 @@ func OnDrawSingle(cli n.Client, req *n.RequestMsg, gridData interface{}) interfa
 		p.SlideAllDown()
 	}
 
-	return g
+	return g, nil, nil
 }
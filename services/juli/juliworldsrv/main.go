@@ -5,7 +5,9 @@ import (
 	"os"
 
 	"github.com/Azraid/pasque/app"
+	co "github.com/Azraid/pasque/core"
 	n "github.com/Azraid/pasque/core/net"
+	"github.com/Azraid/pasque/services/auth"
 	. "github.com/Azraid/pasque/services/juli"
 )
 
@@ -28,12 +30,14 @@ func main() {
 	app.InitApp(eid, "", workPath)
 
 	rpcx = n.NewClient(eid)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(GetRoomMsg{}), OnGetRoom)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(LeaveRoomMsg{}), OnLeaveRoom)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(PlayReadyMsg{}), OnPlayReady)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(DrawGroupMsg{}), OnDrawGroup)
-	rpcx.RegisterGridHandler(n.GetNameOfApiMsg(DrawSingleMsg{}), OnDrawSingle)
+	n.RegisterGridConstructor(rpcx, newGridData)
+	n.RegisterGridCreateHandlerT(rpcx, n.GetNameOfApiMsg(JoinRoomMsg{}), OnJoinRoom)
+	n.RegisterGridHandlerT(rpcx, n.GetNameOfApiMsg(GetRoomMsg{}), OnGetRoom)
+	n.RegisterGridHandlerT(rpcx, n.GetNameOfApiMsg(LeaveRoomMsg{}), OnLeaveRoom)
+	n.RegisterGridHandlerT(rpcx, n.GetNameOfApiMsg(PlayReadyMsg{}), OnPlayReady)
+	n.RegisterGridHandlerT(rpcx, n.GetNameOfApiMsg(DrawGroupMsg{}), OnDrawGroup)
+	n.RegisterGridHandlerT(rpcx, n.GetNameOfApiMsg(DrawSingleMsg{}), OnDrawSingle)
+	rpcx.SetRetryPolicy(co.SpnSession, n.GetNameOfApiMsg(auth.GetUserLocationMsg{}), n.DefaultRetryPolicy)
 
 	toplgy := n.Topology{
 		Spn:           app.Config.Spn,
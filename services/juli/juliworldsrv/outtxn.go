@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 
 	"github.com/Azraid/pasque/app"
 	. "github.com/Azraid/pasque/core"
@@ -15,14 +15,10 @@ const CAsyncSend = true
 func doGetUserLocation(userID TUserID) (string, string, string, string, error) {
 	req := auth.GetUserLocationMsg{UserID: userID, Spn: GameTcGateSpn}
 
-	res, err := rpcx.SendReq(SpnSession, n.GetNameOfApiMsg(req), req)
-	if err != nil {
-		return "", "", "", "", err
-	}
-
-	var rbody auth.GetUserLocationMsgR
-	if err := json.Unmarshal(res.Body, &rbody); err != nil {
-		return "", "", "", "", err
+	//session이 죽어 있으면 circuit이 열려 바로 실패한다.
+	rbody, nerr := auth.GetUserLocation(context.Background(), rpcx, req)
+	if !nerr.IsSuccess() {
+		return "", "", "", "", nerr
 	}
 
 	return GameTcGateSpn, rbody.GateEid, rbody.Eid, rbody.SessionID, nil
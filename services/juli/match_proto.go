@@ -1,5 +1,7 @@
 package juli
 
+//go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnMatch -apis MatchPlay,LeaveWaiting -o match_rpc.go
+
 import (
 	co "github.com/Azraid/pasque/core"
 )
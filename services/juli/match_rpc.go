@@ -0,0 +1,78 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package juli
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+
+// MatchPlay sends MatchPlay to co.SpnMatch.
+func MatchPlay(ctx context.Context, cli n.Client, req MatchPlayMsg) (*MatchPlayMsgR, n.NError) {
+	var res MatchPlayMsgR
+	if nerr := n.Call(ctx, cli, co.SpnMatch, "MatchPlay", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterMatchPlayGrid registers a grid handler for MatchPlay with a decoded body.
+func RegisterMatchPlayGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *MatchPlayMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("MatchPlay", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body MatchPlayMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterMatchPlayRand registers a rand handler for MatchPlay with a decoded body.
+func RegisterMatchPlayRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *MatchPlayMsg)) {
+	cli.RegisterRandHandler("MatchPlay", func(cli n.Client, req *n.RequestMsg) {
+		var body MatchPlayMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+
+// LeaveWaiting sends LeaveWaiting to co.SpnMatch.
+func LeaveWaiting(ctx context.Context, cli n.Client, req LeaveWaitingMsg) (*LeaveWaitingMsgR, n.NError) {
+	var res LeaveWaitingMsgR
+	if nerr := n.Call(ctx, cli, co.SpnMatch, "LeaveWaiting", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+// RegisterLeaveWaitingGrid registers a grid handler for LeaveWaiting with a decoded body.
+func RegisterLeaveWaitingGrid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveWaitingMsg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("LeaveWaiting", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body LeaveWaitingMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+// RegisterLeaveWaitingRand registers a rand handler for LeaveWaiting with a decoded body.
+func RegisterLeaveWaitingRand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *LeaveWaitingMsg)) {
+	cli.RegisterRandHandler("LeaveWaiting", func(cli n.Client, req *n.RequestMsg) {
+		var body LeaveWaitingMsg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
@@ -28,8 +28,8 @@ func main() {
 	app.InitApp(eid, "", workPath)
 
 	rpcx = n.NewClient(eid)
-	rpcx.RegisterRandHandler(n.GetNameOfApiMsg(MatchPlayMsg{}), OnMatchPlay)
-	rpcx.RegisterRandHandler(n.GetNameOfApiMsg(LeaveWaitingMsg{}), OnLeaveWaiting)
+	RegisterMatchPlayRand(rpcx, OnMatchPlay)
+	RegisterLeaveWaitingRand(rpcx, OnLeaveWaiting)
 
 	toplgy := n.Topology{Spn: app.Config.Spn}
 
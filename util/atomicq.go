@@ -16,13 +16,17 @@ import (
 type AtomicQ struct {
 	msgL *list.List
 	lock *sync.RWMutex
+	cond *sync.Cond
 }
 
 func NewAtomicQ() *AtomicQ {
-	return &AtomicQ{
+	aq := &AtomicQ{
 		msgL: list.New(),
 		lock: new(sync.RWMutex),
 	}
+
+	aq.cond = sync.NewCond(aq.lock)
+	return aq
 }
 
 func (aq *AtomicQ) Push(v interface{}) {
@@ -31,6 +35,40 @@ func (aq *AtomicQ) Push(v interface{}) {
 	aq.msgL.PushBack(v) //순서를 바꾸면 안됨.
 }
 
+//WaitRoom은 길이가 max보다 작아질때까지 기다린다. 넣는 것은 PushLimit로 한다.
+func (aq *AtomicQ) WaitRoom(max int) {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	for max > 0 && aq.msgL.Len() >= max {
+		aq.cond.Wait()
+	}
+}
+
+//PushLimit는 길이가 max보다 작을때만 넣는다. 넣지 못하면 false
+func (aq *AtomicQ) PushLimit(v interface{}, max int) bool {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	if max > 0 && aq.msgL.Len() >= max {
+		return false
+	}
+	aq.msgL.PushBack(v)
+	return true
+}
+
+//PushDropOldest는 길이가 max 이상이면 가장 오래된 것을 빼내고 넣는다. 빼낸 값을 돌려준다.
+func (aq *AtomicQ) PushDropOldest(v interface{}, max int) (dropped interface{}) {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	if max > 0 && aq.msgL.Len() >= max {
+		dropped = aq.msgL.Remove(aq.msgL.Front())
+	}
+	aq.msgL.PushBack(v)
+	return dropped
+}
+
 func (aq *AtomicQ) Pop() (e *list.Element) {
 	aq.lock.Lock()
 	defer aq.lock.Unlock()
@@ -38,11 +76,19 @@ func (aq *AtomicQ) Pop() (e *list.Element) {
 	e = aq.msgL.Front()
 	if e != nil {
 		aq.msgL.Remove(e)
+		aq.cond.Broadcast()
 	}
 
 	return e
 }
 
+func (aq *AtomicQ) Len() int {
+	aq.lock.RLock()
+	defer aq.lock.RUnlock()
+
+	return aq.msgL.Len()
+}
+
 func (aq *AtomicQ) IsEmpty() bool {
 	aq.lock.Lock()
 	defer aq.lock.Unlock()
@@ -0,0 +1,212 @@
+/********************************************************************************
+* rpcgen
+* XxxMsg/XxxMsgR 프로토콜 struct로부터 typed client stub과 server 등록 helper를 만든다.
+*
+* usage) //go:generate go run github.com/Azraid/pasque/util/rpcgen -spnconst SpnSession -o proto_sess_rpc.go
+*   -spnconst : core 패키지의 spn 상수 이름
+*   -apis     : 생성할 api 목록 (콤마 구분, 생략하면 패키지의 모든 Msg/MsgR 쌍)
+*   -prefix   : 함수 이름 앞에 붙일 prefix. 한 패키지에 여러 spn이 있을때 사용한다.
+*
+* Written by azraid@gmail.com
+* Owned by azraid@gmail.com
+********************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const genHeader = "// Code generated by rpcgen. DO NOT EDIT."
+
+var tmpl = template.Must(template.New("rpc").Parse(genHeader + `
+
+package {{.Package}}
+
+import (
+	"context"
+
+	co "github.com/Azraid/pasque/core"
+	n "github.com/Azraid/pasque/core/net"
+)
+{{range .Apis}}
+//{{$.Prefix}}{{.}} sends {{.}} to co.{{$.SpnConst}}.
+func {{$.Prefix}}{{.}}(ctx context.Context, cli n.Client, req {{.}}Msg) (*{{.}}MsgR, n.NError) {
+	var res {{.}}MsgR
+	if nerr := n.Call(ctx, cli, co.{{$.SpnConst}}, "{{.}}", req, &res); !nerr.IsSuccess() {
+		return nil, nerr
+	}
+
+	return &res, n.Sucess()
+}
+
+//Register{{$.Prefix}}{{.}}Grid registers a grid handler for {{.}} with a decoded body.
+func Register{{$.Prefix}}{{.}}Grid(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *{{.}}Msg, gridData interface{}) interface{}) {
+	cli.RegisterGridHandler("{{.}}", func(cli n.Client, req *n.RequestMsg, gridData interface{}) interface{} {
+		var body {{.}}Msg
+		if !n.DecodeBody(cli, req, &body) {
+			return gridData
+		}
+
+		return handler(cli, req, &body, gridData)
+	})
+}
+
+//Register{{$.Prefix}}{{.}}Rand registers a rand handler for {{.}} with a decoded body.
+func Register{{$.Prefix}}{{.}}Rand(cli n.Client, handler func(cli n.Client, req *n.RequestMsg, body *{{.}}Msg)) {
+	cli.RegisterRandHandler("{{.}}", func(cli n.Client, req *n.RequestMsg) {
+		var body {{.}}Msg
+		if !n.DecodeBody(cli, req, &body) {
+			return
+		}
+
+		handler(cli, req, &body)
+	})
+}
+{{end}}`))
+
+type genData struct {
+	Package  string
+	SpnConst string
+	Prefix   string
+	Apis     []string
+}
+
+func main() {
+	spnConst := flag.String("spnconst", "", "spn constant name in core package")
+	apis := flag.String("apis", "", "comma separated api names")
+	prefix := flag.String("prefix", "", "function name prefix")
+	out := flag.String("o", "", "output file")
+	flag.Parse()
+
+	if len(*spnConst) == 0 || len(*out) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	src, err := generate(".", *spnConst, *prefix, *apis)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+//generate는 dir 패키지의 api로 stub 소스를 만든다. apis가 비어있으면 모든 Msg/MsgR 쌍을 사용한다.
+func generate(dir string, spnConst string, prefix string, apis string) ([]byte, error) {
+	pkgName, found, err := parseApis(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data := genData{Package: pkgName, SpnConst: spnConst, Prefix: prefix}
+	if len(apis) > 0 {
+		for _, v := range strings.Split(apis, ",") {
+			v = strings.TrimSpace(v)
+			if !contains(found, v) {
+				return nil, fmt.Errorf("%sMsg/%sMsgR not found", v, v)
+			}
+			data.Apis = append(data.Apis, v)
+		}
+	} else {
+		data.Apis = found
+	}
+
+	if len(data.Apis) == 0 {
+		return nil, fmt.Errorf("no api found")
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+//parseApis는 XxxMsg와 XxxMsgR이 모두 정의된 api 이름을 소스 순서대로 돌려준다.
+func parseApis(dir string) (string, []string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments) //isGenerated가 header 주석을 본다.
+	if err != nil {
+		return "", nil, err
+	}
+
+	for name, pkg := range pkgs {
+		types := make(map[string]token.Pos)
+		for _, f := range pkg.Files {
+			if isGenerated(f) {
+				continue
+			}
+
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if _, ok := ts.Type.(*ast.StructType); ok {
+						types[ts.Name.Name] = ts.Pos()
+					}
+				}
+			}
+		}
+
+		var apis []string
+		for k := range types {
+			if strings.HasSuffix(k, "Msg") {
+				if _, ok := types[k+"R"]; ok {
+					apis = append(apis, strings.TrimSuffix(k, "Msg"))
+				}
+			}
+		}
+
+		sort.Slice(apis, func(i, j int) bool {
+			return types[apis[i]+"Msg"] < types[apis[j]+"Msg"]
+		})
+
+		return name, apis, nil
+	}
+
+	return "", nil, fmt.Errorf("no package in %s", dir)
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, c := range f.Comments {
+		if c.Pos() > f.Package {
+			break
+		}
+		if strings.HasPrefix(c.Text(), strings.TrimPrefix(genHeader, "// ")) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//Msg/MsgR 쌍만 소스 순서대로 찾고, 생성된 파일은 건너뛴다.
+func TestParseApis(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "pairs in source order",
+			files: map[string]string{"a.go": "package p\ntype ZooMsg struct{}\ntype ZooMsgR struct{}\ntype BarMsg struct{}\ntype BarMsgR struct{}\n"},
+			want:  []string{"Zoo", "Bar"},
+		},
+		{
+			name:  "request without response",
+			files: map[string]string{"a.go": "package p\ntype FooMsg struct{}\ntype BarMsg struct{}\ntype BarMsgR struct{}\n"},
+			want:  []string{"Bar"},
+		},
+		{
+			name:  "not struct",
+			files: map[string]string{"a.go": "package p\ntype FooMsg int\ntype FooMsgR struct{}\n"},
+		},
+		{
+			name: "generated file skipped",
+			files: map[string]string{
+				"a.go":     "package p\ntype FooMsg struct{}\ntype FooMsgR struct{}\n",
+				"a_rpc.go": genHeader + "\n\npackage p\ntype BarMsg struct{}\ntype BarMsgR struct{}\n",
+			},
+			want: []string{"Foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rpcgen")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for fn, src := range tt.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(src), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pkg, apis, err := parseApis(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pkg != "p" || !reflect.DeepEqual(apis, tt.want) {
+				t.Fatalf("package %s apis %v, want p %v", pkg, apis, tt.want)
+			}
+		})
+	}
+}
+
+//go:generate로 만든 파일이 지금의 generator 출력과 같아야 한다.
+func TestGenerateServices(t *testing.T) {
+	tests := []struct {
+		dir      string
+		spnConst string
+		prefix   string
+		apis     string
+		out      string
+		wantErr  bool
+	}{
+		{dir: "auth", spnConst: "SpnSession", apis: "GetUserLocation,LoginToken,CreateSession,Logout", out: "proto_sess_rpc.go"},
+		{dir: "chat", spnConst: "SpnChatUser", prefix: "User", apis: "CreateRoom,JoinRoom,ListMyRooms,SendChat,RecvChat", out: "chatuser_rpc.go"},
+		{dir: "chat", spnConst: "SpnChatRoom", prefix: "Room", apis: "GetRoom,JoinRoom,SendChat", out: "chatroom_rpc.go"},
+		{dir: "juli", spnConst: "SpnMatch", apis: "MatchPlay,LeaveWaiting", out: "match_rpc.go"},
+		{dir: "juli", spnConst: "SpnJuliUser", prefix: "User", apis: "JoinIn,LeaveRoom,PlayReady,DrawGroup,DrawSingle,CMatchUp,CPlayStart,CPlayEnd", out: "juliuser_rpc.go"},
+		{dir: "juli", spnConst: "SpnJuliWorld", prefix: "World", apis: "JoinRoom,GetRoom,LeaveRoom,PlayReady,DrawGroup,DrawSingle", out: "juliworld_rpc.go"},
+		{dir: "juli", spnConst: "SpnMatch", apis: "NoSuchApi", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+"/"+tt.out, func(t *testing.T) {
+			dir := filepath.Join("..", "..", "services", tt.dir)
+			src, err := generate(dir, tt.spnConst, tt.prefix, tt.apis)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err %v, want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			want, err := ioutil.ReadFile(filepath.Join(dir, tt.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(src, want) {
+				t.Fatalf("%s differs from generator output, run go generate", tt.out)
+			}
+		})
+	}
+}